@@ -1,14 +1,25 @@
 package commands
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/dragosv/delta/db"
 	"github.com/dragosv/delta/xliff"
+	"github.com/dragosv/delta/xlsx"
 	guuid "github.com/google/uuid"
 	"github.com/spf13/afero"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"io/ioutil"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func openTestDatabase() {
@@ -34,6 +45,24 @@ func setup() {
 	destination = path.Join("/delta/destination", guuid.New().String())
 	sourceLanguage = "en"
 	languagePattern = "([a-z]{2})\\.xliff"
+	xliffVersion = xliff.Version12
+	segment = false
+	segmentationRules = ""
+	force = false
+	jobFiles = []string{"xliff"}
+	sourceFormat = ""
+	jobName = ""
+	statusOutput = "table"
+	jobsOutput = "table"
+	pullLanguages = nil
+	closeJob = false
+	severity = "warning"
+	viper.Set("states.complete", xliff.DefaultPolicy().Complete)
+	viper.Set("states.done", []string{})
+	viper.Set("states.pull", "")
+	viper.Set("files.rules", nil)
+	viper.Set("files.include", []string{})
+	viper.Set("files.exclude", []string{})
 }
 
 func TestRunPushCommand_NoFiles(t *testing.T) {
@@ -53,8 +82,7 @@ func writeSourceTestDocument(xliffTransUnit xliff.TransUnit) error {
 }
 
 func writeDestinationTestDocument(xliffTarget xliff.Target) error {
-	jobID := strconv.FormatUint(uint64(dbJob.ID), 10)
-	xliffPath := path.Join(destination, jobID, xliffTarget.Language+".xliff")
+	xliffPath := path.Join(destination, dbJob.Name, xliffTarget.Language+".xliff")
 
 	xliffDocument, error := readDocument(xliffPath)
 
@@ -293,3 +321,2333 @@ func TestRunPullCommand_TranslatedFile(t *testing.T) {
 	assert.Equal(t, "translated", destinationTransUnit.Target.State)
 	assert.Equal(t, "fr", destinationTransUnit.Target.Language)
 }
+
+func TestRunPushCommand_Version20Source(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "fr.xliff"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en" trgLang="fr">
+  <file id="f1" original="fr.xliff">
+    <unit id="label.test" name="label.test">
+      <segment state="initial">
+        <source>test</source>
+      </segment>
+    </unit>
+    <unit id="label.done">
+      <segment state="reviewed">
+        <source>done</source>
+        <target>fait</target>
+      </segment>
+    </unit>
+  </file>
+</xliff>`), 0644)
+
+	runPushCommand(source, destination)
+
+	files := readDestinationDir()
+
+	assert.Equal(t, 1, len(files))
+
+	destinationDocument, error := readDocument(getPaths(files)[0])
+
+	assert.Nil(t, error)
+	assert.Equal(t, xliff.Version12, destinationDocument.Version)
+	assert.Equal(t, 1, len(destinationDocument.Files[0].Body.TransUnits))
+
+	destinationTransUnit := destinationDocument.Files[0].Body.TransUnits[0]
+
+	assert.Equal(t, "label.test", destinationTransUnit.Resname)
+	assert.Equal(t, "test", destinationTransUnit.Source.Data)
+	assert.Equal(t, "en", destinationTransUnit.Source.Language)
+	assert.Equal(t, "new", destinationTransUnit.Target.State)
+	assert.Equal(t, "fr", destinationTransUnit.Target.Language)
+}
+
+func TestRunPullCommand_Version20Job(t *testing.T) {
+	setup()
+
+	xliffVersion = xliff.Version20
+
+	writeSourceTestDocument(xliff.TransUnit{
+		ID:      "679fc2df14fb48f39718a0c20392d259",
+		Resname: "label.test",
+		Source: xliff.Source{
+			Data:     "translated",
+			Language: "en",
+		},
+		Target: xliff.Target{
+			State:    "new",
+			Language: "fr",
+		},
+	})
+
+	runPushCommand(source, destination)
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, error := readDocument(jobPath)
+
+	assert.Nil(t, error)
+	assert.Equal(t, xliff.Version20, jobDocument.Version)
+
+	writeDestinationTestDocument(xliff.Target{
+		State:    "signed-off",
+		Data:     "traduit",
+		Language: "fr",
+	})
+
+	runPullCommand(source, destination)
+
+	sourceDocument, error := readDocument(path.Join(source, "fr.xliff"))
+
+	assert.Nil(t, error)
+	assert.Equal(t, xliff.Version12, sourceDocument.Version)
+
+	sourceTransUnit := sourceDocument.Files[0].Body.TransUnits[0]
+
+	assert.Equal(t, "traduit", sourceTransUnit.Target.Data)
+	assert.Equal(t, "signed-off", sourceTransUnit.Target.State)
+}
+
+func TestRunPullCommand_Version20Segments(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "fr.xliff"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" xmlns:my="urn:example:my" version="2.0" srcLang="en" trgLang="fr">
+  <file id="f1" original="fr.xliff">
+    <unit id="label.paragraph">
+      <notes my:kind="ui">
+        <note category="context">Greeting</note>
+      </notes>
+      <segment id="s1" canResegment="no" state="initial">
+        <source>Hello Mr. Smith.</source>
+        <my:hint>formal</my:hint>
+      </segment>
+      <ignorable id="i1">
+        <source> </source>
+      </ignorable>
+      <segment id="s2">
+        <source>How are you?</source>
+      </segment>
+    </unit>
+  </file>
+</xliff>`), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	targetContent := parseTestMarkup(`<mrk mtype="seg" mid="s1">Bonjour M. Smith.</mrk> <mrk mtype="seg" mid="s2">Comment allez-vous ?</mrk>`)
+
+	writeDestinationTestDocument(xliff.Target{
+		State:    "translated",
+		Data:     targetContent.Text(),
+		Content:  targetContent,
+		Language: "fr",
+	})
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "fr.xliff"))
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" xmlns:my="urn:example:my" version="2.0" srcLang="en" trgLang="fr">
+  <file id="f1" original="fr.xliff">
+    <unit id="label.paragraph">
+      <notes my:kind="ui">
+        <note category="context">Greeting</note>
+      </notes>
+      <segment id="s1" canResegment="no" state="translated">
+        <source>Hello Mr. Smith.</source>
+        <target>Bonjour M. Smith.</target>
+        <my:hint>formal</my:hint>
+      </segment>
+      <ignorable id="i1">
+        <source> </source>
+      </ignorable>
+      <segment id="s2" state="translated">
+        <source>How are you?</source>
+        <target>Comment allez-vous ?</target>
+      </segment>
+    </unit>
+  </file>
+</xliff>`, string(actual))
+}
+
+func TestWriteDocument_Version20TargetWithoutSegments(t *testing.T) {
+	document, err := xliff.From([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en" trgLang="fr">
+  <file id="f1" original="fr.xliff">
+    <unit id="label.paragraph">
+      <segment id="s1">
+        <source>Hello.</source>
+      </segment>
+      <ignorable>
+        <source> </source>
+      </ignorable>
+      <segment id="s2">
+        <source>How are you?</source>
+      </segment>
+    </unit>
+  </file>
+</xliff>`))
+
+	assert.Nil(t, err)
+
+	// A target without segments, as pulled from a format without them.
+	document.Files[0].Body.TransUnits[0].Target.Data = "Bonjour, comment allez-vous ?"
+	document.Files[0].Body.TransUnits[0].Target.Content = nil
+	document.Files[0].Body.TransUnits[0].Target.State = "translated"
+
+	data, err := xliff.Marshal(document)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en" trgLang="fr">
+  <file id="f1" original="fr.xliff">
+    <unit id="label.paragraph">
+      <segment id="s1" state="translated">
+        <source>Hello.</source>
+        <target>Bonjour, comment allez-vous ?</target>
+      </segment>
+      <ignorable>
+        <source> </source>
+      </ignorable>
+      <segment id="s2" state="initial">
+        <source>How are you?</source>
+      </segment>
+    </unit>
+  </file>
+</xliff>`, string(data))
+
+	document, err = xliff.From(data)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "new", document.Files[0].Body.TransUnits[0].Target.State)
+}
+
+func parseTestMarkup(markup string) xliff.Content {
+	content, err := xliff.ParseMarkup(markup)
+	if err != nil {
+		panic(err)
+	}
+
+	return content
+}
+
+func writeInlineSourceTestDocument() {
+	sourceContent := parseTestMarkup(`Hello <g id="1" ctype="bold">world</g><x id="2" ctype="lb"/>`)
+
+	writeSourceTestDocument(xliff.TransUnit{
+		ID:      "779fc2df14fb48f39718a0c20392d259",
+		Resname: "label.inline",
+		Source: xliff.Source{
+			Data:     sourceContent.Text(),
+			Content:  sourceContent,
+			Language: "en",
+		},
+		Target: xliff.Target{
+			State:    "new",
+			Language: "fr",
+		},
+	})
+}
+
+func TestRunPullCommand_InlineMarkup(t *testing.T) {
+	setup()
+
+	writeInlineSourceTestDocument()
+
+	runPushCommand(source, destination)
+
+	var dbTransUnit db.TransUnit
+	database.First(&dbTransUnit)
+
+	assert.Equal(t, "Hello world", dbTransUnit.Source)
+	assert.Equal(t, `Hello <g id="1" ctype="bold">world</g><x id="2" ctype="lb"/>`, dbTransUnit.SourceMarkup)
+
+	targetContent := parseTestMarkup(`Bonjour <g id="1" ctype="bold">monde</g><x id="2" ctype="lb"/>`)
+
+	writeDestinationTestDocument(xliff.Target{
+		State:    "translated",
+		Data:     targetContent.Text(),
+		Content:  targetContent,
+		Language: "fr",
+	})
+
+	runPullCommand(source, destination)
+
+	sourceDocument, error := readDocument(path.Join(source, "fr.xliff"))
+
+	assert.Nil(t, error)
+
+	target := sourceDocument.Files[0].Body.TransUnits[0].Target
+
+	assert.Equal(t, "Bonjour monde", target.Data)
+	assert.Equal(t, `Bonjour <g id="1" ctype="bold">monde</g><x id="2" ctype="lb"/>`, target.Content.Markup())
+}
+
+func TestRunPullCommand_InlineMarkupVersion20Job(t *testing.T) {
+	setup()
+
+	xliffVersion = xliff.Version20
+
+	writeInlineSourceTestDocument()
+
+	runPushCommand(source, destination)
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+
+	assert.Equal(t, `Hello <pc id="1">world</pc><ph id="2"/>`, jobDocument.Files[0].Body.TransUnits[0].Source.Content.Markup())
+
+	targetContent := parseTestMarkup(`<ph id="2"/>Bonjour <pc id="1">monde</pc>`)
+
+	writeDestinationTestDocument(xliff.Target{
+		State:    "translated",
+		Data:     targetContent.Text(),
+		Content:  targetContent,
+		Language: "fr",
+	})
+
+	runPullCommand(source, destination)
+
+	sourceDocument, _ := readDocument(path.Join(source, "fr.xliff"))
+	target := sourceDocument.Files[0].Body.TransUnits[0].Target
+
+	assert.Equal(t, `<x id="2" ctype="lb"/>Bonjour <g id="1" ctype="bold">monde</g>`, target.Content.Markup())
+}
+
+func TestRunPullCommand_KeepsUnknownMarkup(t *testing.T) {
+	setup()
+
+	sourceData := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- exported by the app -->
+<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2" xmlns:ext="urn:example:ext">
+	<file original="app.strings" source-language="en" datatype="plaintext" target-language="fr" ext:build="42">
+		<header>
+			<tool tool-id="app" tool-name="App"/>
+			<ext:owner>team</ext:owner>
+		</header>
+		<body>
+			<trans-unit id="label.hello" approved="no"  maxwidth="40" xml:space="preserve">
+				<source>Hello   &amp; welcome</source>
+				<context-group purpose="location"><context context-type="sourcefile">Main.swift</context></context-group>
+				<note from="developer">Greeting</note>
+				<ext:data value="1"/>
+			</trans-unit>
+			<!-- legacy -->
+			<trans-unit id="label.bye" translate="yes">
+				<source>Bye</source>
+				<target state="new"/>
+				<alt-trans><target xml:lang="fr">Salut</target></alt-trans>
+			</trans-unit>
+			<trans-unit id="label.done">
+				<source>Done</source>
+				<target state="signed-off">Fini</target>
+			</trans-unit>
+			<group id="settings"><trans-unit id="label.kept"><source>Kept</source></trans-unit></group>
+		</body>
+	</file>
+</xliff>
+`
+
+	afero.WriteFile(fs, path.Join(source, "fr.xliff"), []byte(sourceData), 0644)
+
+	runPushCommand(source, destination)
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, error := readDocument(jobPath)
+
+	assert.Nil(t, error)
+	assert.Equal(t, 3, len(jobDocument.Files[0].Body.TransUnits))
+
+	jobDocument.Files[0].Body.TransUnits[0].Target = xliff.Target{State: "translated", Data: "Bonjour & bienvenue", Language: "fr"}
+	jobDocument.Files[0].Body.TransUnits[1].Target = xliff.Target{State: "translated", Data: "Au revoir", Language: "fr"}
+
+	writeDocument(jobDocument, jobPath)
+
+	runPullCommand(source, destination)
+
+	data, error := afero.ReadFile(fs, path.Join(source, "fr.xliff"))
+
+	assert.Nil(t, error)
+
+	expected := strings.Replace(sourceData, `&amp; welcome</source>
+`, `&amp; welcome</source>
+				<target state="translated">Bonjour &amp; bienvenue</target>
+`, 1)
+	expected = strings.Replace(expected, `<target state="new"/>`, `<target state="translated">Au revoir</target>`, 1)
+
+	assert.Equal(t, expected, string(data))
+}
+
+func TestRunPullCommand_Groups(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "fr.xliff"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2">
+  <file original="Main.storyboard" source-language="en" datatype="plaintext" target-language="fr">
+    <body>
+      <trans-unit id="title">
+        <source>Title</source>
+      </trans-unit>
+      <group id="settings">
+        <trans-unit id="title">
+          <source>Settings</source>
+        </trans-unit>
+        <group id="privacy">
+          <trans-unit id="title">
+            <source>Privacy</source>
+          </trans-unit>
+        </group>
+      </group>
+    </body>
+  </file>
+</xliff>
+`), 0644)
+
+	runPushCommand(source, destination)
+
+	var dbTransUnits []db.TransUnit
+	database.Order("id").Find(&dbTransUnits)
+
+	assert.Equal(t, 3, len(dbTransUnits))
+	assert.Equal(t, "", dbTransUnits[0].GroupPath)
+	assert.Equal(t, "settings", dbTransUnits[1].GroupPath)
+	assert.Equal(t, "settings/privacy", dbTransUnits[2].GroupPath)
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+
+	for i, data := range []string{"Titre", "Réglages", "Confidentialité"} {
+		jobDocument.Files[0].Body.TransUnits[i].Target = xliff.Target{State: "translated", Data: data, Language: "fr"}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	runPullCommand(source, destination)
+
+	sourceDocument, error := readDocument(path.Join(source, "fr.xliff"))
+
+	assert.Nil(t, error)
+
+	body := sourceDocument.Files[0].Body
+
+	assert.Equal(t, "Titre", body.TransUnits[0].Target.Data)
+	assert.Equal(t, "Réglages", body.Groups[0].TransUnits[0].Target.Data)
+	assert.Equal(t, "Confidentialité", body.Groups[0].Groups[0].TransUnits[0].Target.Data)
+	assert.True(t, sourceDocument.IsComplete(policy))
+}
+
+func TestSegment_LongParagraph(t *testing.T) {
+	segmenter, err := xliff.NewSegmenter(xliff.DefaultSegmentationRules)
+
+	assert.Nil(t, err)
+
+	// About 100 KB, which took minutes when rules were tried at each offset.
+	text := strings.Repeat("Hello Mr. Smith, how are you today? I am fine, thanks. ", 2000)
+	start := time.Now()
+	content := segmenter.Segment(xliff.TextContent(strings.TrimSpace(text)))
+
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Equal(t, 4000, len(content.Elements()))
+	assert.Equal(t, "Hello Mr. Smith, how are you today?", content[0].Content.Text())
+}
+
+func TestRunPullCommand_Segments(t *testing.T) {
+	setup()
+
+	segment = true
+
+	writeSourceTestDocument(xliff.TransUnit{
+		ID:      "label.paragraph",
+		Resname: "label.paragraph",
+		Source: xliff.Source{
+			Data:     "Hello Mr. Smith. How are you?",
+			Content:  xliff.TextContent("Hello Mr. Smith. How are you?"),
+			Language: "en",
+		},
+		Target: xliff.Target{
+			State:    "new",
+			Language: "fr",
+		},
+	})
+
+	runPushCommand(source, destination)
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+
+	jobTransUnit := jobDocument.Files[0].Body.TransUnits[0]
+
+	assert.Equal(t, `<mrk mtype="seg" mid="1">Hello Mr. Smith.</mrk> <mrk mtype="seg" mid="2">How are you?</mrk>`, jobTransUnit.SegSource.Content.Markup())
+
+	var dbSegments []db.Segment
+	database.Order("id").Find(&dbSegments)
+
+	assert.Equal(t, 2, len(dbSegments))
+	assert.Equal(t, "Hello Mr. Smith.", dbSegments[0].Source)
+	assert.Equal(t, "How are you?", dbSegments[1].Source)
+
+	targetContent := parseTestMarkup(`<mrk mtype="seg" mid="2">Comment allez-vous ?</mrk> <mrk mtype="seg" mid="1">Bonjour M. Smith.</mrk>`)
+
+	writeDestinationTestDocument(xliff.Target{
+		State:    "translated",
+		Data:     targetContent.Text(),
+		Content:  targetContent,
+		Language: "fr",
+	})
+
+	runPullCommand(source, destination)
+
+	database.Order("id").Find(&dbSegments)
+
+	assert.Equal(t, "Bonjour M. Smith.", dbSegments[0].Target)
+	assert.Equal(t, "Comment allez-vous ?", dbSegments[1].Target)
+
+	sourceDocument, error := readDocument(path.Join(source, "fr.xliff"))
+
+	assert.Nil(t, error)
+
+	target := sourceDocument.Files[0].Body.TransUnits[0].Target
+
+	assert.Equal(t, "Bonjour M. Smith. Comment allez-vous ?", target.Data)
+	assert.Equal(t, "translated", target.State)
+}
+
+func TestRunPushCommand_TranslateAndApproved(t *testing.T) {
+	setup()
+
+	viper.Set("states.complete", []string{"signed-off", "final"})
+
+	afero.WriteFile(fs, path.Join(source, "fr.xliff"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2">
+  <file original="fr.xliff" source-language="en" datatype="plaintext" target-language="fr">
+    <body>
+      <trans-unit id="label.brand" translate="no">
+        <source>Delta</source>
+      </trans-unit>
+      <trans-unit id="label.approved" approved="yes">
+        <source>Approved</source>
+        <target state="needs-review-translation">Approuvé</target>
+      </trans-unit>
+      <trans-unit id="label.final">
+        <source>Final</source>
+        <target state="final">Final</target>
+      </trans-unit>
+      <trans-unit id="label.translated">
+        <source>Translated</source>
+        <target state="translated">Traduit</target>
+      </trans-unit>
+      <group id="legal" translate="no">
+        <trans-unit id="label.terms">
+          <source>Terms</source>
+        </trans-unit>
+        <trans-unit id="label.privacy" translate="yes">
+          <source>Privacy</source>
+        </trans-unit>
+      </group>
+    </body>
+  </file>
+</xliff>
+`), 0644)
+
+	runPushCommand(source, destination)
+
+	var dbTransUnits []db.TransUnit
+	database.Order("id").Find(&dbTransUnits)
+
+	assert.Equal(t, 2, len(dbTransUnits))
+	assert.Equal(t, "label.translated", dbTransUnits[0].Qualifier)
+	assert.Equal(t, "label.privacy", dbTransUnits[1].Qualifier)
+}
+
+func TestRunPullCommand_StatePolicy(t *testing.T) {
+	setup()
+
+	viper.Set("states.complete", []string{"signed-off", "final", "x-*"})
+	viper.Set("states.done", []string{"translated", "x-done"})
+	viper.Set("states.pull", "signed-off")
+
+	afero.WriteFile(fs, path.Join(source, "fr.xliff"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2">
+  <file original="fr.xliff" source-language="en" datatype="plaintext" target-language="fr">
+    <body>
+      <trans-unit id="label.first">
+        <source>First</source>
+        <target state="translated">Premier</target>
+      </trans-unit>
+      <trans-unit id="label.second">
+        <source>Second</source>
+      </trans-unit>
+      <trans-unit id="label.custom">
+        <source>Custom</source>
+        <target state="x-locked">Personnalisé</target>
+      </trans-unit>
+    </body>
+  </file>
+</xliff>
+`), 0644)
+
+	runPushCommand(source, destination)
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+
+	assert.Equal(t, 2, len(jobDocument.Files[0].Body.TransUnits))
+
+	jobDocument.Files[0].Body.TransUnits[0].Target.State = "translated"
+	jobDocument.Files[0].Body.TransUnits[1].Target = xliff.Target{State: "needs-review-translation", Data: "Deuxième", Language: "fr"}
+
+	writeDocument(jobDocument, jobPath)
+
+	runPullCommand(source, destination)
+
+	sourceDocument, error := readDocument(path.Join(source, "fr.xliff"))
+
+	assert.Nil(t, error)
+
+	transUnits := sourceDocument.Files[0].Body.TransUnits
+
+	assert.Equal(t, "signed-off", transUnits[0].Target.State)
+	assert.Equal(t, "", transUnits[1].Target.Data)
+	assert.Equal(t, "", transUnits[1].Target.State)
+	assert.Equal(t, "x-locked", transUnits[2].Target.State)
+	assert.False(t, sourceDocument.IsComplete(policy))
+}
+
+func TestRunPullCommand_Version20CustomState(t *testing.T) {
+	setup()
+
+	viper.Set("states.complete", []string{"translated", "x-*"})
+	viper.Set("states.pull", "x-approved")
+
+	afero.WriteFile(fs, path.Join(source, "fr.xliff"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en" trgLang="fr">
+  <file id="f1" original="fr.xliff">
+    <unit id="label.test">
+      <segment>
+        <source>test</source>
+      </segment>
+    </unit>
+  </file>
+</xliff>`), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	writeDestinationTestDocument(xliff.Target{State: "translated", Data: "essai", Language: "fr"})
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "fr.xliff"))
+
+	// Custom states have no XLIFF 2.x equivalent, and are kept in subState.
+	assert.Contains(t, string(actual), `<segment state="initial" subState="delta:x-approved">`)
+
+	sourceDocument, _ := readDocument(path.Join(source, "fr.xliff"))
+
+	assert.Equal(t, "x-approved", sourceDocument.Files[0].Body.TransUnits[0].Target.State)
+
+	jobName = "again"
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	exists, _ := afero.Exists(fs, path.Join(destination, "again", "fr.xliff"))
+
+	assert.False(t, exists)
+}
+
+func TestRunPushCommand_UnknownState(t *testing.T) {
+	setup()
+
+	viper.Set("states.pull", "done")
+
+	assert.NotNil(t, runPushCommand(source, destination))
+}
+
+func TestRunPullCommand_LeavesUnchangedFiles(t *testing.T) {
+	setup()
+
+	for _, language := range []string{"fr", "de"} {
+		writeSourceTestDocument(xliff.TransUnit{
+			ID:      "label.test",
+			Resname: "label.test",
+			Source:  xliff.Source{Data: "test", Language: "en"},
+			Target:  xliff.Target{State: "new", Language: language},
+		})
+	}
+
+	runPushCommand(source, destination)
+
+	writeDestinationTestDocument(xliff.Target{State: "translated", Data: "essai", Language: "fr"})
+
+	before, _ := afero.ReadFile(fs, path.Join(source, "de.xliff"))
+
+	runPullCommand(source, destination)
+
+	after, _ := afero.ReadFile(fs, path.Join(source, "de.xliff"))
+
+	assert.Equal(t, string(before), string(after))
+
+	sourceDocument, error := readDocument(path.Join(source, "fr.xliff"))
+
+	assert.Nil(t, error)
+	assert.Equal(t, "essai", sourceDocument.Files[0].Body.TransUnits[0].Target.Data)
+
+	names, _ := afero.Glob(fs, path.Join(source, "*"))
+
+	assert.Equal(t, 2, len(names))
+}
+
+func TestRunValidateCommand_Version20(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "fr.xliff"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en">
+  <file id="f1">
+    <unit id="label.test">
+      <segment>
+        <source>Test</source>
+      </segment>
+    </unit>
+  </file>
+</xliff>
+`), 0644)
+
+	sourcePaths = nil
+
+	afero.Walk(fs, source, sourceWalkFunc)
+
+	for _, diagnostic := range validateSourceDocuments(sourcePaths) {
+		assert.NotEqual(t, xliff.SeverityError, diagnostic.Severity, diagnostic.Error())
+	}
+
+	assert.Nil(t, runValidateCommand(source))
+	assert.Nil(t, runPushCommand(source, destination))
+}
+
+func TestRunValidateCommand_Diagnostics(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "fr.xliff"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2">
+  <file original="fr.xliff" source-language="en" datatype="plaintext">
+    <body>
+      <trans-unit id="label.test">
+        <source>Test</source>
+        <target state="done">Essai</target>
+      </trans-unit>
+      <trans-unit id="label.test">
+        <source>Test</source>
+      </trans-unit>
+    </body>
+  </file>
+</xliff>
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "de.xliff"), []byte(`<xliff version="1.2"/>`), 0644)
+	afero.WriteFile(fs, path.Join(source, "es.xliff"), []byte("<xliff version=\"1.2\">\n<file>\n</xliff>"), 0644)
+
+	sourcePaths = nil
+
+	afero.Walk(fs, source, sourceWalkFunc)
+
+	diagnostics := validateSourceDocuments(sourcePaths)
+
+	assert.Equal(t, 6, len(diagnostics))
+
+	assert.Equal(t, path.Join(source, "de.xliff"), diagnostics[0].Path)
+	assert.Equal(t, xliff.MissingFile, diagnostics[0].Code)
+	assert.Equal(t, xliff.SeverityError, diagnostics[0].Severity)
+
+	assert.Equal(t, path.Join(source, "es.xliff"), diagnostics[1].Path)
+	assert.Equal(t, xliff.MalformedDocument, diagnostics[1].Code)
+	assert.Equal(t, 3, diagnostics[1].Line)
+
+	assert.Equal(t, xliff.MissingTargetLanguage, diagnostics[2].Code)
+	assert.Equal(t, xliff.SeverityWarning, diagnostics[2].Severity)
+	assert.Equal(t, 3, diagnostics[2].Line)
+	assert.Equal(t, 3, diagnostics[2].Column)
+
+	assert.Equal(t, xliff.UnknownTargetState, diagnostics[3].Code)
+	assert.Equal(t, xliff.SeverityWarning, diagnostics[3].Severity)
+	assert.Equal(t, "label.test", diagnostics[3].TransUnitID)
+	assert.Equal(t, 7, diagnostics[3].Line)
+	assert.Equal(t, 9, diagnostics[3].Column)
+
+	assert.Equal(t, xliff.DuplicateTransUnitID, diagnostics[4].Code)
+	assert.Equal(t, 9, diagnostics[4].Line)
+	assert.Equal(t, path.Join(source, "fr.xliff")+":9:7: error: DuplicateTransUnitID: Translation unit 'label.test' in file 'fr.xliff' has the same 'id' as another one", diagnostics[4].Error())
+
+	assert.Equal(t, xliff.MissingTransUnitTarget, diagnostics[5].Code)
+	assert.Equal(t, xliff.SeverityInfo, diagnostics[5].Severity)
+
+	assert.NotNil(t, runValidateCommand(source))
+}
+
+func TestRunPushCommand_ValidationErrors(t *testing.T) {
+	setup()
+
+	writeSourceTestDocument(xliff.TransUnit{
+		Source: xliff.Source{Data: "test", Language: "en"},
+		Target: xliff.Target{State: "new", Language: "fr"},
+	})
+
+	assert.NotNil(t, runPushCommand(source, destination))
+	assert.Equal(t, 0, len(readDestinationDir()))
+
+	force = true
+
+	assert.Nil(t, runPushCommand(source, destination))
+	assert.Equal(t, 1, len(readDestinationDir()))
+
+	// Files that cannot be read fail the push rather than crash it.
+	afero.WriteFile(fs, path.Join(source, "de.xliff"), []byte("<xliff version=\"1.2\">\n<file>\n</xliff>"), 0644)
+
+	assert.NotPanics(t, func() {
+		assert.Error(t, runPushCommand(source, destination))
+	})
+}
+
+func TestValidateStream_UnitsNumberedInFile(t *testing.T) {
+	diagnostics := xliff.ValidateStream(strings.NewReader(`<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2">
+  <file original="a" source-language="en" target-language="fr" datatype="plaintext">
+    <body>
+      <trans-unit id="label.a"><source>A</source><target>A</target></trans-unit>
+    </body>
+  </file>
+  <file original="b" source-language="en" target-language="fr" datatype="plaintext">
+    <body>
+      <trans-unit><source>B</source><target>B</target></trans-unit>
+    </body>
+  </file>
+</xliff>`))
+
+	assert.Equal(t, 1, len(diagnostics))
+	assert.Equal(t, "Translation unit #0 in file 'b' is missing 'id' attribute", diagnostics[0].Message)
+}
+
+func TestPullCommand_TargetLanguageFlag(t *testing.T) {
+	setup()
+
+	flags := pullCommand.Flags()
+
+	assert.Nil(t, flags.Parse([]string{"--target-language", "fr", "--target-language", "de"}))
+	assert.Equal(t, []string{"fr", "de"}, pullLanguages)
+	assert.Equal(t, []string{"fr", "de"}, viper.GetStringSlice("pull.languages"))
+
+	// The source language flag of the root command is kept for pull.
+	assert.Equal(t, "Source language", pullCommand.InheritedFlags().Lookup("language").Usage)
+
+	flags.Lookup("target-language").Changed = false
+	pullLanguages = nil
+}
+
+func TestRunPushCommand_CancelsFailedJob(t *testing.T) {
+	setup()
+
+	writeSourceTestDocument(xliff.TransUnit{
+		ID:      "label.hello",
+		Resname: "label.hello",
+		Source:  xliff.Source{Data: "Hello", Language: "en"},
+		Target:  xliff.Target{State: "new", Language: "fr"},
+	})
+
+	// The job files cannot be written, once the job is created.
+	writable := fs
+	fs = afero.NewReadOnlyFs(writable)
+
+	assert.Error(t, runPushCommand(source, destination))
+
+	fs = writable
+
+	var failed db.Job
+	database.First(&failed, 1)
+
+	assert.Equal(t, db.JobCanceled, failed.State())
+
+	// The units of the canceled job are pushed again.
+	assert.Nil(t, runPushCommand(source, destination))
+	assert.Equal(t, pushReport{Resent: 1}, pushed)
+}
+
+func TestRunPullCommand_KeepsEncoding(t *testing.T) {
+	setup()
+
+	document := func(encoding string, target string) string {
+		return `<?xml version="1.0" encoding="` + encoding + `"?>
+<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2">
+  <file original="messages" source-language="en" datatype="plaintext" target-language="fr">
+    <body>
+      <trans-unit id="label.price">
+        <source>Price in €</source>` + target + `
+      </trans-unit>
+    </body>
+  </file>
+</xliff>
+`
+	}
+
+	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder()
+	latin1 := charmap.ISO8859_1.NewEncoder()
+
+	data, _ := utf16.String(document("UTF-16", ""))
+	afero.WriteFile(fs, path.Join(source, "fr.xliff"), []byte(data), 0644)
+
+	data, _ = latin1.String(strings.Replace(document("ISO-8859-1", ""), "€", "&#8364;", 1))
+	afero.WriteFile(fs, path.Join(source, "legacy", "fr.xlf"), []byte(data), 0644)
+
+	languagePattern = "([a-z]{2})\\.xl"
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+
+	for i := range jobDocument.Files[0].Body.TransUnits {
+		jobDocument.Files[0].Body.TransUnits[i].Target = xliff.Target{State: "translated", Data: "Prix en € ou Fr.", Language: "fr"}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	expected, _ := utf16.String(document("UTF-16", "\n        <target state=\"translated\">Prix en € ou Fr.</target>"))
+	actual, _ := afero.ReadFile(fs, path.Join(source, "fr.xliff"))
+
+	assert.Equal(t, expected, string(actual))
+
+	expected, _ = latin1.String(strings.Replace(document("ISO-8859-1", "\n        <target state=\"translated\">Prix en &#8364; ou Fr.</target>"), "€", "&#8364;", 1))
+	actual, _ = afero.ReadFile(fs, path.Join(source, "legacy", "fr.xlf"))
+
+	assert.Equal(t, expected, string(actual))
+}
+
+func TestRunPullCommand_PO(t *testing.T) {
+	setup()
+
+	languagePattern = "([a-z]{2})\\.po"
+
+	afero.WriteFile(fs, path.Join(source, "fr.po"), []byte(`# French translation.
+msgid ""
+msgstr ""
+"Language: fr\n"
+"Plural-Forms: nplurals=2; plural=(n > 1);\n"
+
+msgid "Cancel"
+msgstr "Annuler"
+
+# Shown on the toolbar.
+#. Save button
+#: src/app.c:12 src/app.c:40
+#, c-format
+msgid "Save %s"
+msgstr ""
+
+#, fuzzy
+#| msgid "Open"
+msgid "Open file"
+msgstr "Ouvrir"
+
+msgctxt "menu"
+msgid "Close"
+msgstr ""
+
+msgid "%d file"
+msgid_plural "%d files"
+msgstr[0] ""
+msgstr[1] ""
+
+#~ msgid "Old"
+#~ msgstr "Vieux"
+`), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	assert.Equal(t, 5, len(transUnits))
+	assert.Equal(t, "en", jobDocument.Files[0].SourceLanguage)
+	assert.Equal(t, "Save %s", transUnits[0].Source.Data)
+	assert.Equal(t, 3, len(transUnits[0].Notes))
+	assert.Equal(t, "Shown on the toolbar.", transUnits[0].Notes[0].Data)
+	assert.Equal(t, "developer", transUnits[0].Notes[1].From)
+	assert.Equal(t, "src/app.c:12 src/app.c:40", transUnits[0].Notes[2].Data)
+	assert.Equal(t, "needs-review-translation", transUnits[1].Target.State)
+	assert.Equal(t, "menu", transUnits[2].Resname)
+	assert.Equal(t, "%d files", transUnits[4].Source.Data)
+
+	targets := []string{"Enregistrer %s", "Ouvrir le fichier", "Fermer", "%d fichier", "%d fichiers\nau total"}
+
+	for i := range transUnits {
+		transUnits[i].Target = xliff.Target{State: "translated", Data: targets[i], Language: "fr"}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "fr.po"))
+
+	assert.Equal(t, `# French translation.
+msgid ""
+msgstr ""
+"Language: fr\n"
+"Plural-Forms: nplurals=2; plural=(n > 1);\n"
+
+msgid "Cancel"
+msgstr "Annuler"
+
+# Shown on the toolbar.
+#. Save button
+#: src/app.c:12 src/app.c:40
+#, c-format
+msgid "Save %s"
+msgstr "Enregistrer %s"
+
+msgid "Open file"
+msgstr "Ouvrir le fichier"
+
+msgctxt "menu"
+msgid "Close"
+msgstr "Fermer"
+
+msgid "%d file"
+msgid_plural "%d files"
+msgstr[0] "%d fichier"
+msgstr[1] ""
+"%d fichiers\n"
+"au total"
+
+#~ msgid "Old"
+#~ msgstr "Vieux"
+`, string(actual))
+}
+
+func TestRunPullCommand_AndroidMarkup(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "res", "values", "strings.xml"), []byte(`<?xml version="1.0" encoding="utf-8"?>
+<resources>
+    <string name="hello">Hello &amp; welcome <b>%1$s</b>!</string>
+    <string name="link">See <a href="https://example.com">terms</a></string>
+    <string name="html"><![CDATA[Hello <b>world</b> & more]]></string>
+</resources>
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "res", "values-fr", "strings.xml"), []byte(""), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, dbJob.Name, "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	// Tags are inline codes, with the tag as written as native code.
+	assert.Equal(t, "Hello & welcome %1$s!", transUnits[0].Source.Data)
+	assert.Equal(t, `Hello &amp; welcome <bpt id="1">&lt;b&gt;</bpt>%1$s<ept id="1">&lt;/b&gt;</ept>!`, transUnits[0].Source.Markup())
+	assert.Equal(t, "Hello world & more", transUnits[2].Source.Data)
+
+	target := func(markup string) xliff.Target {
+		content := parseTestMarkup(markup)
+		return xliff.Target{State: "translated", Data: content.Text(), Content: content, Language: "fr"}
+	}
+
+	// Codes without native code are written as those of the source.
+	transUnits[0].Target = target(`L'ami &amp; co <bpt id="1"/>%1$s<ept id="1"/>!`)
+	transUnits[1].Target = target(`Voir les <bpt id="1">&lt;a href="https://example.com"&gt;</bpt>conditions<ept id="1">&lt;/a&gt;</ept> &amp; "règles" &lt;3`)
+	transUnits[2].Target = target(`Bonjour <bpt id="1">&lt;b&gt;</bpt>le monde<ept id="1">&lt;/b&gt;</ept> &amp; "plus"`)
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "res", "values-fr", "strings.xml"))
+
+	assert.Equal(t, `<?xml version="1.0" encoding="utf-8"?>
+<resources>
+    <string name="hello">L\'ami &amp; co <b>%1$s</b>!</string>
+    <string name="link">Voir les <a href="https://example.com">conditions</a> &amp; \"règles\" &lt;3</string>
+    <string name="html"><![CDATA[Bonjour <b>le monde</b> & \"plus\"]]></string>
+</resources>
+`, string(actual))
+}
+
+func TestRunPullCommand_Android(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "res", "values", "strings.xml"), []byte(`<?xml version="1.0" encoding="utf-8"?>
+<resources>
+    <!-- Name of the app -->
+    <string name="app_name" translatable="false">Delta</string>
+    <!-- Title of the main screen -->
+    <string name="title">Welcome to %1$s</string>
+    <string name="quote">Don\'t say \"no\"</string>
+    <string name="bold">Hello <b>world</b></string>
+    <string-array name="planets">
+        <item>Mercury</item>
+        <item>@string/title</item>
+    </string-array>
+    <plurals name="files">
+        <item quantity="one">%d file</item>
+        <item quantity="other">%d files</item>
+    </plurals>
+</resources>
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "res", "values-fr", "strings.xml"), []byte(`<?xml version="1.0" encoding="utf-8"?>
+<resources>
+    <!-- Translated by hand -->
+    <string name="quote">N\'en dites rien</string>
+    <string name="title"></string>
+    <plurals name="files">
+        <item quantity="one">%d fichier</item>
+    </plurals>
+</resources>
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "res", "layout", "main.xml"), []byte(`<LinearLayout/>`), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	// The many category of French is left out, as neither file has it.
+	assert.Equal(t, 4, len(transUnits))
+	assert.Equal(t, "Welcome to %1$s", transUnits[0].Source.Data)
+	assert.Equal(t, "Title of the main screen", transUnits[0].Notes[0].Data)
+	assert.Equal(t, "Hello world", transUnits[1].Source.Data)
+	assert.Equal(t, "Mercury", transUnits[2].Source.Data)
+	assert.Equal(t, "%d files", transUnits[3].Source.Data)
+
+	targets := []string{"Bienvenue sur %1$s", `Bonjour <bpt id="1">&lt;b&gt;</bpt>monde<ept id="1">&lt;/b&gt;</ept>`, "Mercure", "%d fichiers d'&quot;archive&quot;"}
+
+	for i := range transUnits {
+		content := parseTestMarkup(targets[i])
+		transUnits[i].Target = xliff.Target{State: "translated", Data: content.Text(), Content: content, Language: "fr"}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "res", "values-fr", "strings.xml"))
+
+	assert.Equal(t, `<?xml version="1.0" encoding="utf-8"?>
+<resources>
+    <!-- Translated by hand -->
+    <string name="quote">N\'en dites rien</string>
+    <string name="title">Bienvenue sur %1$s</string>
+    <plurals name="files">
+        <item quantity="one">%d fichier</item>
+        <item quantity="other">%d fichiers d\'\"archive\"</item>
+    </plurals>
+    <string name="bold">Bonjour <b>monde</b></string>
+    <string-array name="planets">
+        <item>Mercure</item>
+        <item>@string/title</item>
+    </string-array>
+</resources>
+`, string(actual))
+}
+
+func TestRunPullCommand_IOS(t *testing.T) {
+	setup()
+
+	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+
+	afero.WriteFile(fs, path.Join(source, "App", "en.lproj", "Localizable.strings"), []byte(`/* Title of the main screen */
+"title" = "Welcome";
+
+/* No comment provided by engineer. */
+"quote" = "Say \"hi\"\n";
+unquoted = "Done";
+`), 0644)
+	french, _ := utf16.NewEncoder().Bytes([]byte(`// Translated by hand
+"title" = "Bienvenue";
+`))
+	afero.WriteFile(fs, path.Join(source, "App", "fr.lproj", "Localizable.strings"), french, 0644)
+	afero.WriteFile(fs, path.Join(source, "App", "en.lproj", "Localizable.stringsdict"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>%d files</key>
+	<dict>
+		<key>NSStringLocalizedFormatKey</key>
+		<string>%#@files@</string>
+		<key>files</key>
+		<dict>
+			<key>NSStringFormatSpecTypeKey</key>
+			<string>NSStringPluralRuleType</string>
+			<key>NSStringFormatValueTypeKey</key>
+			<string>d</string>
+			<key>one</key>
+			<string>%d file</string>
+			<key>other</key>
+			<string>%d files</string>
+		</dict>
+	</dict>
+</dict>
+</plist>
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "App", "fr.lproj", "Localizable.stringsdict"), []byte{}, 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	assert.Equal(t, 5, len(transUnits))
+	assert.Equal(t, "Say \"hi\"\n", transUnits[0].Source.Data)
+	assert.Equal(t, 0, len(transUnits[0].Notes))
+	assert.Equal(t, "Done", transUnits[1].Source.Data)
+	assert.Equal(t, "%#@files@", transUnits[2].Source.Data)
+	assert.Equal(t, "%d file", transUnits[3].Source.Data)
+	assert.Equal(t, "%d files", transUnits[4].Source.Data)
+
+	var dbTransUnit db.TransUnit
+
+	database.Where("qualifier = ?", "other").First(&dbTransUnit)
+
+	assert.Equal(t, "%d files/files", dbTransUnit.GroupPath)
+
+	targets := []string{"Dites « salut »\n", "Terminé", "%#@files@", "%d fichier", "%d fichiers"}
+
+	for i := range transUnits {
+		transUnits[i].Target = xliff.Target{State: "translated", Data: targets[i], Language: "fr"}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "App", "fr.lproj", "Localizable.strings"))
+	actual, _ = utf16.NewDecoder().Bytes(actual)
+
+	assert.Equal(t, `// Translated by hand
+"title" = "Bienvenue";
+
+"quote" = "Dites « salut »\n";
+
+"unquoted" = "Terminé";
+`, string(actual))
+
+	actual, _ = afero.ReadFile(fs, path.Join(source, "App", "fr.lproj", "Localizable.stringsdict"))
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>%d files</key>
+	<dict>
+		<key>NSStringLocalizedFormatKey</key>
+		<string>%#@files@</string>
+		<key>files</key>
+		<dict>
+			<key>NSStringFormatSpecTypeKey</key>
+			<string>NSStringPluralRuleType</string>
+			<key>NSStringFormatValueTypeKey</key>
+			<string>d</string>
+			<key>one</key>
+			<string>%d fichier</string>
+			<key>other</key>
+			<string>%d fichiers</string>
+		</dict>
+	</dict>
+</dict>
+</plist>
+`, string(actual))
+}
+
+func TestRunPullCommand_JSON(t *testing.T) {
+	setup()
+
+	languagePattern = "locales/([a-z]{2})/"
+
+	afero.WriteFile(fs, path.Join(source, "package.json"), []byte(`{"name": "app"}`), 0644)
+	afero.WriteFile(fs, path.Join(source, "locales", "en", "common.json"), []byte(`{
+    "app": {
+        "title": "Welcome, {{name}}",
+        "menu": {
+            "open": "Open",
+            "close": "Close"
+        }
+    },
+    "files_one": "{{count}} file",
+    "files_other": "{{count}} files",
+    "count": 3,
+    "tags": ["a", {"b": "c"}]
+}
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "locales", "de", "common.json"), []byte(`{
+    "app": {
+        "title": "Willkommen, {{name}}"
+    }
+}
+`), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "de.xliff")
+	jobDocument, _ := readDocument(jobPath)
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	assert.Equal(t, 4, len(transUnits))
+	assert.Equal(t, "Open", transUnits[0].Source.Data)
+	assert.Equal(t, "{{count}} file", transUnits[2].Source.Data)
+
+	var dbTransUnit db.TransUnit
+
+	database.Where("source = ?", "Close").First(&dbTransUnit)
+
+	assert.Equal(t, "app.menu.close", dbTransUnit.Qualifier)
+
+	targets := []string{"Öffnen", "Schließen \"jetzt\"", "{{count}} Datei", "{{count}} Dateien"}
+
+	for i := range transUnits {
+		transUnits[i].Target = xliff.Target{State: "translated", Data: targets[i], Language: "de"}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "locales", "de", "common.json"))
+
+	assert.Equal(t, `{
+    "app": {
+        "title": "Willkommen, {{name}}",
+        "menu": {
+            "open": "Öffnen",
+            "close": "Schließen \"jetzt\""
+        }
+    },
+    "files_one": "{{count}} Datei",
+    "files_other": "{{count}} Dateien"
+}
+`, string(actual))
+}
+
+func TestRunPullCommand_PropertiesAndResx(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "i18n", "messages.properties"), []byte(`# Greeting shown on start
+! Keep it short
+greeting = Hello, \
+    world
+title=Café menu
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "i18n", "messages_en.properties"), []byte("greeting=Hello, world\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "i18n", "messages_fr.properties"), []byte("title=Menu du caf\\u00e9\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "Properties", "Resources.resx"), []byte(`<?xml version="1.0" encoding="utf-8"?>
+<root>
+  <data name="Save" xml:space="preserve">
+    <value>Save &amp; close</value>
+    <comment>Button of the editor</comment>
+  </data>
+  <data name="Logo" type="System.Drawing.Bitmap, System.Drawing" mimetype="application/x-microsoft.net.object.bytearray.base64">
+    <value>AAAA</value>
+  </data>
+  <data name="$this.Text" xml:space="preserve">
+    <value>Editor</value>
+  </data>
+</root>
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "Properties", "Resources.fr.resx"), []byte(`<?xml version="1.0" encoding="utf-8"?>
+<root>
+</root>
+`), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	assert.Equal(t, 2, len(transUnits))
+
+	var dbTransUnit db.TransUnit
+
+	database.Where("source = ?", "Hello, world").First(&dbTransUnit)
+
+	assert.Equal(t, "greeting", dbTransUnit.Qualifier)
+
+	var dbNote db.Note
+
+	database.Where("data = ?", "Button of the editor").First(&dbNote)
+
+	assert.False(t, database.NewRecord(dbNote))
+
+	// Comments are the notes of the key that follows them.
+	for _, transUnit := range transUnits {
+		if transUnit.Source.Data == "Hello, world" {
+			assert.Equal(t, 1, len(transUnit.Notes))
+			assert.Equal(t, "Greeting shown on start\nKeep it short", transUnit.Notes[0].Data)
+		}
+	}
+
+	targets := map[string]string{"Hello, world": "Bonjour, ô monde", "Save & close": "Enregistrer & fermer"}
+
+	for i := range transUnits {
+		transUnits[i].Target = xliff.Target{State: "translated", Data: targets[transUnits[i].Source.Data], Language: "fr"}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "i18n", "messages_fr.properties"))
+
+	assert.Equal(t, "title=Menu du caf\\u00e9\ngreeting=Bonjour, \\u00F4 monde\n", string(actual))
+
+	actual, _ = afero.ReadFile(fs, path.Join(source, "Properties", "Resources.fr.resx"))
+
+	assert.Equal(t, `<?xml version="1.0" encoding="utf-8"?>
+<root>
+  <data name="Save" xml:space="preserve">
+    <value>Enregistrer &amp; fermer</value>
+  </data>
+</root>
+`, string(actual))
+}
+
+func TestRunPullCommand_YAML(t *testing.T) {
+	setup()
+
+	languagePattern = "^$"
+
+	afero.WriteFile(fs, path.Join(source, ".github", "workflows", "build.yml"), []byte("name: build\non: [push]\n"), 0644)
+	// Files of settings named as languages are no locale files, and neither
+	// are files of a language whose source language file is not told.
+	afero.WriteFile(fs, path.Join(source, "ci.yml"), []byte("image: golang\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "config", "db.yml"), []byte("adapter: sqlite3\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "config", "locales", "devise.yml"), []byte("fr:\n  sign_in: Connexion\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "config", "locales", "en.yml"), []byte(`# Strings of the app
+en:
+  defaults: &defaults
+    save: Save
+  # Title of the home page
+  title: "Welcome, %{name}"
+  users:
+    count:
+      one: One user
+      other: "%{count} users"
+  admin:
+    <<: *defaults
+    delete: 'Don''t delete'
+  date:
+    day_names: [Sunday, Monday]
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "config", "locales", "fr.yml"), []byte(`fr:
+  title: ""
+  admin:
+    delete: Ne pas supprimer # reviewed
+  users:
+    count:
+      one: ""
+      many: ""
+      other: ""
+`), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	// The many category of French is kept, as the file has it.
+	assert.Equal(t, 5, len(transUnits))
+	assert.Equal(t, "Welcome, %{name}", transUnits[1].Source.Data)
+	assert.Equal(t, "Title of the home page", transUnits[1].Notes[0].Data)
+
+	var dbTransUnit db.TransUnit
+
+	database.Where("source = ?", "Save").First(&dbTransUnit)
+
+	assert.Equal(t, "defaults.save", dbTransUnit.Qualifier)
+
+	targets := []string{"Enregistrer", "Bienvenue, %{name}", "%{count} utilisateur", "%{count} utilisateurs", "%{count} utilisateurs"}
+
+	for i := range transUnits {
+		transUnits[i].Target = xliff.Target{State: "translated", Data: targets[i], Language: "fr"}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "config", "locales", "fr.yml"))
+
+	assert.Equal(t, `fr:
+  title: "Bienvenue, %{name}"
+  admin:
+    delete: Ne pas supprimer # reviewed
+  users:
+    count:
+      one: "%{count} utilisateur"
+      many: "%{count} utilisateurs"
+      other: "%{count} utilisateurs"
+  defaults:
+    save: Enregistrer
+`, string(actual))
+}
+
+func TestRunPullCommand_ARB(t *testing.T) {
+	setup()
+
+	languagePattern = "^$"
+
+	afero.WriteFile(fs, path.Join(source, "lib", "l10n", "app_en.arb"), []byte(`{
+  "@@locale": "en",
+  "title": "Files",
+  "@title": {
+    "description": "Title of the files page"
+  },
+  "files": "{count, plural, =0{No files} one{One file} other{{count} files}}",
+  "@files": {
+    "placeholders": {
+      "count": {"type": "int"}
+    }
+  },
+  "greeting": "Hello {name}, {gender, select, male{his} female{her} other{their}} files"
+}
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "lib", "l10n", "app_fr.arb"), []byte(`{
+  "@@locale": "fr"
+}
+`), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	assert.Equal(t, 3, len(transUnits))
+
+	var dbNote db.Note
+
+	database.Where("data = ?", "Title of the files page").First(&dbNote)
+
+	assert.False(t, database.NewRecord(dbNote))
+
+	targets := []string{
+		"Fichiers",
+		"{count, plural, =0{Aucun fichier} one{# fichier} other{# fichiers}}",
+		"Bonjour {nom}, {gender, select, male{ses} other{leurs}} fichiers",
+	}
+
+	for i := range transUnits {
+		transUnits[i].Target = xliff.Target{State: "translated", Data: targets[i], Language: "fr"}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "lib", "l10n", "app_fr.arb"))
+
+	assert.Equal(t, `{
+  "@@locale": "fr",
+  "title": "Fichiers",
+  "files": "{count, plural, =0{Aucun fichier} one{# fichier} other{# fichiers}}"
+}
+`, string(actual))
+}
+
+func TestRunPullCommand_Sheets(t *testing.T) {
+	setup()
+
+	jobFiles = []string{"xliff", "csv", "xlsx"}
+
+	afero.WriteFile(fs, path.Join(source, "messages.properties"), []byte("# Button\nsave=Save\nopen=Open\nclose=Close, \"now\"\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "messages_fr.properties"), []byte(""), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobDirectory := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10))
+	data, _ := afero.ReadFile(fs, path.Join(jobDirectory, "fr.csv"))
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(rows))
+	assert.Equal(t, []string{"identifier", "source", "target", "notes", "state"}, rows[0])
+	assert.Equal(t, []string{"Save", "", "Button"}, rows[1][1:4])
+	assert.Equal(t, "Close, \"now\"", rows[3][1])
+
+	data, _ = afero.ReadFile(fs, path.Join(jobDirectory, "fr.xlsx"))
+	sheetRows, err := xlsx.Read(data)
+
+	assert.Nil(t, err)
+	assert.Equal(t, rows[3], sheetRows[3])
+
+	rows[1][2] = "Enregistrer"
+
+	var output bytes.Buffer
+
+	csv.NewWriter(&output).WriteAll(rows)
+	afero.WriteFile(fs, path.Join(jobDirectory, "fr.csv"), output.Bytes(), 0644)
+
+	output.Reset()
+	xlsx.Write(&output, "fr", [][]string{{"Target", "Identifier"}, {"Fermer, \"maintenant\"", rows[3][0]}})
+	afero.WriteFile(fs, path.Join(jobDirectory, "fr.xlsx"), output.Bytes(), 0644)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "messages_fr.properties"))
+
+	assert.Equal(t, "save=Enregistrer\nclose=Fermer, \"maintenant\"\n", string(actual))
+}
+
+func TestRunPullCommand_SheetTargetOnly(t *testing.T) {
+	setup()
+
+	jobFiles = []string{"csv"}
+
+	viper.Set("states.done", []string{"translated"})
+
+	afero.WriteFile(fs, path.Join(source, "messages.properties"), []byte("save=Save\nsum==SUM(A1)\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "messages_fr.properties"), []byte(""), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	sheetPath := path.Join(destination, dbJob.Name, "fr.csv")
+	data, _ := afero.ReadFile(fs, sheetPath)
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+
+	// Units without state have the initial one, and cells a spreadsheet
+	// would take as formulas are quoted.
+	assert.Nil(t, err)
+	assert.Equal(t, "new", rows[1][4])
+	assert.Equal(t, "'=SUM(A1)", rows[2][1])
+
+	// Reviewers fill in only the target column.
+	rows[1][2] = "Enregistrer"
+	rows[2][2] = "'=SOMME(A1)"
+
+	var output bytes.Buffer
+
+	csv.NewWriter(&output).WriteAll(rows)
+	afero.WriteFile(fs, sheetPath, output.Bytes(), 0644)
+
+	assert.Nil(t, runPullCommand(source, destination))
+	assert.False(t, dbJob.Active)
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "messages_fr.properties"))
+
+	assert.Equal(t, "save=Enregistrer\nsum=\\=SOMME(A1)\n", string(actual))
+}
+
+func TestRunPullCommand_SheetCodes(t *testing.T) {
+	setup()
+
+	jobFiles = []string{"csv"}
+
+	writeInlineSourceTestDocument()
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	sheetPath := path.Join(destination, dbJob.Name, "fr.csv")
+	data, _ := afero.ReadFile(fs, sheetPath)
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello <1>world</1><2/>", rows[1][1])
+
+	writeRows := func(target string) {
+		var output bytes.Buffer
+
+		rows[1][2] = target
+		rows[1][4] = "translated"
+
+		csv.NewWriter(&output).WriteAll(rows)
+		afero.WriteFile(fs, sheetPath, output.Bytes(), 0644)
+	}
+
+	// Targets whose tags do not match the codes of the source are left out.
+	for _, target := range []string{"Bonjour <1>monde<1/>", "Bonjour monde<2/>", "<2/>Bonjour <1>monde</1><3/>", "<1>Bonjour <2/>monde"} {
+		writeRows(target)
+
+		assert.Nil(t, runPullCommand(source, destination))
+
+		sourceDocument, _ := readDocument(path.Join(source, "fr.xliff"))
+
+		assert.Equal(t, "", sourceDocument.Files[0].Body.TransUnits[0].Target.Data, target)
+	}
+
+	writeRows("<2/>Bonjour <1>le monde</1>")
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	sourceDocument, _ := readDocument(path.Join(source, "fr.xliff"))
+	target := sourceDocument.Files[0].Body.TransUnits[0].Target
+
+	assert.Equal(t, `<x id="2" ctype="lb"/>Bonjour <g id="1" ctype="bold">le monde</g>`, target.Content.Markup())
+}
+
+func TestRunPullCommand_QtAndFluent(t *testing.T) {
+	setup()
+
+	languagePattern = "^$"
+
+	afero.WriteFile(fs, path.Join(source, "src", "index.ts"), []byte("export const title = 'Files';\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "translations", "app_fr.ts"), []byte(`<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE TS>
+<TS version="2.1" language="fr" sourcelanguage="en">
+<context>
+    <name>MainWindow</name>
+    <message>
+        <location filename="../mainwindow.cpp" line="12"/>
+        <source>Open</source>
+        <extracomment>Menu entry</extracomment>
+        <translation type="unfinished"></translation>
+    </message>
+    <message>
+        <source>Save</source>
+        <translation>Enregistrer</translation>
+    </message>
+    <message numerus="yes">
+        <source>%n file(s)</source>
+        <translation type="unfinished">
+            <numerusform></numerusform>
+            <numerusform></numerusform>
+        </translation>
+    </message>
+    <message>
+        <source>Old</source>
+        <translation type="vanished">Ancien</translation>
+    </message>
+</context>
+</TS>
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "locales", "en", "main.ftl"), []byte(`# Title of the window
+title = Files
+# Login form
+login =
+    .placeholder = Email
+    .title = Log in
+-brand = Delta
+emails = { $count ->
+        [one] One email
+       *[other] { $count } emails
+    }
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "locales", "fr", "main.ftl"), []byte("title = Fichiers\n"), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	assert.Equal(t, 7, len(transUnits))
+
+	for _, note := range []string{"Menu entry", "Login form"} {
+		var dbNote db.Note
+
+		database.Where("data = ?", note).First(&dbNote)
+
+		assert.False(t, database.NewRecord(dbNote))
+	}
+
+	targets := map[string][]string{
+		"Open":       {"Ouvrir"},
+		"%n file(s)": {"%n fichier", "%n fichiers"},
+		"Email":      {"Courriel"},
+		"Log in":     {"Connexion"},
+		"{ $count ->\n    [one] One email\n   *[other] { $count } emails\n}": {"{ $count ->\n    [one] Un courriel\n   *[other] { $count } courriels\n}"},
+	}
+
+	for i := range transUnits {
+		if values := targets[transUnits[i].Source.Data]; len(values) > 0 {
+			transUnits[i].Target = xliff.Target{State: "translated", Data: values[0], Language: "fr"}
+			targets[transUnits[i].Source.Data] = values[1:]
+		}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "translations", "app_fr.ts"))
+
+	assert.Equal(t, `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE TS>
+<TS version="2.1" language="fr" sourcelanguage="en">
+<context>
+    <name>MainWindow</name>
+    <message>
+        <location filename="../mainwindow.cpp" line="12"/>
+        <source>Open</source>
+        <extracomment>Menu entry</extracomment>
+        <translation>Ouvrir</translation>
+    </message>
+    <message>
+        <source>Save</source>
+        <translation>Enregistrer</translation>
+    </message>
+    <message numerus="yes">
+        <source>%n file(s)</source>
+        <translation>
+            <numerusform>%n fichier</numerusform>
+            <numerusform>%n fichiers</numerusform>
+        </translation>
+    </message>
+    <message>
+        <source>Old</source>
+        <translation type="vanished">Ancien</translation>
+    </message>
+</context>
+</TS>
+`, string(actual))
+
+	actual, _ = afero.ReadFile(fs, path.Join(source, "locales", "fr", "main.ftl"))
+
+	assert.Equal(t, `title = Fichiers
+login =
+    .placeholder = Courriel
+    .title = Connexion
+emails = { $count ->
+        [one] Un courriel
+       *[other] { $count } courriels
+    }
+`, string(actual))
+}
+
+func TestRunPullCommand_FluentClosingBrace(t *testing.T) {
+	setup()
+
+	languagePattern = "^$"
+
+	afero.WriteFile(fs, path.Join(source, "locales", "en", "main.ftl"), []byte(`emails = { $count ->
+    [one] One email
+   *[other] { $count } emails
+}
+title = Files
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "locales", "fr", "main.ftl"), []byte("title = Fichiers\n"), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobPath := path.Join(destination, strconv.FormatUint(uint64(dbJob.ID), 10), "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	// The message after the closing brace is read, and not left as junk.
+	assert.Equal(t, 1, len(transUnits))
+	assert.Equal(t, "{ $count ->\n [one] One email\n*[other] { $count } emails\n}", transUnits[0].Source.Data)
+
+	transUnits[0].Target = xliff.Target{State: "translated", Data: "{ $count ->\n [one] Un courriel\n*[other] { $count } courriels\n}", Language: "fr"}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "locales", "fr", "main.ftl"))
+
+	assert.Equal(t, `title = Fichiers
+emails = { $count ->
+     [one] Un courriel
+    *[other] { $count } courriels
+    }
+`, string(actual))
+
+	// The file written reads back with the message translated.
+	assert.Nil(t, runPushCommand(source, destination))
+	assert.Equal(t, pushReport{}, pushed)
+}
+
+func TestRunPushCommand_FileRules(t *testing.T) {
+	setup()
+
+	viper.Set("files.rules", []map[string]interface{}{
+		{"path": "app/**/*.txt", "format": "po", "pattern": "/([a-z]{2})\\.txt$", "language": "en-US"},
+		{"path": "legacy/*", "pattern": "strings_([a-z]{2})$"},
+	})
+	viper.Set("files.exclude", []string{"node_modules/**"})
+
+	afero.WriteFile(fs, path.Join(source, "app", "main", "fr.txt"), []byte(`msgid ""
+msgstr ""
+"Language: fr\n"
+
+msgid "Open"
+msgstr ""
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "legacy", "strings_fr"), []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2">
+  <file original="strings" source-language="en" target-language="fr" datatype="plaintext">
+    <body>
+      <trans-unit id="close">
+        <source>Close</source>
+      </trans-unit>
+    </body>
+  </file>
+</xliff>
+`), 0644)
+	afero.WriteFile(fs, path.Join(source, "node_modules", "pkg", "fr.xliff"), []byte("<xliff"), 0644)
+	afero.WriteFile(fs, path.Join(source, "docs", "notes.md"), []byte("# Notes\n"), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	var dbFiles []db.File
+
+	database.Order("path").Find(&dbFiles)
+
+	assert.Equal(t, 2, len(dbFiles))
+	assert.Equal(t, path.Join(source, "app", "main", "fr.txt"), dbFiles[0].Path)
+	assert.Equal(t, path.Join(source, "legacy", "strings_fr"), dbFiles[1].Path)
+
+	var dbTransUnit db.TransUnit
+
+	database.Where("source = ?", "Open").First(&dbTransUnit)
+
+	assert.Equal(t, "en-US", dbTransUnit.SourceLanguage)
+	assert.Equal(t, "fr", dbTransUnit.TargetLanguage)
+
+	setup()
+
+	viper.Set("files.rules", []map[string]interface{}{{"path": "*.txt", "format": "text"}})
+
+	assert.EqualError(t, runPushCommand(source, destination), "unknown format text of files *.txt")
+}
+
+func TestRunPullCommand_NamedJobs(t *testing.T) {
+	setup()
+
+	writeSourceTestDocument(xliff.TransUnit{
+		ID:      "679fc2df14fb48f39718a0c20392d259",
+		Resname: "label.test",
+		Source:  xliff.Source{Data: "test", Language: "en"},
+		Target:  xliff.Target{State: "new", Language: "fr"},
+	})
+
+	jobName = "a/b"
+
+	assert.EqualError(t, runPushCommand(source, destination), "invalid job name a/b")
+
+	jobName = "7"
+
+	assert.EqualError(t, runPushCommand(source, destination), "invalid job name 7, numbers name the jobs without a name")
+
+	jobName = "release-1"
+
+	assert.Nil(t, runPushCommand(source, destination))
+	assert.Error(t, runPushCommand(source, destination))
+
+	// Units in flight in release-1 are left out of area-b.
+	writeSourceTestDocument(xliff.TransUnit{
+		ID:      "679fc2df14fb48f39718a0c20392d259",
+		Resname: "label.test",
+		Source:  xliff.Source{Data: "test", Language: "en"},
+		Target:  xliff.Target{State: "new", Language: "de"},
+	})
+
+	jobName = "area-b"
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	releasePath := path.Join(destination, "release-1", "fr.xliff")
+	jobDocument, err := readDocument(releasePath)
+
+	assert.Nil(t, err)
+
+	_, err = readDocument(path.Join(destination, "area-b", "de.xliff"))
+
+	assert.Nil(t, err)
+
+	exists, _ := afero.Exists(fs, path.Join(destination, "area-b", "fr.xliff"))
+
+	assert.False(t, exists)
+
+	jobName = ""
+
+	assert.EqualError(t, runPullCommand(source, destination), "several jobs are active, choose one of release-1, area-b with --job")
+
+	jobDocument.Files[0].Body.TransUnits[0].Target = xliff.Target{State: "translated", Data: "essai", Language: "fr"}
+	writeDocument(jobDocument, releasePath)
+
+	jobName = "release-1"
+
+	assert.Nil(t, runPullCommand(source, destination))
+	assert.EqualError(t, runPullCommand(source, destination), "active job release-1 does not exist")
+
+	sourceDocument, _ := readDocument(path.Join(source, "fr.xliff"))
+
+	assert.Equal(t, "essai", sourceDocument.Files[0].Body.TransUnits[0].Target.Data)
+
+	jobName = ""
+
+	assert.Nil(t, runPullCommand(source, destination))
+	assert.Equal(t, "area-b", dbJob.Name)
+
+	// Names of ended jobs, and of folders in the destination, are not reused.
+	jobName = "release-1"
+
+	err = runPushCommand(source, destination)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "job release-1 exists created at")
+
+	fs.MkdirAll(path.Join(destination, "release-2"), 0755)
+
+	jobName = "release-2"
+
+	assert.EqualError(t, runPushCommand(source, destination), "folder of job release-2 exists in "+destination)
+}
+
+func TestRunPullCommand_JobWithoutName(t *testing.T) {
+	setup()
+
+	directory, err := ioutil.TempDir("", "delta")
+
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(directory)
+
+	databasePath := path.Join(directory, "delta.db")
+	database, err = openDatabase("sqlite3", databasePath)
+
+	assert.Nil(t, err)
+
+	writeSourceTestDocument(xliff.TransUnit{
+		ID:      "679fc2df14fb48f39718a0c20392d259",
+		Resname: "label.test",
+		Source:  xliff.Source{Data: "test", Language: "en"},
+		Target:  xliff.Target{State: "new", Language: "fr"},
+	})
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	writeDestinationTestDocument(xliff.Target{State: "translated", Data: "essai", Language: "fr"})
+
+	// Jobs created before jobs had names have an empty name, and their
+	// folder is named by their ID.
+	id := strconv.FormatUint(uint64(dbJob.ID), 10)
+
+	database.Model(&dbJob).UpdateColumn("name", "")
+
+	// Jobs that ended before jobs had statuses have none.
+	ended := db.Job{Name: "ended"}
+	database.Create(&ended)
+	database.Model(&ended).UpdateColumn("active", false)
+
+	database.Close()
+
+	database, err = openDatabase("sqlite3", databasePath)
+
+	assert.Nil(t, err)
+
+	defer database.Close()
+
+	var output bytes.Buffer
+
+	statusOutput = "json"
+
+	assert.Nil(t, runStatusCommand(&output))
+
+	var statuses []jobStatus
+
+	assert.Nil(t, json.Unmarshal(output.Bytes(), &statuses))
+	assert.Equal(t, 1, len(statuses))
+	assert.Equal(t, id, statuses[0].Name)
+
+	database.First(&ended, ended.ID)
+
+	assert.Equal(t, db.JobPulled, ended.State())
+
+	assert.Nil(t, runPullCommand(source, destination))
+	assert.Equal(t, id, dbJob.Name)
+
+	sourceDocument, _ := readDocument(path.Join(source, "fr.xliff"))
+
+	assert.Equal(t, "essai", sourceDocument.Files[0].Body.TransUnits[0].Target.Data)
+}
+
+func TestRunStatusCommand(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "messages.properties"), []byte("save=Save file\nopen=Open\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "messages_fr.properties"), []byte(""), 0644)
+	afero.WriteFile(fs, path.Join(source, "messages_de.properties"), []byte("open=\u00d6ffnen\n"), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	var dbTransUnit db.TransUnit
+
+	pulledAt := time.Now()
+
+	database.Where("target_language = ? and qualifier = ?", "fr", "open").First(&dbTransUnit)
+	dbTransUnit.Target = "Ouvrir"
+	dbTransUnit.State = "translated"
+	dbTransUnit.PulledAt = &pulledAt
+	database.Save(&dbTransUnit)
+
+	// A target that was not pulled is not counted.
+	dbTransUnit = db.TransUnit{}
+	database.Where("target_language = ? and qualifier = ?", "fr", "save").First(&dbTransUnit)
+	dbTransUnit.Target = "Enregistrer"
+	dbTransUnit.State = "needs-review-translation"
+	database.Save(&dbTransUnit)
+
+	statusOutput = "json"
+
+	var output bytes.Buffer
+
+	assert.Nil(t, runStatusCommand(&output))
+
+	var statuses []jobStatus
+
+	assert.Nil(t, json.Unmarshal(output.Bytes(), &statuses))
+	assert.Equal(t, 1, len(statuses))
+	assert.Equal(t, dbJob.Name, statuses[0].Name)
+	assert.Equal(t, []languageStatus{
+		{Language: "de", Files: 1, Units: 1, Words: 2, Targets: 0, States: map[string]int{}},
+		{Language: "fr", Files: 1, Units: 2, Words: 3, Targets: 1, States: map[string]int{"translated": 1}},
+	}, statuses[0].Languages)
+
+	statusOutput = "table"
+	output.Reset()
+
+	assert.Nil(t, runStatusCommand(&output))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, []string{"JOB", "AGE", "LANGUAGE", "FILES", "UNITS", "WORDS", "TARGETS", "STATES"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{dbJob.Name, "0m", "fr", "1", "2", "3", "1", "translated:", "1"}, strings.Fields(lines[2]))
+}
+
+func TestRunJobsCommands(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "messages.properties"), []byte("save=Save\nopen=Open\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "messages_fr.properties"), []byte(""), 0644)
+
+	jobName = "release-1"
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	// Units in flight in release-1 are left out of area-b.
+	afero.WriteFile(fs, path.Join(source, "messages_de.properties"), []byte(""), 0644)
+
+	jobName = "area-b"
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	jobName = ""
+
+	assert.Nil(t, runJobsCloseCommand("release-1"))
+	assert.Nil(t, runJobsCancelCommand("area-b"))
+	assert.EqualError(t, runJobsCloseCommand("release-1"), "active job release-1 does not exist")
+	assert.EqualError(t, runJobsShowCommand(&bytes.Buffer{}, "release-2"), "job release-2 does not exist")
+
+	var output bytes.Buffer
+
+	assert.Nil(t, runJobsListCommand(&output))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, []string{"release-1", "closed"}, strings.Fields(lines[1])[:2])
+	assert.Equal(t, []string{"area-b", "canceled"}, strings.Fields(lines[2])[:2])
+
+	jobsOutput = "json"
+	output.Reset()
+
+	assert.Nil(t, runJobsShowCommand(&output, "release-1"))
+
+	var detail jobDetail
+
+	assert.Nil(t, json.Unmarshal(output.Bytes(), &detail))
+	assert.Equal(t, "closed", detail.Status)
+	assert.NotNil(t, detail.Closed)
+	assert.Equal(t, 1, len(detail.Files))
+	assert.Equal(t, path.Join(source, "messages_fr.properties"), detail.Files[0].Path)
+	assert.Equal(t, []string{"save", "open"}, []string{detail.Files[0].Units[0].Qualifier, detail.Files[0].Units[1].Qualifier})
+	assert.Equal(t, "Open", detail.Files[0].Units[1].Source)
+}
+
+func TestRunPullCommand_Partial(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "messages.properties"), []byte("save=Save\nopen=Open\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "messages_fr.properties"), []byte(""), 0644)
+	afero.WriteFile(fs, path.Join(source, "messages_de.properties"), []byte(""), 0644)
+
+	assert.Nil(t, runPushCommand(source, destination))
+
+	now := time.Now()
+
+	translate := func(language string, state string, written time.Time, targets ...string) {
+		jobPath := path.Join(destination, dbJob.Name, language+".xliff")
+		jobDocument, _ := readDocument(jobPath)
+		transUnits := jobDocument.Files[0].Body.TransUnits
+
+		for i := range transUnits {
+			transUnits[i].Target = xliff.Target{State: state, Data: targets[i], Language: language}
+		}
+
+		writeDocument(jobDocument, jobPath)
+		fs.Chtimes(jobPath, written, written)
+	}
+
+	translate("fr", "translated", now.Add(-3*time.Hour), "Enregistrer", "Ouvrir")
+	translate("de", "translated", now.Add(-3*time.Hour), "Speichern", "\u00d6ffnen")
+
+	pullLanguages = []string{"fr"}
+
+	assert.Nil(t, runPullCommand(source, destination))
+	assert.True(t, dbJob.Active)
+
+	frenchPath := path.Join(source, "messages_fr.properties")
+	actual, _ := afero.ReadFile(fs, frenchPath)
+
+	assert.Equal(t, "save=Enregistrer\nopen=Ouvrir\n", string(actual))
+
+	actual, _ = afero.ReadFile(fs, path.Join(source, "messages_de.properties"))
+
+	assert.Equal(t, "", string(actual))
+
+	// A target edited in the source file after the pull is kept when the
+	// job file is pulled again.
+	afero.WriteFile(fs, frenchPath, []byte("save=Sauvegarder\nopen=Ouvrir\n"), 0644)
+	fs.Chtimes(frenchPath, now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+
+	translate("de", "needs-review-translation", now.Add(-3*time.Hour), "Speichern", "\u00d6ffnen")
+
+	pullLanguages = nil
+
+	assert.Nil(t, runPullCommand(source, destination))
+	assert.True(t, dbJob.Active)
+
+	actual, _ = afero.ReadFile(fs, frenchPath)
+
+	assert.Equal(t, "save=Sauvegarder\nopen=Ouvrir\n", string(actual))
+
+	actual, _ = afero.ReadFile(fs, path.Join(source, "messages_de.properties"))
+
+	assert.Equal(t, "save=Speichern\nopen=\\u00D6ffnen\n", string(actual))
+
+	// A newer job file replaces it, and an older one is not pulled over it.
+	translate("fr", "translated", now.Add(-time.Hour), "Enregistrer sous", "Ouvrir")
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ = afero.ReadFile(fs, frenchPath)
+
+	assert.Equal(t, "save=Enregistrer sous\nopen=Ouvrir\n", string(actual))
+
+	translate("fr", "translated", now.Add(-4*time.Hour), "Enregistrer", "Ouvrir")
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ = afero.ReadFile(fs, frenchPath)
+
+	assert.Equal(t, "save=Enregistrer sous\nopen=Ouvrir\n", string(actual))
+
+	closeJob = true
+
+	assert.Nil(t, runPullCommand(source, destination))
+	assert.False(t, dbJob.Active)
+	assert.Equal(t, db.JobPulled, dbJob.Status)
+}
+
+func TestRunPushCommand_Incremental(t *testing.T) {
+	setup()
+
+	afero.WriteFile(fs, path.Join(source, "messages.properties"), []byte("save=Save\nopen=Open\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "messages_fr.properties"), []byte(""), 0644)
+
+	jobName = "v1"
+
+	assert.Nil(t, runPushCommand(source, destination))
+	assert.Equal(t, pushReport{New: 2}, pushed)
+
+	jobPath := path.Join(destination, "v1", "fr.xliff")
+	jobDocument, _ := readDocument(jobPath)
+	transUnits := jobDocument.Files[0].Body.TransUnits
+
+	transUnits[0].Target = xliff.Target{State: "translated", Data: "Enregistrer", Language: "fr"}
+	transUnits[1].Target = xliff.Target{State: "translated", Data: "Ouvrir", Language: "fr"}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+	assert.False(t, dbJob.Active)
+
+	// The same unit in another file is not the one of messages.properties.
+	afero.WriteFile(fs, path.Join(source, "messages.properties"), []byte("save=Save\nopen=Open file\nclose=Close\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "messages_fr.properties"), []byte(""), 0644)
+	afero.WriteFile(fs, path.Join(source, "other.properties"), []byte("save=Save\n"), 0644)
+	afero.WriteFile(fs, path.Join(source, "other_fr.properties"), []byte(""), 0644)
+
+	jobName = "v2"
+
+	assert.Nil(t, runPushCommand(source, destination))
+	assert.Equal(t, pushReport{New: 2, Changed: 1, Reused: 1}, pushed)
+
+	jobDocument, _ = readDocument(path.Join(destination, "v2", "fr.xliff"))
+
+	assert.Equal(t, 3, len(jobDocument.Files[0].Body.TransUnits))
+
+	// A job that sends no units writes the reused targets at once and ends.
+	jobName = "v3"
+
+	assert.Nil(t, runPushCommand(source, destination))
+	assert.Equal(t, pushReport{Reused: 1, InFlight: 3}, pushed)
+	assert.Equal(t, db.JobPulled, dbJob.Status)
+
+	actual, _ := afero.ReadFile(fs, path.Join(source, "messages_fr.properties"))
+
+	assert.Equal(t, "save=Enregistrer\n", string(actual))
+
+	exists, _ := afero.Exists(fs, path.Join(destination, "v3"))
+
+	assert.False(t, exists)
+
+	// No job is created when every unit is in flight.
+	jobName = "v3-again"
+
+	assert.Nil(t, runPushCommand(source, destination))
+	assert.Equal(t, pushReport{InFlight: 3}, pushed)
+
+	var count int
+
+	database.Model(&db.Job{}).Where("name = ?", "v3-again").Count(&count)
+
+	assert.Equal(t, 0, count)
+
+	jobName = ""
+
+	_, err := activeJob("")
+
+	assert.Nil(t, err)
+
+	// Units of canceled jobs are neither in flight nor reused.
+	assert.Nil(t, runJobsCancelCommand("v2"))
+
+	database.Model(&db.TransUnit{}).Where("target = ?", "Enregistrer").Update("pulled_at", nil)
+	database.Model(&db.Job{}).Where("name = ?", "v1").Update("status", db.JobClosed)
+
+	jobName = "v4"
+
+	assert.Nil(t, runPushCommand(source, destination))
+	assert.Equal(t, pushReport{Resent: 3}, pushed)
+
+	jobPath = path.Join(destination, "v4", "fr.xliff")
+	jobDocument, _ = readDocument(jobPath)
+	transUnits = jobDocument.Files[0].Body.TransUnits
+
+	assert.Equal(t, 3, len(transUnits))
+
+	for i := range transUnits {
+		transUnits[i].Target = xliff.Target{State: "translated", Data: "Enregistrer", Language: "fr"}
+	}
+
+	writeDocument(jobDocument, jobPath)
+
+	assert.Nil(t, runPullCommand(source, destination))
+
+	actual, _ = afero.ReadFile(fs, path.Join(source, "other_fr.properties"))
+
+	assert.Equal(t, "save=Enregistrer\n", string(actual))
+}
@@ -0,0 +1,242 @@
+package commands
+
+import (
+	"errors"
+	"github.com/dragosv/delta/format"
+	"github.com/spf13/viper"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// fileRule is a rule of the files configuration. Files whose path in the
+// source directory matches the Path glob are of Format, have their
+// language told by Pattern, whose last group is the language, and have
+// their sources in Language. Empty fields fall back to the format,
+// pattern and language flags.
+type fileRule struct {
+	Path     string
+	Format   string
+	Pattern  string
+	Language string
+
+	patternRegexp *regexp.Regexp
+}
+
+var fileRules []fileRule
+
+// Formats of the files whose path tells no format, detected by their
+// content, by path.
+var detectedFormats map[string]format.Format
+
+// Length of the start of a file read to detect its format.
+const sniffLength = 4096
+
+// loadFileRules reads the rules, include and exclude globs of the files
+// configuration. Returns an error if they, or the format flag, name unknown
+// formats or have malformed globs or patterns.
+func loadFileRules() error {
+	if sourceFormat != "" && format.Get(sourceFormat) == nil {
+		return errors.New("unknown format " + sourceFormat)
+	}
+
+	fileRules = nil
+	detectedFormats = make(map[string]format.Format)
+
+	if err := viper.UnmarshalKey("files.rules", &fileRules); err != nil {
+		return errors.New("failed to read files configuration " + err.Error())
+	}
+
+	globs := append(viper.GetStringSlice("files.include"), viper.GetStringSlice("files.exclude")...)
+
+	for i := range fileRules {
+		rule := &fileRules[i]
+
+		if rule.Path == "" {
+			return errors.New("files rule has no path")
+		}
+
+		if rule.Format != "" && format.Get(rule.Format) == nil {
+			return errors.New("unknown format " + rule.Format + " of files " + rule.Path)
+		}
+
+		if rule.Pattern != "" {
+			var err error
+
+			rule.patternRegexp, err = regexp.Compile(rule.Pattern)
+
+			if err != nil {
+				return errors.New("malformed pattern of files " + rule.Path + " " + err.Error())
+			}
+		}
+
+		globs = append(globs, rule.Path)
+	}
+
+	for _, glob := range globs {
+		for _, segment := range strings.Split(glob, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return errors.New("malformed glob " + glob)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sourceRelative returns the path of the file at filePath in the source
+// directory, with slashes.
+func sourceRelative(filePath string) string {
+	relative, err := filepath.Rel(source, filePath)
+
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+
+	return filepath.ToSlash(relative)
+}
+
+// matchGlob returns true if name, a path with slashes, matches glob, in
+// which ** matches any number of folders. A glob without a slash matches
+// the base name of files in any folder.
+func matchGlob(glob string, name string) bool {
+	if !strings.Contains(glob, "/") {
+		glob = "**/" + glob
+	}
+
+	return matchSegments(strings.Split(glob, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(glob []string, name []string) bool {
+	if len(glob) == 0 {
+		return len(name) == 0
+	}
+
+	if glob[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(glob[1:], name[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	matched, _ := path.Match(glob[0], name[0])
+
+	return matched && matchSegments(glob[1:], name[1:])
+}
+
+// ruleOf returns the first rule of the files at filePath, or nil.
+func ruleOf(filePath string) *fileRule {
+	name := sourceRelative(filePath)
+
+	for i := range fileRules {
+		if matchGlob(fileRules[i].Path, name) {
+			return &fileRules[i]
+		}
+	}
+
+	return nil
+}
+
+// isIncluded returns true if the file at filePath matches an include glob,
+// if there are any, and no exclude glob. Folders are only excluded.
+func isIncluded(filePath string, folder bool) bool {
+	name := sourceRelative(filePath)
+
+	for _, glob := range viper.GetStringSlice("files.exclude") {
+		if matchGlob(glob, name) {
+			return false
+		}
+	}
+
+	includes := viper.GetStringSlice("files.include")
+
+	if folder || len(includes) == 0 {
+		return true
+	}
+
+	for _, glob := range includes {
+		if matchGlob(glob, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sourceLanguageOf returns the source language of the file at filePath.
+func sourceLanguageOf(filePath string) string {
+	if rule := ruleOf(filePath); rule != nil && rule.Language != "" {
+		return rule.Language
+	}
+
+	return sourceLanguage
+}
+
+// languagePatternOf returns the language pattern of the file at filePath.
+func languagePatternOf(filePath string) *regexp.Regexp {
+	if rule := ruleOf(filePath); rule != nil && rule.patternRegexp != nil {
+		return rule.patternRegexp
+	}
+
+	return patternRegexp
+}
+
+// formatOf returns the format of the source file at path: the one of its
+// rule, the one given by the format flag, the one of its extension, or else
+// the one told by its content.
+func formatOf(filePath string) format.Format {
+	if rule := ruleOf(filePath); rule != nil && rule.Format != "" {
+		return format.Get(rule.Format)
+	}
+
+	if sourceFormat != "" {
+		return format.Get(sourceFormat)
+	}
+
+	if f := format.ForPath(filePath); f != nil {
+		return f
+	}
+
+	return detectFormat(filePath)
+}
+
+// detectFormat returns the format told by the start of the file at
+// filePath, or nil.
+func detectFormat(filePath string) format.Format {
+	if detectedFormats == nil {
+		detectedFormats = make(map[string]format.Format)
+	}
+
+	if f, ok := detectedFormats[filePath]; ok {
+		return f
+	}
+
+	input, err := fs.Open(filePath)
+
+	if err != nil {
+		return nil
+	}
+
+	defer input.Close()
+
+	data := make([]byte, sniffLength)
+	count, err := io.ReadFull(input, data)
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil
+	}
+
+	f := format.Detect(data[:count])
+	detectedFormats[filePath] = f
+
+	return f
+}
@@ -0,0 +1,336 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dragosv/delta/db"
+	"github.com/dragosv/delta/job"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var jobsOutput string
+
+var jobsCommand = &cobra.Command{
+	Use:   "jobs",
+	Short: "Jobs command Delta",
+	Long:  `Jobs command Delta. Lists, shows, cancels and closes jobs.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		fs = afero.NewOsFs()
+
+		var err error
+
+		database, err = openDatabase(databaseDialect, databaseConnection)
+		if err != nil {
+			return errors.New("failed to connect database " + err.Error())
+		}
+
+		return nil
+	},
+}
+
+var jobsListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "List all jobs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runJobsListCommand(os.Stdout)
+	},
+}
+
+var jobsShowCommand = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the files and units of a job",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runJobsShowCommand(os.Stdout, jobArgument(args))
+	},
+}
+
+var jobsCancelCommand = &cobra.Command{
+	Use:   "cancel [name]",
+	Short: "Cancel an active job, telling its plugin",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runJobsCancelCommand(jobArgument(args))
+	},
+}
+
+var jobsCloseCommand = &cobra.Command{
+	Use:   "close [name]",
+	Short: "Close an active job without pulling it",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runJobsCloseCommand(jobArgument(args))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(jobsCommand)
+
+	jobsCommand.AddCommand(jobsListCommand)
+	jobsCommand.AddCommand(jobsShowCommand)
+	jobsCommand.AddCommand(jobsCancelCommand)
+	jobsCommand.AddCommand(jobsCloseCommand)
+
+	jobsCommand.PersistentFlags().StringVarP(&jobsOutput, "output", "o", "table", "Output format: table or json")
+}
+
+// jobArgument returns the name of the job given as argument, or else by the
+// job flag.
+func jobArgument(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+
+	return jobName
+}
+
+// jobSummary is a job as listed.
+type jobSummary struct {
+	Name    string     `json:"name"`
+	Status  string     `json:"status"`
+	Created time.Time  `json:"created"`
+	Closed  *time.Time `json:"closed,omitempty"`
+	Files   int        `json:"files"`
+	Units   int        `json:"units"`
+}
+
+// jobDetail is a job as shown, with its files rather than their number.
+type jobDetail struct {
+	jobSummary
+	Files []fileDetail `json:"files"`
+}
+
+// fileDetail is a file of a job, with its units.
+type fileDetail struct {
+	Path     string       `json:"path"`
+	Language string       `json:"language"`
+	Units    []unitDetail `json:"units"`
+}
+
+// unitDetail is a unit of a file of a job.
+type unitDetail struct {
+	Identifier string `json:"identifier"`
+	GroupPath  string `json:"groupPath,omitempty"`
+	Qualifier  string `json:"qualifier"`
+	State      string `json:"state"`
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+}
+
+// checkJobsOutput returns an error if the output flag names an unknown
+// output.
+func checkJobsOutput() error {
+	if jobsOutput != "table" && jobsOutput != "json" {
+		return errors.New("unknown output " + jobsOutput)
+	}
+
+	return nil
+}
+
+// summaryOf returns the summary of dbJob.
+func summaryOf(dbJob db.Job) jobSummary {
+	summary := jobSummary{
+		Name:    dbJob.Name,
+		Status:  dbJob.State(),
+		Created: dbJob.CreatedAt,
+		Closed:  dbJob.ClosedAt,
+	}
+
+	database.Model(&db.File{}).Where("job_id = ?", dbJob.ID).Count(&summary.Files)
+	database.Model(&db.TransUnit{}).
+		Joins("join files on files.id = trans_units.file_id").
+		Where("files.job_id = ? and files.deleted_at is null", dbJob.ID).
+		Count(&summary.Units)
+
+	return summary
+}
+
+func runJobsListCommand(output io.Writer) error {
+	if err := checkJobsOutput(); err != nil {
+		return err
+	}
+
+	var dbJobs []db.Job
+
+	database.Order("id").Find(&dbJobs)
+
+	summaries := make([]jobSummary, 0, len(dbJobs))
+
+	for _, dbJob := range dbJobs {
+		summaries = append(summaries, summaryOf(dbJob))
+	}
+
+	if jobsOutput == "json" {
+		return writeJSON(output, summaries)
+	}
+
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+
+	io.WriteString(writer, "NAME\tSTATUS\tCREATED\tCLOSED\tFILES\tUNITS\n")
+
+	for _, summary := range summaries {
+		closed := ""
+		if summary.Closed != nil {
+			closed = formatTime(*summary.Closed)
+		}
+
+		io.WriteString(writer, strings.Join([]string{
+			summary.Name,
+			summary.Status,
+			formatTime(summary.Created),
+			closed,
+			strconv.Itoa(summary.Files),
+			strconv.Itoa(summary.Units),
+		}, "\t")+"\n")
+	}
+
+	return writer.Flush()
+}
+
+func runJobsShowCommand(output io.Writer, name string) error {
+	if err := checkJobsOutput(); err != nil {
+		return err
+	}
+
+	dbJob, err := namedJob(name)
+
+	if err != nil {
+		return err
+	}
+
+	detail := jobDetail{jobSummary: summaryOf(dbJob), Files: []fileDetail{}}
+
+	var dbFiles []db.File
+
+	database.Where("job_id = ?", dbJob.ID).Order("path").Find(&dbFiles)
+
+	for _, dbFile := range dbFiles {
+		file := fileDetail{Path: dbFile.Path, Language: dbFile.Language, Units: []unitDetail{}}
+
+		var dbTransUnits []db.TransUnit
+
+		database.Where("file_id = ?", dbFile.ID).Order("id").Find(&dbTransUnits)
+
+		for _, dbTransUnit := range dbTransUnits {
+			file.Units = append(file.Units, unitDetail{
+				Identifier: dbTransUnit.Identifier,
+				GroupPath:  dbTransUnit.GroupPath,
+				Qualifier:  dbTransUnit.Qualifier,
+				State:      dbTransUnit.State,
+				Source:     dbTransUnit.Source,
+				Target:     dbTransUnit.Target,
+			})
+		}
+
+		detail.Files = append(detail.Files, file)
+	}
+
+	if jobsOutput == "json" {
+		return writeJSON(output, detail)
+	}
+
+	io.WriteString(output, "Job "+detail.Name+", "+detail.Status+", created "+formatTime(detail.Created)+"\n\n")
+
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+
+	io.WriteString(writer, "FILE\tLANGUAGE\tQUALIFIER\tSTATE\tSOURCE\tTARGET\n")
+
+	for _, file := range detail.Files {
+		for _, unit := range file.Units {
+			qualifier := unit.Qualifier
+			if unit.GroupPath != "" {
+				qualifier = unit.GroupPath + "/" + qualifier
+			}
+
+			io.WriteString(writer, strings.Join([]string{
+				file.Path,
+				file.Language,
+				tableCell(qualifier),
+				unit.State,
+				tableCell(unit.Source),
+				tableCell(unit.Target),
+			}, "\t")+"\n")
+		}
+	}
+
+	return writer.Flush()
+}
+
+func runJobsCancelCommand(name string) error {
+	dbJob, err := activeJob(name)
+
+	if err != nil {
+		return err
+	}
+
+	if plugin != "" {
+		pluginJob, err := getJob()
+
+		if err != nil {
+			return errors.New("failed to get job plugin " + err.Error())
+		}
+
+		if canceler, ok := pluginJob.(job.Canceler); ok {
+			if err := canceler.Cancel(config, path.Join(destination, dbJob.Name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return db.EndJob(database, &dbJob, db.JobCanceled)
+}
+
+func runJobsCloseCommand(name string) error {
+	dbJob, err := activeJob(name)
+
+	if err != nil {
+		return err
+	}
+
+	return db.EndJob(database, &dbJob, db.JobClosed)
+}
+
+// namedJob returns the last job of the given name, or the only active job
+// if name is empty.
+func namedJob(name string) (db.Job, error) {
+	if name == "" {
+		return activeJob(name)
+	}
+
+	var dbJob db.Job
+
+	database.Where("name = ?", name).Order("id desc").First(&dbJob)
+
+	if database.NewRecord(dbJob) {
+		return dbJob, errors.New("job " + name + " does not exist")
+	}
+
+	return dbJob, nil
+}
+
+// writeJSON writes v to output as indented JSON.
+func writeJSON(output io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
+
+// formatTime returns t as printed in tables.
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// tableCell returns text on a line, as a cell of a table.
+func tableCell(text string) string {
+	return strings.NewReplacer("\t", "\\t", "\r", "\\r", "\n", "\\n").Replace(text)
+}
@@ -3,16 +3,24 @@ package commands
 import (
 	"errors"
 	"github.com/dragosv/delta/db"
+	"github.com/dragosv/delta/format"
 	"github.com/dragosv/delta/xliff"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"io"
 	"os"
 	"path"
+	"regexp"
+	"sort"
 	"strconv"
+	"time"
 )
 
-var destinationDocumentMap map[string]xliff.Document
+var destinationPaths []string
+var pullLanguages []string
+var closeJob bool
 
 var pullCommand = &cobra.Command{
 	Use:   "pull",
@@ -34,18 +42,42 @@ var pullCommand = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(pullCommand)
+
+	pullCommand.Flags().StringSliceVarP(&pullLanguages, "target-language", "", nil, "Target language to pull, repeated for several, all if not given")
+	pullCommand.Flags().BoolVarP(&closeJob, "close", "", false, "Close the job even if some of its units are not complete")
+
+	viper.BindPFlag("pull.languages", pullCommand.Flags().Lookup("target-language"))
+	viper.BindPFlag("close", pullCommand.Flags().Lookup("close"))
 }
 
 func runPullCommand(source string, destination string) error {
 	jww.FEEDBACK.Println("Running pull")
 
-	database.Where("active = ?", true).First(&dbJob)
+	var err error
+
+	dbJob, err = activeJob(jobName)
+
+	if err != nil {
+		return err
+	}
+
+	err = loadFileRules()
+
+	if err != nil {
+		return err
+	}
+
+	policy, err = statePolicy()
 
-	if !database.NewRecord(dbJob.ID) {
-		return errors.New("active job does not exists")
+	if err != nil {
+		return err
 	}
 
-	jobID := strconv.FormatUint(uint64(dbJob.ID), 10)
+	patternRegexp, err = regexp.Compile(languagePattern)
+
+	if err != nil {
+		return err
+	}
 
 	if plugin != "" {
 		job, error := getJob()
@@ -54,153 +86,371 @@ func runPullCommand(source string, destination string) error {
 			return errors.New("failed to get job plugin " + error.Error())
 		}
 
-		pullErr := job.Pull(config, path.Join(destination, jobID))
+		pullErr := job.Pull(config, path.Join(destination, dbJob.Name))
 
 		if pullErr != nil {
 			return pullErr
 		}
 	}
 
-	destinationDocumentMap = make(map[string]xliff.Document)
+	destinationPaths = nil
 
-	afero.Walk(fs, path.Join(destination, jobID), pullWalkFunc)
+	afero.Walk(fs, path.Join(destination, dbJob.Name), pullWalkFunc)
 
-	for path, document := range destinationDocumentMap {
-		err := processDestinationDocument(path, document)
+	// Sheets are read after XLIFF files, so that the targets of reviewers
+	// are kept.
+	sort.SliceStable(destinationPaths, func(i, j int) bool {
+		return !isSheet(destinationPaths[i]) && isSheet(destinationPaths[j])
+	})
+
+	for _, destinationPath := range destinationPaths {
+		err := processDestinationDocument(destinationPath)
 
 		if err != nil {
 			return err
 		}
 	}
 
-	sourceDocumentMap = make(map[string]xliff.Document)
+	sourcePaths = nil
 
 	afero.Walk(fs, source, sourceWalkFunc)
 
-	for path, document := range sourceDocumentMap {
-		processErr := writeSourceDocument(path, document)
+	for _, sourcePath := range sourcePaths {
+		processErr := writeSourceDocument(sourcePath)
 
 		if processErr != nil {
 			return processErr
 		}
 	}
 
-	dbJob.Active = false
+	if count := incompleteCount(); count > 0 && !closeJob {
+		jww.FEEDBACK.Println("Job " + dbJob.Name + " is kept open, " + strconv.Itoa(count) + " units are not complete")
+		return nil
+	}
+
+	return db.EndJob(database, &dbJob, db.JobPulled)
+}
+
+// incompleteCount returns the number of units of the job whose targets are
+// not complete, by the state policy.
+func incompleteCount() int {
+	var dbTransUnits []db.TransUnit
+
+	database.Joins("join files on files.id = trans_units.file_id").
+		Where("files.job_id = ? and files.deleted_at is null", dbJob.ID).
+		Find(&dbTransUnits)
+
+	count := 0
+
+	for _, dbTransUnit := range dbTransUnits {
+		if dbTransUnit.Target == "" || !policy.IsComplete(dbTransUnit.State) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// isPulledLanguage returns true if the targets of language are pulled.
+func isPulledLanguage(language string) bool {
+	if len(pullLanguages) == 0 {
+		return true
+	}
 
-	return database.Save(&dbJob).Error
+	for _, pulled := range pullLanguages {
+		if pulled == language {
+			return true
+		}
+	}
+
+	return false
 }
 
-func writeSourceDocument(path string, document xliff.Document) error {
+func writeSourceDocument(path string) error {
 	var dbFile db.File
-	var dbTransUnit db.TransUnit
-	var write bool
-	var newDocument xliff.Document
-	var newFile xliff.File
 
-	newDocument = xliff.Document{
-		Version: document.Version,
-		Files:   []xliff.File{},
+	database.Where("job_id = ? and path = ?", dbJob.ID, path).First(&dbFile)
+
+	if database.NewRecord(dbFile) || !isPulledLanguage(dbFile.Language) {
+		return nil
+	}
+
+	info, err := fs.Stat(path)
+
+	if err != nil {
+		return err
+	}
+
+	input, err := fs.Open(path)
+
+	if err != nil {
+		return err
 	}
 
-	for _, file := range document.Files {
-		newFile = xliff.File{
-			Original:       file.Original,
-			SourceLanguage: file.SourceLanguage,
-			Datatype:       file.Datatype,
-			TargetLanguage: file.TargetLanguage,
-			Header:         file.Header,
-			Body:           xliff.Body{TransUnits: []xliff.TransUnit{}},
+	var written []db.TransUnit
+
+	temporaryPath := path + ".tmp"
+
+	output, err := fs.Create(temporaryPath)
+
+	if err != nil {
+		input.Close()
+		return err
+	}
+
+	translate := func(file *xliff.File, groups []*xliff.Group, transUnit *xliff.TransUnit) error {
+		if !transUnit.IsTranslatable(groups...) {
+			return nil
 		}
 
-		for _, transUnit := range file.Body.TransUnits {
-			if !transUnit.IsComplete() {
-				if database.NewRecord(dbFile) {
-					database.Where("job_id = ? and language = ?", dbJob.ID, document.Files[0].TargetLanguage).First(&dbFile)
-				}
+		var dbTransUnit db.TransUnit
+
+		database.Where("file_id = ? and group_path = ? and qualifier = ?", dbFile.ID, xliff.GroupPath(groups), transUnit.ID).First(&dbTransUnit)
+
+		if database.NewRecord(dbTransUnit) || !policy.IsDone(dbTransUnit.State) {
+			return nil
+		}
 
-				if !database.NewRecord(dbFile) {
-					database.Where("file_id = ? and qualifier = ?", dbFile.ID, transUnit.ID).First(&dbTransUnit)
+		// Complete targets other than the one last written, as edited in the
+		// source file since, are only replaced by targets of newer job files.
+		if transUnit.IsComplete(policy) && transUnit.Target.Markup() != dbTransUnit.WrittenMarkup &&
+			(dbTransUnit.PulledAt == nil || !dbTransUnit.PulledAt.After(info.ModTime())) {
+			return nil
+		}
 
-					if !database.NewRecord(dbTransUnit) {
-						transUnit.Target.Data = dbTransUnit.Target
-						transUnit.Target.State = dbTransUnit.State
-						transUnit.Target.StateQualifier = dbTransUnit.StateQualifier
+		if dbTransUnit.TargetMarkup != "" {
+			err := transUnit.Target.SetMarkup(dbTransUnit.TargetMarkup)
 
-						write = true
-					}
-				}
+			if err != nil {
+				return err
 			}
+		} else {
+			transUnit.Target.Data = dbTransUnit.Target
+		}
 
-			newFile.Body.TransUnits = append(newFile.Body.TransUnits, transUnit)
+		if transUnit.SegSource.Content.IsSegmented() {
+			if segments, ok := pulledSegments(dbTransUnit); ok {
+				transUnit.Target.Content = xliff.SegmentTarget(transUnit.SegSource.Content, segments)
+				transUnit.Target.Data = transUnit.Target.Content.Text()
+			}
 		}
 
-		newDocument.Files = append(newDocument.Files, newFile)
+		transUnit.Target.State = policy.PulledState(dbTransUnit.State)
+		transUnit.Target.StateQualifier = dbTransUnit.StateQualifier
+
+		dbTransUnit.WrittenMarkup = transUnit.Target.Markup()
+		written = append(written, dbTransUnit)
+
+		return nil
 	}
 
-	if write {
-		return writeDocument(newDocument, path)
+	var write bool
+
+	if monolingual, ok := formatOf(path).(format.Monolingual); ok {
+		write, err = writeTranslation(monolingual, path, dbFile.Language, input, output, translate)
+	} else {
+		write, err = formatOf(path).Rewrite(input, output, translate)
+	}
+
+	input.Close()
+	output.Close()
+
+	if err != nil || !write {
+		fs.Remove(temporaryPath)
+		return err
+	}
+
+	err = fs.Rename(temporaryPath, path)
+
+	if err != nil {
+		return errors.New("failed to write xliff file " + path)
+	}
+
+	for i := range written {
+		if err := database.Save(&written[i]).Error; err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func processDestinationDocument(path string, document xliff.Document) error {
-	var dbFile db.File
-	var dbTransUnit db.TransUnit
+// writeTranslation writes the file of language at path, read from input, to
+// output with the units of the file of the source language it corresponds
+// to.
+func writeTranslation(monolingual format.Monolingual, path string, language string, input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	_, mainPath, _ := localize(path)
 
-	if len(document.Files) == 0 {
-		return nil
+	sourceInput, err := fs.Open(mainPath)
+
+	if err != nil {
+		return false, errors.New("failed to open source language file " + mainPath)
 	}
 
-	for _, file := range document.Files {
-		database.Where("job_id = ? and language = ?", dbJob.ID, document.Files[0].TargetLanguage).First(&dbFile)
+	defer sourceInput.Close()
 
-		if !database.NewRecord(dbFile) {
-			for _, transUnit := range file.Body.TransUnits {
-				database.Where("file_id = ? and identifier = ?", dbFile.ID, transUnit.ID).First(&dbTransUnit)
+	return monolingual.WriteTranslation(sourceInput, input, output, language, fn)
+}
 
-				if !database.NewRecord(dbTransUnit) {
-					dbTransUnit.Target = transUnit.Target.Data
-					dbTransUnit.State = transUnit.Target.State
-					dbTransUnit.StateQualifier = transUnit.Target.StateQualifier
+func processDestinationDocument(path string) error {
+	info, err := fs.Stat(path)
 
-					err := database.Save(&dbTransUnit).Error
+	if err != nil {
+		return err
+	}
 
-					if err != nil {
-						return err
-					}
-				}
-			}
-		}
+	if isSheet(path) {
+		return processSheetDocument(path, info.ModTime())
 	}
 
-	return nil
+	input, err := fs.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer input.Close()
+
+	return xliff.Stream(input, func(file *xliff.File, groups []*xliff.Group, transUnit *xliff.TransUnit) error {
+		return pullTransUnit(file.TargetLanguage, transUnit, info.ModTime())
+	})
 }
 
-func pullWalkFunc(path string, info os.FileInfo, err error) error {
-	if info == nil {
+// pullTransUnit saves the target of transUnit, a unit of the job file of
+// language written at the given time, if it is done. Empty targets, and
+// targets of job files older than the one the saved target was pulled
+// from, are left out, so that pulls can be repeated as job files arrive.
+func pullTransUnit(language string, transUnit *xliff.TransUnit, written time.Time) error {
+	if !isPulledLanguage(language) || transUnit.Target.Data == "" {
 		return nil
 	}
 
-	if info.IsDir() {
+	dbTransUnit, ok := jobTransUnit(language, transUnit.ID)
+
+	if !ok || !policy.IsDone(transUnit.Target.State) {
+		return nil
+	}
+
+	if dbTransUnit.PulledAt != nil && dbTransUnit.PulledAt.After(written) {
 		return nil
 	}
 
-	var data, error = afero.ReadFile(fs, path)
+	if dbTransUnit.SegSourceMarkup != "" {
+		content, err := joinSegments(dbTransUnit, *transUnit)
 
-	if error != nil {
-		return error
+		if err != nil {
+			return err
+		}
+
+		transUnit.Target.Content = content
+		transUnit.Target.Data = content.Text()
 	}
 
-	var document xliff.Document
+	if validator, ok := formatOf(dbTransUnit.Path).(format.TargetValidator); ok {
+		if err := validator.ValidateTarget(dbTransUnit.Source, transUnit.Target.Data); err != nil {
+			jww.WARN.Println("Target of " + dbTransUnit.Qualifier + " in file " + dbTransUnit.Path + " is left out: " + err.Error())
+			return nil
+		}
+	}
+
+	dbTransUnit.Target = transUnit.Target.Data
+	dbTransUnit.TargetMarkup = transUnit.Target.Markup()
+	dbTransUnit.State = transUnit.Target.State
+	dbTransUnit.StateQualifier = transUnit.Target.StateQualifier
+	dbTransUnit.PulledAt = &written
+
+	return database.Save(&dbTransUnit).Error
+}
+
+// jobTransUnit returns the unit of the job file of language with the given
+// identifier. Returns false if there is none.
+func jobTransUnit(language string, identifier string) (db.TransUnit, bool) {
+	var dbTransUnit db.TransUnit
+
+	database.Joins("join files on files.id = trans_units.file_id").
+		Where("files.job_id = ? and files.language = ? and trans_units.identifier = ?", dbJob.ID, language, identifier).
+		First(&dbTransUnit)
+
+	return dbTransUnit, !database.NewRecord(dbTransUnit)
+}
+
+// joinSegments saves the translated segments of transUnit and returns the
+// target of the whole unit: the segments joined as in the seg-source once
+// all of them are translated, the target without segments until then.
+func joinSegments(dbTransUnit db.TransUnit, transUnit xliff.TransUnit) (xliff.Content, error) {
+	segSource, err := xliff.ParseMarkup(dbTransUnit.SegSourceMarkup)
+
+	if err != nil {
+		return nil, err
+	}
 
-	document, error = xliff.From(data)
+	transUnit.SegSource.Content = segSource
+	segments := transUnit.Segments()
+	complete := len(segments) > 0
 
-	if error != nil {
-		return error
+	for _, segment := range segments {
+		var dbSegment db.Segment
+
+		if len(segment.Target) == 0 {
+			complete = false
+			continue
+		}
+
+		database.Where("trans_unit_id = ? and identifier = ?", dbTransUnit.ID, segment.ID).First(&dbSegment)
+
+		if database.NewRecord(dbSegment) {
+			continue
+		}
+
+		dbSegment.Target = segment.Target.Text()
+		dbSegment.TargetMarkup = segment.Target.Markup()
+
+		err = database.Save(&dbSegment).Error
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if complete {
+		return xliff.JoinSegments(segSource, segments), nil
+	}
+
+	return transUnit.Target.Content.WithoutSegments(), nil
+}
+
+// pulledSegments returns the segments of dbTransUnit with their targets.
+// Returns false unless all of them are translated.
+func pulledSegments(dbTransUnit db.TransUnit) ([]xliff.Segment, bool) {
+	var dbSegments []db.Segment
+
+	database.Where("trans_unit_id = ?", dbTransUnit.ID).Order("id").Find(&dbSegments)
+
+	segments := make([]xliff.Segment, 0, len(dbSegments))
+
+	for _, dbSegment := range dbSegments {
+		target, err := xliff.ParseMarkup(dbSegment.TargetMarkup)
+
+		if err != nil || len(target) == 0 {
+			return nil, false
+		}
+
+		segments = append(segments, xliff.Segment{ID: dbSegment.Identifier, Target: target})
+	}
+
+	return segments, len(segments) > 0
+}
+
+func pullWalkFunc(path string, info os.FileInfo, err error) error {
+	if info == nil {
+		return nil
+	}
+
+	if info.IsDir() {
+		return nil
 	}
 
-	destinationDocumentMap[path] = document
+	destinationPaths = append(destinationPaths, path)
 
 	return nil
 }
@@ -1,16 +1,21 @@
 package commands
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"github.com/dragosv/delta/db"
+	"github.com/dragosv/delta/format"
 	"github.com/dragosv/delta/xliff"
 	guuid "github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -37,58 +42,185 @@ var pushCommand = &cobra.Command{
 var fs afero.Fs
 var database *gorm.DB
 var dbJob db.Job
-var sourceDocumentMap map[string]xliff.Document
-var documentMap map[string]xliff.Document
+var sourcePaths []string
+var jobDocuments map[string]jobDocument
 var patternRegexp *regexp.Regexp
+var segment bool
+var segmentationRules string
+var segmenter *xliff.Segmenter
+var policy xliff.StatePolicy
+var force bool
+var jobFiles []string
+var pushed pushReport
 
 func init() {
 	rootCmd.AddCommand(pushCommand)
+
+	pushCommand.Flags().BoolVarP(&segment, "segment", "", false, "Segment sources into sentences")
+	pushCommand.Flags().StringVarP(&segmentationRules, "srx", "", "", "SRX file with the segmentation rules")
+	pushCommand.Flags().BoolVarP(&force, "force", "", false, "Push even if source files have validation errors")
+	pushCommand.Flags().StringSliceVarP(&jobFiles, "job-files", "", []string{"xliff"}, "Files written for each language of a job: xliff, csv or xlsx")
+
+	viper.BindPFlag("segment", pushCommand.Flags().Lookup("segment"))
+	viper.BindPFlag("srx", pushCommand.Flags().Lookup("srx"))
+	viper.BindPFlag("force", pushCommand.Flags().Lookup("force"))
+	viper.BindPFlag("job-files", pushCommand.Flags().Lookup("job-files"))
 }
 
 func runPushCommand(source string, destination string) error {
 	jww.FEEDBACK.Println("Running push...")
 
-	database.Where("active = ?", true).First(&dbJob)
+	err := checkJobName(jobName)
 
-	if !database.NewRecord(dbJob.ID) {
-		return errors.New("active job exists created at " + dbJob.CreatedAt.String())
+	if err != nil {
+		return err
 	}
 
-	dbJob = db.Job{
-		Active: true,
+	// Names are not reused, even those of ended jobs, as the folders of
+	// jobs are named after them.
+	if jobName != "" {
+		var existing db.Job
+
+		database.Where("name = ?", jobName).First(&existing)
+
+		if !database.NewRecord(existing) {
+			return errors.New("job " + jobName + " exists created at " + existing.CreatedAt.String())
+		}
+
+		if exists, _ := afero.Exists(fs, path.Join(destination, jobName)); exists {
+			return errors.New("folder of job " + jobName + " exists in " + destination)
+		}
 	}
 
-	err := database.Create(&dbJob).Error
+	err = loadFileRules()
 
 	if err != nil {
 		return err
 	}
 
-	patternRegexp, err = regexp.Compile(languagePattern)
+	err = checkJobFiles()
 
 	if err != nil {
 		return err
 	}
 
-	sourceDocumentMap = make(map[string]xliff.Document)
-	documentMap = make(map[string]xliff.Document)
+	sourcePaths = nil
 
 	afero.Walk(fs, source, sourceWalkFunc)
 
-	for path, document := range sourceDocumentMap {
-		processErr := processSourceDocument(path, document)
+	count := printDiagnostics(validateSourceDocuments(sourcePaths), xliff.SeverityWarning)
+
+	if count > 0 && !force {
+		return errors.New(strconv.Itoa(count) + " validation errors found in source files")
+	}
+
+	patternRegexp, err = regexp.Compile(languagePattern)
+
+	if err != nil {
+		return err
+	}
+
+	if !xliff.IsSupportedVersion(xliffVersion) {
+		return errors.New("unsupported xliff version " + xliffVersion)
+	}
+
+	policy, err = statePolicy()
+
+	if err != nil {
+		return err
+	}
+
+	segmenter, err = newSegmenter()
+
+	if err != nil {
+		return err
+	}
+
+	// Units are counted before the job is created, so that no job is left
+	// without units.
+	dbJob = db.Job{}
+	pushed = pushReport{}
+
+	sent, reused := 0, 0
+
+	for _, sourcePath := range sourcePaths {
+		sentCount, reusedCount, countErr := countSourceDocument(sourcePath)
+
+		if countErr != nil {
+			return countErr
+		}
+
+		sent += sentCount
+		reused += reusedCount
+	}
+
+	if sent == 0 && reused == 0 {
+		jww.FEEDBACK.Println("No units to push, skipped " + strconv.Itoa(pushed.InFlight) + " units in flight")
+		return nil
+	}
+
+	dbJob = db.Job{
+		Name:   jobName,
+		Active: true,
+	}
+
+	err = database.Create(&dbJob).Error
+
+	if err != nil {
+		return err
+	}
+
+	// Jobs without a name are named by their ID.
+	if dbJob.Name == "" {
+		dbJob.Name = strconv.FormatUint(uint64(dbJob.ID), 10)
+
+		err = database.Save(&dbJob).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	jobDirectory := path.Join(destination, dbJob.Name)
+
+	jobDocuments = make(map[string]jobDocument)
+	pushed = pushReport{}
+
+	// A job whose units are not all saved and written is canceled, lest the
+	// units it holds be taken as in flight by later pushes.
+	for _, sourcePath := range sourcePaths {
+		processErr := processSourceDocument(sourcePath, jobDirectory)
 
 		if processErr != nil {
-			panic(processErr)
+			closeJobDocuments(jobDirectory)
+			db.EndJob(database, &dbJob, db.JobCanceled)
+			return processErr
 		}
 	}
 
-	jobID := strconv.FormatUint(uint64(dbJob.ID), 10)
+	err = closeJobDocuments(jobDirectory)
 
-	for language, document := range documentMap {
-		xliffPath := path.Join(destination, jobID, language+".xliff")
+	if err != nil {
+		db.EndJob(database, &dbJob, db.JobCanceled)
+		return err
+	}
+
+	jww.FEEDBACK.Println("Pushed " + strconv.Itoa(pushed.New) + " new, " + strconv.Itoa(pushed.Changed) + " changed and " +
+		strconv.Itoa(pushed.Resent) + " resent units, reused " + strconv.Itoa(pushed.Reused) + " translations, skipped " +
+		strconv.Itoa(pushed.InFlight) + " units in flight")
+
+	// A job that sends no units only reuses translations, which are written
+	// to the source files at once, and ends.
+	if sent == 0 {
+		for _, sourcePath := range sourcePaths {
+			err = writeSourceDocument(sourcePath)
+
+			if err != nil {
+				return err
+			}
+		}
 
-		writeDocument(document, xliffPath)
+		return db.EndJob(database, &dbJob, db.JobPulled)
 	}
 
 	if plugin != "" {
@@ -98,160 +230,542 @@ func runPushCommand(source string, destination string) error {
 			return errors.New("failed to get job plugin " + error.Error())
 		}
 
-		return job.Push(config, path.Join(destination, jobID))
+		return job.Push(config, jobDirectory)
 	}
 
 	return nil
 }
 
+// newSegmenter returns the segmenter to apply to sources, or nil when
+// segmentation is off.
+func newSegmenter() (*xliff.Segmenter, error) {
+	if !segment {
+		return nil, nil
+	}
+
+	rules := xliff.DefaultSegmentationRules
+
+	if segmentationRules != "" {
+		data, err := afero.ReadFile(fs, segmentationRules)
+
+		if err != nil {
+			return nil, errors.New("failed to read segmentation rules " + err.Error())
+		}
+
+		rules, err = xliff.ParseSRX(data, sourceLanguage)
+
+		if err != nil {
+			return nil, errors.New("failed to parse segmentation rules " + err.Error())
+		}
+	}
+
+	return xliff.NewSegmenter(rules)
+}
+
 func sourceWalkFunc(path string, info os.FileInfo, err error) error {
 	if info == nil {
 		return nil
 	}
 
 	if info.IsDir() {
+		if path != source && !isIncluded(path, true) {
+			return filepath.SkipDir
+		}
+
 		return nil
 	}
 
-	var data, error = afero.ReadFile(fs, path)
+	if isIncluded(path, false) && formatOf(path) != nil {
+		sourcePaths = append(sourcePaths, path)
+	}
+
+	return nil
+}
+
+// pushReport counts the units of a push by how they compare to the ones of
+// earlier jobs. New units have no earlier unit in their file, changed units
+// have one with another source, and resent units one with the same source.
+// Reused units take the target of an earlier unit with the same source, and
+// units in flight are left out as they are in another active job.
+type pushReport struct {
+	New      int
+	Changed  int
+	Resent   int
+	Reused   int
+	InFlight int
+}
+
+// sourceHash returns the hash of a unit by the path of the file of the
+// source language it comes from, its target language, group path,
+// qualifier and source markup.
+func sourceHash(path string, language string, groupPath string, qualifier string, source string) string {
+	sum := sha1.Sum([]byte(strings.Join([]string{path, language, groupPath, qualifier, source}, "\x00")))
 
-	if error != nil {
-		return error
+	return hex.EncodeToString(sum[:])
+}
+
+// reusedTransUnit returns the last unit of another job with the given hash
+// and target language whose target is complete, by the state policy. Units
+// of canceled jobs, and of closed jobs they were not pulled from, are left
+// out.
+func reusedTransUnit(hash string, language string) (db.TransUnit, bool) {
+	var dbTransUnits []db.TransUnit
+
+	database.Joins("join files on files.id = trans_units.file_id").
+		Joins("join jobs on jobs.id = files.job_id").
+		Where("jobs.id <> ? and coalesce(jobs.status, '') <> ? and (coalesce(jobs.status, '') <> ? or trans_units.pulled_at is not null)", dbJob.ID, db.JobCanceled, db.JobClosed).
+		Where("trans_units.hash = ? and trans_units.target_language = ? and trans_units.target <> ?", hash, language, "").
+		Order("trans_units.id desc").
+		Find(&dbTransUnits)
+
+	for _, dbTransUnit := range dbTransUnits {
+		if policy.IsComplete(dbTransUnit.State) {
+			return dbTransUnit, true
+		}
 	}
 
-	var document xliff.Document
+	return db.TransUnit{}, false
+}
+
+// isInFlight returns true if another active job has a unit with the given
+// hash and target language.
+func isInFlight(hash string, language string) bool {
+	count := 0
+
+	database.Model(&db.TransUnit{}).
+		Joins("join files on files.id = trans_units.file_id").
+		Joins("join jobs on jobs.id = files.job_id").
+		Where("jobs.active = ? and jobs.id <> ? and files.deleted_at is null and trans_units.hash = ? and trans_units.target_language = ?", true, dbJob.ID, hash, language).
+		Count(&count)
 
-	document, error = xliff.From(data)
+	return count > 0
+}
 
-	if error != nil {
-		return error
+// countPushed counts a unit of the file at path sent to the job, by the last
+// unit of another job with its qualifier in the file.
+func countPushed(path string, groupPath string, qualifier string, hash string) {
+	var earlier db.TransUnit
+
+	database.Joins("join files on files.id = trans_units.file_id").
+		Where("files.job_id <> ? and trans_units.path = ? and trans_units.group_path = ? and trans_units.qualifier = ?", dbJob.ID, path, groupPath, qualifier).
+		Order("trans_units.id desc").
+		First(&earlier)
+
+	switch {
+	case database.NewRecord(earlier):
+		pushed.New++
+	case earlier.Hash != hash:
+		pushed.Changed++
+	default:
+		pushed.Resent++
 	}
+}
 
-	sourceDocumentMap[path] = document
+// jobDocument is the job files of a language: an XLIFF file written one
+// trans-unit at a time, and the rows of its sheets.
+type jobDocument struct {
+	file    afero.File
+	encoder *xliff.Encoder
+	rows    [][]string
+}
+
+// checkJobFiles returns an error if the job files flag names unknown files.
+func checkJobFiles() error {
+	for _, jobFile := range jobFiles {
+		switch jobFile {
+		case "xliff", "csv", "xlsx":
+		default:
+			return errors.New("unknown job file " + jobFile)
+		}
+	}
 
 	return nil
 }
 
-func processSourceDocument(path string, document xliff.Document) error {
+// hasJobFile returns true if the job files flag names jobFile.
+func hasJobFile(jobFile string) bool {
+	for _, name := range jobFiles {
+		if name == jobFile {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pushFunc is called for a unit of a source file sent to the job or whose
+// target is reused, with the path of the file of the source language it
+// comes from, its group path and hash. reused is the unit of another job
+// whose target it takes, if found is true.
+type pushFunc func(mainPath string, groupPath string, hash string, transUnit *xliff.TransUnit, reused db.TransUnit, found bool) error
+
+// readSourceDocument calls fn for the units of the source file at path that
+// need translation, with their languages filled in. Units in flight in
+// another active job are counted and left out.
+func readSourceDocument(path string, fn pushFunc) error {
+	input, err := fs.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer input.Close()
+
+	language, mainPath, localized := localize(path)
+	pathSourceLanguage := sourceLanguageOf(path)
+
+	walk := func(file *xliff.File, groups []*xliff.Group, xliffTransUnit *xliff.TransUnit) error {
+		if !xliffTransUnit.NeedsTranslation(policy, groups...) {
+			return nil
+		}
+
+		if xliffTransUnit.Source.Language == "" {
+			xliffTransUnit.Source.Language = pathSourceLanguage
+		}
+
+		if xliffTransUnit.Target.Language == "" {
+			xliffTransUnit.Target.Language = language
+		}
+
+		groupPath := xliff.GroupPath(groups)
+		hash := sourceHash(mainPath, xliffTransUnit.Target.Language, groupPath, xliffTransUnit.ID, xliffTransUnit.Source.Markup())
+		reused, found := reusedTransUnit(hash, xliffTransUnit.Target.Language)
+
+		if !found && isInFlight(hash, xliffTransUnit.Target.Language) {
+			pushed.InFlight++
+			return nil
+		}
+
+		if !localized {
+			return errors.New("No language could be identified for file " + path)
+		}
+
+		return fn(mainPath, groupPath, hash, xliffTransUnit, reused, found)
+	}
+
+	monolingual, ok := formatOf(path).(format.Monolingual)
+
+	if !ok {
+		return formatOf(path).Read(input, walk)
+	}
+
+	if !localized {
+		jww.WARN.Println("No language could be identified for file " + path)
+		return nil
+	}
+
+	if language == pathSourceLanguage {
+		return nil
+	}
+
+	if path == mainPath {
+		jww.WARN.Println("No source language file could be identified for file " + path)
+		return nil
+	}
+
+	sourceInput, err := fs.Open(mainPath)
+
+	if err != nil {
+		return errors.New("failed to open source language file " + mainPath)
+	}
+
+	defer sourceInput.Close()
+
+	return monolingual.ReadTranslation(sourceInput, input, language, walk)
+}
+
+// countSourceDocument returns the number of units of the source file at
+// path that would be sent to a job, and of those whose target would be
+// reused.
+func countSourceDocument(path string) (int, int, error) {
+	sent, reused := 0, 0
+
+	err := readSourceDocument(path, func(mainPath string, groupPath string, hash string, transUnit *xliff.TransUnit, _ db.TransUnit, found bool) error {
+		if found {
+			reused++
+		} else {
+			sent++
+		}
+
+		return nil
+	})
+
+	return sent, reused, err
+}
+
+func processSourceDocument(path string, directory string) error {
 	var dbFile db.File
 	var dbTransUnit db.TransUnit
 	var dbNote db.Note
-	var dbIdentifier db.Identifier
 
-	if !document.IsComplete() {
-		indexes := patternRegexp.FindStringSubmatchIndex(path)
+	return readSourceDocument(path, func(mainPath string, groupPath string, hash string, xliffTransUnit *xliff.TransUnit, reused db.TransUnit, found bool) error {
+		if database.NewRecord(dbFile) {
+			database.Where("job_id = ? and path = ?", dbJob.ID, path).First(&dbFile)
+
+			if database.NewRecord(dbFile) {
+				dbFile = db.File{
+					JobID:    dbJob.ID,
+					Job:      dbJob,
+					Path:     path,
+					Language: xliffTransUnit.Target.Language,
+				}
+
+				err := database.Create(&dbFile).Error
 
-		if indexes == nil {
-			return errors.New("No language could be identified for file " + path)
+				if err != nil {
+					return err
+				}
+			}
 		}
 
-		start := len(indexes) - 2
-		end := len(indexes) - 1
-		mainPath := replaceAtIndex(path, sourceLanguage, indexes[start], indexes[end])
+		var identifier string
+		var dbIdentifier db.Identifier
 
-		database.Where("job_id = ? and path = ?", dbJob.ID, document.Files[0].TargetLanguage).First(&dbFile)
+		transUnit := xliffTransUnit.WithoutExtra()
 
-		if database.NewRecord(dbFile) {
-			dbFile = db.File{
-				JobID:    dbJob.ID,
-				Job:      dbJob,
-				Path:     path,
-				Language: document.Files[0].TargetLanguage,
+		if segmenter != nil && len(transUnit.SegSource.Content) == 0 {
+			transUnit.SegSource.Content = segmenter.Segment(transUnit.Source.Content)
+		}
+
+		database.Where("job_id = ? and path = ? and group_path = ? and qualifier = ?", dbJob.ID, mainPath, groupPath, xliffTransUnit.ID).First(&dbIdentifier)
+
+		if database.NewRecord(dbIdentifier) {
+			identifier = strings.Replace(guuid.New().String(), "-", "", -1)
+
+			dbIdentifier = db.Identifier{
+				Model:     gorm.Model{},
+				JobID:     dbJob.ID,
+				Job:       dbJob,
+				Data:      identifier,
+				Qualifier: xliffTransUnit.ID,
+				Path:      mainPath,
+				GroupPath: groupPath,
 			}
 
-			err := database.Create(&dbFile).Error
+			err := database.Create(&dbIdentifier).Error
 
 			if err != nil {
 				return err
 			}
+		} else {
+			identifier = dbIdentifier.Data
 		}
 
-		var incompleteTransUnits = document.IncompleteTransUnits()
-		for _, xliffTransUnit := range incompleteTransUnits {
-			var identifier string
+		dbTransUnit = db.TransUnit{
+			Resname:         xliffTransUnit.Resname,
+			Path:            path,
+			GroupPath:       groupPath,
+			Identifier:      identifier,
+			Qualifier:       xliffTransUnit.ID,
+			State:           xliffTransUnit.Target.State,
+			StateQualifier:  xliffTransUnit.Target.StateQualifier,
+			Source:          xliffTransUnit.Source.Data,
+			Target:          xliffTransUnit.Target.Data,
+			SourceMarkup:    xliffTransUnit.Source.Markup(),
+			TargetMarkup:    xliffTransUnit.Target.Markup(),
+			SegSourceMarkup: transUnit.SegSource.Content.Markup(),
+			SourceLanguage:  xliffTransUnit.Source.Language,
+			TargetLanguage:  xliffTransUnit.Target.Language,
+			Hash:            hash,
+			FileID:          dbFile.ID,
+		}
 
-			database.Where("job_id = ? and path = ? and qualifier = ?", dbJob.ID, mainPath, xliffTransUnit.ID).First(&dbIdentifier)
+		// Reused targets are written by the pull of the job, with the
+		// targets of its job files, or at once if the job sends no units.
+		if found {
+			dbTransUnit.Target = reused.Target
+			dbTransUnit.TargetMarkup = reused.TargetMarkup
+			dbTransUnit.State = reused.State
+			dbTransUnit.StateQualifier = reused.StateQualifier
+		} else {
+			countPushed(path, groupPath, xliffTransUnit.ID, hash)
+		}
 
-			if database.NewRecord(dbIdentifier) {
-				identifier = strings.Replace(guuid.New().String(), "-", "", -1)
+		err := database.Create(&dbTransUnit).Error
 
-				dbIdentifier = db.Identifier{
-					Model:     gorm.Model{},
-					JobID:     dbJob.ID,
-					Job:       dbJob,
-					Data:      identifier,
-					Qualifier: xliffTransUnit.ID,
-					Path:      mainPath,
-				}
+		if err != nil {
+			return err
+		}
 
-				err := database.Create(&dbIdentifier).Error
+		for _, xliffNote := range xliffTransUnit.Notes {
+			dbNote = db.Note{
+				TransUnitID: dbTransUnit.ID,
+				TransUnit:   dbTransUnit,
+				Data:        xliffNote.Data,
+				Language:    xliffNote.Language,
+				From:        xliffNote.From,
+			}
 
-				if err != nil {
-					return err
-				}
-			} else {
-				identifier = dbIdentifier.Data
+			err = database.Create(&dbNote).Error
+
+			if err != nil {
+				return err
 			}
+		}
 
-			dbTransUnit = db.TransUnit{
-				Resname:        xliffTransUnit.Resname,
-				Path:           path,
-				Identifier:     identifier,
-				Qualifier:      xliffTransUnit.ID,
-				State:          xliffTransUnit.Target.State,
-				StateQualifier: xliffTransUnit.Target.StateQualifier,
-				Source:         xliffTransUnit.Source.Data,
-				Target:         xliffTransUnit.Target.Data,
-				SourceLanguage: xliffTransUnit.Source.Language,
-				TargetLanguage: xliffTransUnit.Target.Language,
-				FileID:         dbFile.ID,
+		for _, segment := range transUnit.Segments() {
+			dbSegment := db.Segment{
+				TransUnitID:  dbTransUnit.ID,
+				TransUnit:    dbTransUnit,
+				Identifier:   segment.ID,
+				Source:       segment.Source.Text(),
+				Target:       segment.Target.Text(),
+				SourceMarkup: segment.Source.Markup(),
+				TargetMarkup: segment.Target.Markup(),
 			}
 
-			err := database.Create(&dbTransUnit).Error
+			err = database.Create(&dbSegment).Error
 
 			if err != nil {
 				return err
 			}
+		}
 
-			for _, xliffNote := range xliffTransUnit.Notes {
-				dbNote = db.Note{
-					TransUnitID: dbTransUnit.ID,
-					TransUnit:   dbTransUnit,
-					Data:        xliffNote.Data,
-					Language:    xliffNote.Language,
-					From:        xliffNote.From,
-				}
+		if found {
+			pushed.Reused++
+			return nil
+		}
 
-				err = database.Create(&dbNote).Error
+		transUnit.ID = dbTransUnit.Identifier
 
-				if err != nil {
-					return err
-				}
+		return encodeJobTransUnit(directory, transUnit)
+	})
+}
+
+// localize returns the language of the source file at path and the path of
+// the file of the source language it corresponds to, as told by the format
+// of the file if it is a Localizer that can tell, its content telling the
+// language if it is a ContentLocalizer, or else by the language pattern of
+// the file. Returns false if no language is told.
+func localize(path string) (string, string, bool) {
+	sourceLanguage := sourceLanguageOf(path)
+
+	if localizer, ok := formatOf(path).(format.Localizer); ok {
+		language, ok := localizer.Language(path)
+
+		if contentLocalizer, isContentLocalizer := localizer.(format.ContentLocalizer); isContentLocalizer {
+			if contentLanguage, found := readLanguage(contentLocalizer, path); found {
+				language, ok = contentLanguage, true
 			}
+		}
+
+		if ok {
+			if language == "" {
+				language = sourceLanguage
+			}
+
+			return language, localizer.SourcePath(path, sourceLanguage), true
+		}
+	}
 
-			var transUnit = xliffTransUnit
-			transUnit.ID = dbTransUnit.Identifier
+	indexes := languagePatternOf(path).FindStringSubmatchIndex(path)
+
+	if indexes == nil {
+		return "", "", false
+	}
+
+	start := len(indexes) - 2
+	end := len(indexes) - 1
+
+	return path[indexes[start]:indexes[end]], replaceAtIndex(path, sourceLanguage, indexes[start], indexes[end]), true
+}
+
+// readLanguage returns the language the content of the file at path tells.
+func readLanguage(localizer format.ContentLocalizer, path string) (string, bool) {
+	input, err := fs.Open(path)
+
+	if err != nil {
+		return "", false
+	}
+
+	defer input.Close()
+
+	return localizer.ContentLanguage(input)
+}
+
+// encodeJobTransUnit writes transUnit to the job files of its target
+// language in directory, which is created along with the files.
+func encodeJobTransUnit(directory string, transUnit xliff.TransUnit) error {
+	language := transUnit.Target.Language
+	document, ok := jobDocuments[language]
+
+	if !ok && hasJobFile("xliff") {
+		err := fs.MkdirAll(directory, 0755)
+
+		if err != nil {
+			return err
+		}
 
-			document := documentMap[xliffTransUnit.Target.Language]
+		document.file, err = fs.Create(path.Join(directory, language+".xliff"))
 
-			if document.Version == "" {
-				document.Version = "1.2"
+		if err != nil {
+			return errors.New("failed to create xliff file for language " + language)
+		}
+
+		document.encoder, err = xliff.NewEncoder(document.file, xliffVersion, xliff.File{
+			Original:       language + ".xliff",
+			SourceLanguage: transUnit.Source.Language,
+			Datatype:       "plaintext",
+			TargetLanguage: language,
+			Header:         xliff.Header{Tool: xliff.Tool{ToolID: "delta", ToolName: "delta", ToolVersion: "0.1", BuildNum: "0"}},
+		})
+
+		if err != nil {
+			document.file.Close()
+			return err
+		}
+	}
+
+	if hasJobFile("csv") || hasJobFile("xlsx") {
+		document.rows = append(document.rows, sheetRow(transUnit))
+	}
+
+	jobDocuments[language] = document
+
+	if document.encoder == nil {
+		return nil
+	}
+
+	return document.encoder.Encode(transUnit)
+}
+
+// closeJobDocuments ends the job files in directory and closes them.
+func closeJobDocuments(directory string) error {
+	for language, document := range jobDocuments {
+		if document.encoder != nil {
+			err := document.encoder.Close()
+
+			if closeErr := document.file.Close(); err == nil {
+				err = closeErr
 			}
 
-			if len(document.Files) == 0 {
-				document.Files = append(document.Files, xliff.File{
-					Original:       xliffTransUnit.Target.Language + ".xliff",
-					SourceLanguage: xliffTransUnit.Source.Language,
-					Datatype:       "plaintext",
-					TargetLanguage: xliffTransUnit.Target.Language,
-					Header:         xliff.Header{Tool: xliff.Tool{ToolID: "delta", ToolName: "delta", ToolVersion: "0.1", BuildNum: "0"}},
-					Body:           xliff.Body{},
-				})
+			if err != nil {
+				return errors.New("failed to write xliff file for language " + language)
 			}
+		}
 
-			document.Files[0].Body.TransUnits = append(document.Files[0].Body.TransUnits, transUnit)
+		if document.rows == nil {
+			continue
+		}
+
+		err := fs.MkdirAll(directory, 0755)
 
-			documentMap[xliffTransUnit.Target.Language] = document
+		if err != nil {
+			return err
+		}
+
+		rows := append([][]string{sheetColumns}, document.rows...)
+
+		for _, jobFile := range []string{"csv", "xlsx"} {
+			if !hasJobFile(jobFile) {
+				continue
+			}
+
+			err = writeSheet(path.Join(directory, language+"."+jobFile), language, rows)
+
+			if err != nil {
+				return errors.New("failed to write " + jobFile + " file for language " + language)
+			}
 		}
 	}
 
@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"encoding/xml"
 	"errors"
 	"fmt"
 	"github.com/dragosv/delta/db"
@@ -11,6 +10,8 @@ import (
 	"github.com/spf13/afero"
 	"os"
 	p "plugin"
+	"strconv"
+	"strings"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
@@ -28,6 +29,9 @@ var (
 	config             string
 	sourceLanguage     string
 	languagePattern    string
+	xliffVersion       string
+	sourceFormat       string
+	jobName            string
 
 	rootCmd = &cobra.Command{
 		Use:   "delta",
@@ -48,23 +52,39 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "c", "config file (default is $HOME/.delta)")
 
-	rootCmd.Flags().StringVarP(&source, "source", "s", "", "Source directory to read from")
-	rootCmd.Flags().StringVarP(&destination, "destination", "d", "", "Destination directory to write to")
-	rootCmd.Flags().StringVarP(&databaseDialect, "dialect", "", "", "Database dialect")
-	rootCmd.Flags().StringVarP(&databaseConnection, "connection", "", "", "Database connection string")
-	rootCmd.Flags().StringVarP(&plugin, "plugin", "", "", "Job plugin")
-	rootCmd.Flags().StringVarP(&config, "plugin-config", "", "", "Job plugin configuration file")
-	rootCmd.Flags().StringVarP(&sourceLanguage, "language", "", "", "Source language")
-	rootCmd.Flags().StringVarP(&languagePattern, "pattern", "", "", "Language pattern regex")
+	rootCmd.PersistentFlags().StringVarP(&source, "source", "s", "", "Source directory to read from")
+	rootCmd.PersistentFlags().StringVarP(&destination, "destination", "d", "", "Destination directory to write to")
+	rootCmd.PersistentFlags().StringVarP(&databaseDialect, "dialect", "", "", "Database dialect")
+	rootCmd.PersistentFlags().StringVarP(&databaseConnection, "connection", "", "", "Database connection string")
+	rootCmd.PersistentFlags().StringVarP(&jobName, "job", "j", "", "Name of the job, and of its folder in the destination directory")
+	rootCmd.PersistentFlags().StringVarP(&plugin, "plugin", "", "", "Job plugin")
+	rootCmd.PersistentFlags().StringVarP(&config, "plugin-config", "", "", "Job plugin configuration file")
+	rootCmd.PersistentFlags().StringVarP(&sourceLanguage, "language", "", "", "Source language")
+	rootCmd.PersistentFlags().StringVarP(&languagePattern, "pattern", "", "", "Language pattern regex")
+	rootCmd.PersistentFlags().StringVarP(&xliffVersion, "xliff-version", "", xliff.Version12, "XLIFF version of the job files")
+	rootCmd.PersistentFlags().StringVarP(&sourceFormat, "format", "", "", "Format of the source files that no files rule gives one, by their extension or content if empty")
+	rootCmd.PersistentFlags().StringSlice("include", nil, "Globs of the source files to read, all if empty")
+	rootCmd.PersistentFlags().StringSlice("exclude", nil, "Globs of the source files and folders to leave out")
+	rootCmd.PersistentFlags().StringSlice("complete-states", xliff.DefaultPolicy().Complete, "Target states of units that are not pushed")
+	rootCmd.PersistentFlags().StringSlice("done-states", nil, "Target states in which pulled targets are written back, any if empty")
+	rootCmd.PersistentFlags().String("pull-state", "", "State of the targets written back on pull, the pulled state if empty")
 
 	viper.BindPFlag("source", rootCmd.PersistentFlags().Lookup("source"))
 	viper.BindPFlag("destination", rootCmd.PersistentFlags().Lookup("destination"))
 	viper.BindPFlag("dialect", rootCmd.PersistentFlags().Lookup("dialect"))
 	viper.BindPFlag("connection", rootCmd.PersistentFlags().Lookup("connection"))
+	viper.BindPFlag("job", rootCmd.PersistentFlags().Lookup("job"))
 	viper.BindPFlag("plugin", rootCmd.PersistentFlags().Lookup("plugin"))
 	viper.BindPFlag("plugin-config", rootCmd.PersistentFlags().Lookup("plugin-config"))
 	viper.BindPFlag("language", rootCmd.PersistentFlags().Lookup("language"))
 	viper.BindPFlag("pattern", rootCmd.PersistentFlags().Lookup("pattern"))
+	viper.BindPFlag("xliff-version", rootCmd.PersistentFlags().Lookup("xliff-version"))
+	viper.BindPFlag("format", rootCmd.PersistentFlags().Lookup("format"))
+	viper.BindPFlag("files.include", rootCmd.PersistentFlags().Lookup("include"))
+	viper.BindPFlag("files.exclude", rootCmd.PersistentFlags().Lookup("exclude"))
+	viper.BindPFlag("states.complete", rootCmd.PersistentFlags().Lookup("complete-states"))
+	viper.BindPFlag("states.done", rootCmd.PersistentFlags().Lookup("done-states"))
+	viper.BindPFlag("states.pull", rootCmd.PersistentFlags().Lookup("pull-state"))
 }
 
 func er(msg interface{}) {
@@ -94,12 +114,72 @@ func initConfig() {
 	}
 }
 
+// statePolicy returns the state policy set by the states configuration
+// keys or their flags.
+func statePolicy() (xliff.StatePolicy, error) {
+	policy := xliff.StatePolicy{
+		Complete: viper.GetStringSlice("states.complete"),
+		Done:     viper.GetStringSlice("states.done"),
+		Pull:     viper.GetString("states.pull"),
+	}
+
+	return policy, policy.Validate()
+}
+
 func openDatabase(databaseDialect string, databaseConnection string) (database *gorm.DB, err error) {
 	database, err = db.OpenDatabase(databaseDialect, databaseConnection)
 
 	return
 }
 
+// checkJobName returns an error if name cannot name the folder of a job.
+func checkJobName(name string) error {
+	if name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return errors.New("invalid job name " + name)
+	}
+
+	// Names made of digits are those of the jobs named by their ID.
+	if _, err := strconv.ParseUint(name, 10, 64); err == nil {
+		return errors.New("invalid job name " + name + ", numbers name the jobs without a name")
+	}
+
+	return nil
+}
+
+// activeJob returns the active job of the given name, or the only active
+// job if name is empty.
+func activeJob(name string) (db.Job, error) {
+	var dbJobs []db.Job
+
+	query := database.Where("active = ?", true)
+
+	if name != "" {
+		query = query.Where("name = ?", name)
+	}
+
+	query.Order("id").Find(&dbJobs)
+
+	if len(dbJobs) == 0 {
+		if name != "" {
+			return db.Job{}, errors.New("active job " + name + " does not exist")
+		}
+
+		return db.Job{}, errors.New("active job does not exists")
+	}
+
+	if len(dbJobs) > 1 {
+		var names []string
+
+		for _, dbJob := range dbJobs {
+			names = append(names, dbJob.Name)
+		}
+
+		return db.Job{}, errors.New("several jobs are active, choose one of " + strings.Join(names, ", ") + " with --job")
+	}
+
+	return dbJobs[0], nil
+}
+
 func getJob() (job.Job, error) {
 	pluginObject, error := p.Open(plugin)
 
@@ -123,7 +203,7 @@ func getJob() (job.Job, error) {
 }
 
 func writeDocument(document xliff.Document, path string) error {
-	file, err := xml.MarshalIndent(document, "", " ")
+	file, err := xliff.Marshal(document)
 
 	if err != nil {
 		var language string
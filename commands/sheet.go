@@ -0,0 +1,368 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"github.com/dragosv/delta/xliff"
+	"github.com/dragosv/delta/xlsx"
+	"github.com/spf13/afero"
+	jww "github.com/spf13/jwalterweatherman"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns of the sheets of a job, in the header row.
+var sheetColumns = []string{"identifier", "source", "target", "notes", "state"}
+
+// Cells of job sheets that a spreadsheet would take as a formula, with the
+// quotes escaping them, as sheetCell writes them.
+var sheetFormulaRegexp = regexp.MustCompile(`^'*[=+\-@\t\r]`)
+
+// Tags standing for the inline codes of units in sheets: <1>text</1> for a
+// code enclosing text and <2/> for the others, numbered in the order of the
+// codes in the source.
+var sheetTagRegexp = regexp.MustCompile(`<(/?)([0-9]+)(/?)>`)
+
+// sheetRow returns the row of transUnit in the sheets of a job.
+func sheetRow(transUnit xliff.TransUnit) []string {
+	var notes []string
+
+	for _, note := range transUnit.Notes {
+		notes = append(notes, note.Data)
+	}
+
+	source, _ := xliff.ParseMarkup(transUnit.Source.Markup())
+	target, _ := xliff.ParseMarkup(transUnit.Target.Markup())
+	codes := sheetCodes(source)
+
+	return []string{
+		sheetCell(transUnit.ID),
+		sheetCell(sheetText(source, codes)),
+		sheetCell(sheetText(target, codes)),
+		sheetCell(strings.Join(notes, "\n")),
+		sheetState(transUnit.Target.State),
+	}
+}
+
+// sheetState returns the state of a target as written in sheets: the
+// initial state of the policy if it has none.
+func sheetState(state string) string {
+	if state == "" {
+		return policy.InitialState()
+	}
+
+	return state
+}
+
+// sheetCell returns text as written in a cell of a sheet, with a quote
+// before it if a spreadsheet would take it as a formula.
+func sheetCell(text string) string {
+	if sheetFormulaRegexp.MatchString(text) {
+		return "'" + text
+	}
+
+	return text
+}
+
+// sheetCellText returns the text of a cell written by sheetCell.
+func sheetCellText(cell string) string {
+	if strings.HasPrefix(cell, "'") && sheetFormulaRegexp.MatchString(cell) {
+		return cell[1:]
+	}
+
+	return cell
+}
+
+// isEnclosing returns true if inline is a code enclosing text.
+func isEnclosing(inline xliff.Inline) bool {
+	return inline.Kind == xliff.InlinePaired || inline.Kind == xliff.InlineMarker || inline.Kind == xliff.InlineOther
+}
+
+// sheetCodes returns the codes of content in the order they are numbered.
+func sheetCodes(content xliff.Content) []xliff.Inline {
+	var codes []xliff.Inline
+
+	for _, inline := range content {
+		if inline.Kind == xliff.InlineText {
+			continue
+		}
+
+		codes = append(codes, inline)
+
+		if isEnclosing(inline) {
+			codes = append(codes, sheetCodes(inline.Content)...)
+		}
+	}
+
+	return codes
+}
+
+// sheetText returns content as written in sheets, with its codes as the
+// tags of the same codes of the source, given by codes. Codes missing from
+// the source are numbered after them.
+func sheetText(content xliff.Content, codes []xliff.Inline) string {
+	var text strings.Builder
+
+	used := make([]bool, len(codes))
+	extra := len(codes)
+
+	var write func(content xliff.Content)
+
+	write = func(content xliff.Content) {
+		for _, inline := range content {
+			if inline.Kind == xliff.InlineText {
+				text.WriteString(inline.Text)
+				continue
+			}
+
+			number := 0
+
+			for i, code := range codes {
+				if !used[i] && code.Kind == inline.Kind && code.ID == inline.ID {
+					used[i] = true
+					number = i + 1
+					break
+				}
+			}
+
+			if number == 0 {
+				extra++
+				number = extra
+			}
+
+			tag := strconv.Itoa(number)
+
+			if !isEnclosing(inline) {
+				text.WriteString("<" + tag + "/>")
+				continue
+			}
+
+			text.WriteString("<" + tag + ">")
+			write(inline.Content)
+			text.WriteString("</" + tag + ">")
+		}
+	}
+
+	write(content)
+
+	return text.String()
+}
+
+// parseSheetText returns the content of text, written in a sheet for a unit
+// with the given source. Returns an error unless the tags of text are those
+// of the codes of the source, each once, enclosing text as they do.
+func parseSheetText(text string, source xliff.Content) (xliff.Content, error) {
+	codes := sheetCodes(source)
+
+	if len(codes) == 0 {
+		return xliff.TextContent(text), nil
+	}
+
+	type open struct {
+		number  int
+		content xliff.Content
+	}
+
+	stack := []open{{}}
+	used := make([]bool, len(codes))
+	last := 0
+
+	appendText := func(text string) {
+		if text != "" {
+			top := &stack[len(stack)-1]
+			top.content = append(top.content, xliff.Inline{Kind: xliff.InlineText, Text: text})
+		}
+	}
+
+	for _, match := range sheetTagRegexp.FindAllStringSubmatchIndex(text, -1) {
+		appendText(text[last:match[0]])
+		last = match[1]
+
+		tag := text[match[0]:match[1]]
+		closing, selfClosing := match[3] > match[2], match[7] > match[6]
+		number, _ := strconv.Atoi(text[match[4]:match[5]])
+
+		if number < 1 || number > len(codes) || (closing && selfClosing) {
+			return nil, errors.New("tag " + tag + " is not one of the source")
+		}
+
+		code := codes[number-1]
+
+		if closing {
+			if stack[len(stack)-1].number != number {
+				return nil, errors.New("tag " + tag + " closes no open tag")
+			}
+
+			code.Content = stack[len(stack)-1].content
+			stack = stack[:len(stack)-1]
+		} else {
+			if used[number-1] {
+				return nil, errors.New("tag " + tag + " is repeated")
+			}
+
+			used[number-1] = true
+
+			if isEnclosing(code) == selfClosing {
+				return nil, errors.New("tag " + tag + " does not match the code of the source")
+			}
+
+			if !selfClosing {
+				stack = append(stack, open{number: number})
+				continue
+			}
+		}
+
+		top := &stack[len(stack)-1]
+		top.content = append(top.content, code)
+	}
+
+	appendText(text[last:])
+
+	if len(stack) > 1 {
+		return nil, errors.New("tag <" + strconv.Itoa(stack[len(stack)-1].number) + "> is not closed")
+	}
+
+	for i := range used {
+		if !used[i] {
+			return nil, errors.New("tag of code " + strconv.Itoa(i+1) + " of the source is missing")
+		}
+	}
+
+	return stack[0].content, nil
+}
+
+// writeSheet writes rows to the CSV or XLSX file at path, by its extension.
+func writeSheet(filePath string, name string, rows [][]string) error {
+	var data bytes.Buffer
+
+	if path.Ext(filePath) == ".xlsx" {
+		if err := xlsx.Write(&data, name, rows); err != nil {
+			return err
+		}
+	} else {
+		writer := csv.NewWriter(&data)
+
+		if err := writer.WriteAll(rows); err != nil {
+			return err
+		}
+	}
+
+	return afero.WriteFile(fs, filePath, data.Bytes(), 0644)
+}
+
+// readSheet returns the rows of the CSV or XLSX file at path, by its
+// extension.
+func readSheet(filePath string) ([][]string, error) {
+	data, err := afero.ReadFile(fs, filePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if path.Ext(filePath) == ".xlsx" {
+		return xlsx.Read(data)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	return reader.ReadAll()
+}
+
+// isSheet returns true if the job file at path is a sheet.
+func isSheet(filePath string) bool {
+	extension := path.Ext(filePath)
+	return extension == ".csv" || extension == ".xlsx"
+}
+
+// processSheetDocument saves the targets of the rows of the sheet at path,
+// a job file named by its language written at the given time, found by the
+// identifier column. Rows with no target, or whose tags do not match the
+// codes of the source, are left out. Targets of rows with no state, or with
+// the state the unit was written with when the target was changed, are
+// translated.
+func processSheetDocument(filePath string, written time.Time) error {
+	rows, err := readSheet(filePath)
+
+	if err != nil {
+		return errors.New("failed to read sheet " + filePath + ": " + err.Error())
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	columns := make(map[string]int)
+
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range []string{"identifier", "target"} {
+		if _, ok := columns[name]; !ok {
+			return errors.New("sheet " + filePath + " has no " + name + " column")
+		}
+	}
+
+	cell := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+
+		return ""
+	}
+
+	language := strings.TrimSuffix(path.Base(filePath), path.Ext(filePath))
+
+	for _, row := range rows[1:] {
+		identifier, target := sheetCellText(cell(row, "identifier")), sheetCellText(cell(row, "target"))
+
+		if identifier == "" || target == "" || !isPulledLanguage(language) {
+			continue
+		}
+
+		dbTransUnit, ok := jobTransUnit(language, identifier)
+
+		if !ok {
+			continue
+		}
+
+		source, err := xliff.ParseMarkup(dbTransUnit.SourceMarkup)
+
+		if err != nil {
+			return err
+		}
+
+		content, err := parseSheetText(target, source)
+
+		if err != nil {
+			jww.WARN.Println("Target of " + identifier + " in sheet " + filePath + " is left out: " + err.Error())
+			continue
+		}
+
+		state := cell(row, "state")
+
+		if state == "" || (state == sheetState(dbTransUnit.State) && content.Markup() != dbTransUnit.TargetMarkup) {
+			state = "translated"
+		}
+
+		transUnit := xliff.TransUnit{
+			ID: identifier,
+			Target: xliff.Target{
+				Data:    content.Text(),
+				Content: content,
+				State:   state,
+			},
+		}
+
+		if err := pullTransUnit(language, &transUnit, written); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
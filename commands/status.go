@@ -0,0 +1,218 @@
+package commands
+
+import (
+	"errors"
+	"github.com/dragosv/delta/db"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var statusOutput string
+
+var statusCommand = &cobra.Command{
+	Use:   "status",
+	Short: "Status command Delta",
+	Long:  `Status command Delta. Prints the progress of the active jobs, by language.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fs = afero.NewOsFs()
+
+		var err error
+
+		database, err = openDatabase(databaseDialect, databaseConnection)
+		if err != nil {
+			return errors.New("failed to connect database " + err.Error())
+		}
+
+		return runStatusCommand(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCommand)
+
+	statusCommand.Flags().StringVarP(&statusOutput, "output", "o", "table", "Output format: table or json")
+}
+
+// jobStatus is the progress of a job.
+type jobStatus struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	// Age of the job, in seconds.
+	Age       int64            `json:"age"`
+	Languages []languageStatus `json:"languages"`
+}
+
+// languageStatus is the progress of the files of a language of a job. Words
+// are the words of the sources, and targets the units whose translation was
+// pulled, which are counted by state as well.
+type languageStatus struct {
+	Language string         `json:"language"`
+	Files    int            `json:"files"`
+	Units    int            `json:"units"`
+	Words    int            `json:"words"`
+	Targets  int            `json:"targets"`
+	States   map[string]int `json:"states"`
+}
+
+func runStatusCommand(output io.Writer) error {
+	if statusOutput != "table" && statusOutput != "json" {
+		return errors.New("unknown output " + statusOutput)
+	}
+
+	var dbJobs []db.Job
+
+	query := database.Where("active = ?", true)
+
+	if jobName != "" {
+		query = query.Where("name = ?", jobName)
+	}
+
+	query.Order("id").Find(&dbJobs)
+
+	if jobName != "" && len(dbJobs) == 0 {
+		return errors.New("active job " + jobName + " does not exist")
+	}
+
+	statuses := make([]jobStatus, 0, len(dbJobs))
+
+	for _, dbJob := range dbJobs {
+		statuses = append(statuses, statusOf(dbJob, time.Now()))
+	}
+
+	if statusOutput == "json" {
+		return writeJSON(output, statuses)
+	}
+
+	return printStatuses(output, statuses)
+}
+
+// statusOf returns the progress of dbJob at the given time.
+func statusOf(dbJob db.Job, now time.Time) jobStatus {
+	status := jobStatus{
+		Name:    dbJob.Name,
+		Created: dbJob.CreatedAt,
+		Age:     int64(now.Sub(dbJob.CreatedAt) / time.Second),
+	}
+
+	var dbFiles []db.File
+
+	database.Where("job_id = ?", dbJob.ID).Order("id").Find(&dbFiles)
+
+	languages := make(map[string]*languageStatus)
+
+	for _, dbFile := range dbFiles {
+		language, ok := languages[dbFile.Language]
+
+		if !ok {
+			language = &languageStatus{Language: dbFile.Language, States: make(map[string]int)}
+			languages[dbFile.Language] = language
+		}
+
+		language.Files++
+
+		var dbTransUnits []db.TransUnit
+
+		database.Where("file_id = ?", dbFile.ID).Find(&dbTransUnits)
+
+		for _, dbTransUnit := range dbTransUnits {
+			language.Units++
+			language.Words += len(strings.Fields(dbTransUnit.Source))
+
+			// Units may be pushed with a target, which is not returned
+			// until it is pulled.
+			if dbTransUnit.PulledAt != nil {
+				language.Targets++
+				language.States[dbTransUnit.State]++
+			}
+		}
+	}
+
+	for _, language := range languages {
+		status.Languages = append(status.Languages, *language)
+	}
+
+	sort.Slice(status.Languages, func(i, j int) bool {
+		return status.Languages[i].Language < status.Languages[j].Language
+	})
+
+	return status
+}
+
+// printStatuses prints statuses as a table, with a row for each language of
+// each job.
+func printStatuses(output io.Writer, statuses []jobStatus) error {
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+
+	io.WriteString(writer, "JOB\tAGE\tLANGUAGE\tFILES\tUNITS\tWORDS\tTARGETS\tSTATES\n")
+
+	for _, status := range statuses {
+		age := formatAge(time.Duration(status.Age) * time.Second)
+
+		if len(status.Languages) == 0 {
+			io.WriteString(writer, status.Name+"\t"+age+"\t\t0\t0\t0\t0\t\n")
+		}
+
+		for _, language := range status.Languages {
+			io.WriteString(writer, strings.Join([]string{
+				status.Name,
+				age,
+				language.Language,
+				strconv.Itoa(language.Files),
+				strconv.Itoa(language.Units),
+				strconv.Itoa(language.Words),
+				strconv.Itoa(language.Targets),
+				formatStates(language.States),
+			}, "\t")+"\n")
+		}
+	}
+
+	return writer.Flush()
+}
+
+// formatStates returns the counts of states, sorted by state, as
+// "translated: 2, needs-review-translation: 1".
+func formatStates(states map[string]int) string {
+	var names []string
+
+	for state := range states {
+		names = append(names, state)
+	}
+
+	sort.Strings(names)
+
+	var counts []string
+
+	for _, state := range names {
+		name := state
+		if name == "" {
+			name = "none"
+		}
+
+		counts = append(counts, name+": "+strconv.Itoa(states[state]))
+	}
+
+	return strings.Join(counts, ", ")
+}
+
+// formatAge returns age in days and hours, hours and minutes, or minutes.
+func formatAge(age time.Duration) string {
+	days := int(age / (24 * time.Hour))
+	hours := int(age/time.Hour) % 24
+	minutes := int(age/time.Minute) % 60
+
+	switch {
+	case days > 0:
+		return strconv.Itoa(days) + "d" + strconv.Itoa(hours) + "h"
+	case hours > 0:
+		return strconv.Itoa(hours) + "h" + strconv.Itoa(minutes) + "m"
+	}
+
+	return strconv.Itoa(minutes) + "m"
+}
@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"errors"
+	"github.com/dragosv/delta/format"
+	"github.com/dragosv/delta/xliff"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"strconv"
+)
+
+var severity string
+
+var validateCommand = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate command Delta",
+	Long:  `Validate command Delta. Reports the problems found in the XLIFF files of the source directory.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fs = afero.NewOsFs()
+
+		return runValidateCommand(source)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCommand)
+
+	validateCommand.Flags().StringVarP(&severity, "severity", "", "warning", "Lowest severity reported: info, warning or error")
+}
+
+func runValidateCommand(source string) error {
+	jww.FEEDBACK.Println("Running validate...")
+
+	var lowest xliff.Severity
+
+	switch severity {
+	case "info":
+		lowest = xliff.SeverityInfo
+	case "warning":
+		lowest = xliff.SeverityWarning
+	case "error":
+		lowest = xliff.SeverityError
+	default:
+		return errors.New("unknown severity " + severity)
+	}
+
+	err := loadFileRules()
+
+	if err != nil {
+		return err
+	}
+
+	sourcePaths = nil
+
+	afero.Walk(fs, source, sourceWalkFunc)
+
+	count := printDiagnostics(validateSourceDocuments(sourcePaths), lowest)
+
+	if count > 0 {
+		return errors.New(strconv.Itoa(count) + " validation errors found")
+	}
+
+	return nil
+}
+
+// validateSourceDocuments returns the diagnostics of the documents at paths.
+func validateSourceDocuments(paths []string) []xliff.ValidationError {
+	var diagnostics []xliff.ValidationError
+
+	for _, path := range paths {
+		input, err := fs.Open(path)
+
+		if err != nil {
+			diagnostics = append(diagnostics, xliff.ValidationError{
+				Code:     xliff.MalformedDocument,
+				Severity: xliff.SeverityError,
+				Message:  "Document cannot be opened: " + err.Error(),
+				Path:     path,
+			})
+			continue
+		}
+
+		for _, diagnostic := range format.Validate(formatOf(path), input) {
+			diagnostic.Path = path
+			diagnostics = append(diagnostics, diagnostic)
+		}
+
+		input.Close()
+	}
+
+	return diagnostics
+}
+
+// printDiagnostics prints the diagnostics of the lowest severity or above,
+// and returns the number of errors among them.
+func printDiagnostics(diagnostics []xliff.ValidationError, lowest xliff.Severity) int {
+	var count int
+
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity < lowest {
+			continue
+		}
+
+		if diagnostic.Severity == xliff.SeverityError {
+			count++
+		}
+
+		jww.FEEDBACK.Println(diagnostic.Error())
+	}
+
+	return count
+}
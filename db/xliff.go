@@ -1,6 +1,9 @@
 package db
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/mssql"
 	_ "github.com/jinzhu/gorm/dialects/mysql"
@@ -8,9 +11,40 @@ import (
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
+// Statuses of the jobs that are no longer active.
+const (
+	JobPulled   = "pulled"
+	JobCanceled = "canceled"
+	JobClosed   = "closed"
+)
+
 type Job struct {
 	gorm.Model
+	Name   string
 	Active bool
+	// Status and end time of a job that is no longer active.
+	Status   string
+	ClosedAt *time.Time
+}
+
+// Returns the status of the job: active, or how it ended.
+func (job Job) State() string {
+	if job.Active {
+		return "active"
+	}
+
+	return job.Status
+}
+
+// Ends job with the given status.
+func EndJob(database *gorm.DB, job *Job, status string) error {
+	now := time.Now()
+
+	job.Active = false
+	job.Status = status
+	job.ClosedAt = &now
+
+	return database.Save(job).Error
 }
 
 type File struct {
@@ -28,22 +62,46 @@ type Identifier struct {
 	Data      string
 	Qualifier string
 	Path      string
+	GroupPath string
 }
 
 type TransUnit struct {
 	gorm.Model
-	FileID         uint
-	File           File
-	Resname        string
-	Path           string
-	Identifier     string
-	Qualifier      string
-	State          string
-	StateQualifier string
-	Source         string
-	Target         string
-	SourceLanguage string
-	TargetLanguage string
+	FileID          uint
+	File            File
+	Resname         string
+	Path            string
+	GroupPath       string
+	Identifier      string
+	Qualifier       string
+	State           string
+	StateQualifier  string
+	Source          string
+	Target          string
+	SourceMarkup    string
+	TargetMarkup    string
+	SegSourceMarkup string
+	SourceLanguage  string
+	TargetLanguage  string
+	// Hash of the path of the source language file the unit comes from, its
+	// target language, group path, qualifier and source markup, to find it
+	// in other jobs.
+	Hash string
+	// Time the job file holding the pulled target was written, if any.
+	PulledAt *time.Time
+	// Markup of the target last written to the source file.
+	WrittenMarkup string
+}
+
+type Segment struct {
+	gorm.Model
+	TransUnitID  uint
+	TransUnit    TransUnit
+	Identifier   string
+	Source       string
+	Target       string
+	SourceMarkup string
+	TargetMarkup string
 }
 
 type Note struct {
@@ -68,7 +126,37 @@ func OpenDatabase(databaseDialect string, databaseConnection string) (database *
 	database.AutoMigrate(&Identifier{})
 	database.AutoMigrate(&File{})
 	database.AutoMigrate(&TransUnit{})
+	database.AutoMigrate(&Segment{})
 	database.AutoMigrate(&Note{})
 
+	err = migrateJobs(database)
+
 	return
 }
+
+// Fills in the names and statuses of jobs created before jobs had them:
+// jobs are named by their ID, as their folders are, and ended jobs are
+// taken as pulled, the only way jobs could end then.
+func migrateJobs(database *gorm.DB) error {
+	var jobs []Job
+
+	err := database.Unscoped().Where("name = ? or name is null", "").Find(&jobs).Error
+
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		name := strconv.FormatUint(uint64(job.ID), 10)
+
+		err = database.Unscoped().Model(&job).UpdateColumn("name", name).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return database.Unscoped().Model(&Job{}).
+		Where("(active = ? or active is null) and (status = ? or status is null)", false, "").
+		UpdateColumn("status", JobPulled).Error
+}
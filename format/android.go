@@ -0,0 +1,782 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// Android reads and writes Android string resources, the XML files of the
+// values folders of an app. A string is a trans-unit whose id is its name.
+// A string array is a group of that name holding a trans-unit for each
+// item, numbered from 0, and plurals are a group holding a trans-unit for
+// each plural category of the target language. Strings that are not
+// translatable, and items that refer to other resources, are left out.
+// The comment before a string is a note from "developer".
+//
+// The language of a file is told by the qualifier of its folder, values
+// being the folder of the source language. Strings are unescaped, and the
+// tags, comments and CDATA sections of those holding markup are inline
+// codes. A string that is a CDATA section is translated within it.
+//
+// Translations are written in place of the strings of a file, comments and
+// ordering being kept, and strings missing from it are added at its end.
+type Android struct{}
+
+func init() {
+	Register(Android{})
+}
+
+func (Android) Name() string {
+	return "android"
+}
+
+func (Android) Extensions() []string {
+	return []string{".xml"}
+}
+
+// Returns true if the file at path is in a values folder of a language.
+func (a Android) Match(path string) bool {
+	_, ok := a.Language(path)
+	return ok
+}
+
+func (Android) Sniff(data []byte) bool {
+	return xmlRoot(data) == "resources"
+}
+
+func (Android) Language(path string) (string, bool) {
+	folder := filepath.Base(filepath.Dir(path))
+
+	if folder == "values" {
+		return "", true
+	}
+
+	if !strings.HasPrefix(folder, "values-") {
+		return "", false
+	}
+
+	return androidLanguage(strings.TrimPrefix(folder, "values-"))
+}
+
+func (Android) SourcePath(path string, sourceLanguage string) string {
+	return filepath.Join(filepath.Dir(filepath.Dir(path)), "values", filepath.Base(path))
+}
+
+func (a Android) Read(input io.Reader, fn xliff.WalkFunc) error {
+	_, err := readResources(a, input, nil, "xml", fn)
+	return err
+}
+
+func (a Android) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return readResources(a, input, output, "xml", fn)
+}
+
+func (a Android) ReadTranslation(source io.Reader, target io.Reader, language string, fn xliff.WalkFunc) error {
+	return readTranslation(a, source, target, language, "xml", fn)
+}
+
+func (a Android) WriteTranslation(source io.Reader, target io.Reader, output io.Writer, language string, fn xliff.WalkFunc) (bool, error) {
+	return writeTranslation(a, source, target, output, language, "xml", fn)
+}
+
+const androidFile = "<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<resources>\n</resources>\n"
+
+func (Android) decode(data []byte) (*resourceFile, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte(androidFile)
+	}
+
+	f := &resourceFile{
+		data:      data,
+		groupEnds: make(map[string]int),
+		newline:   detectNewline(data),
+	}
+
+	r := &androidReader{newXMLResourceReader(f, "android")}
+
+	if err := r.read(); err != nil {
+		return nil, err
+	}
+
+	if f.indent == "" {
+		f.indent = "    "
+	}
+
+	return f, nil
+}
+
+func (Android) encode(f *resourceFile, r resource, value string) string {
+	// References to other resources are copied as written.
+	if r.markup && !r.translate {
+		return value
+	}
+
+	if r.inline {
+		return androidMarkup(value, r.content, r.cdata)
+	}
+
+	return androidEscape(value)
+}
+
+func (a Android) insert(f *resourceFile, resources []resource) []edit {
+	var edits []edit
+
+	for i := 0; i < len(resources); {
+		r := resources[i]
+
+		if r.group() == nil {
+			element := "<string name=\"" + escapeAttribute(r.id) + "\">" + a.encode(f, r, r.value) + "</string>"
+			edits = append(edits, edit{from: f.end, to: f.end, text: f.indent + element + f.newline})
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < len(resources) && resources[end].group() == r.group() {
+			end++
+		}
+
+		var items string
+
+		for _, item := range resources[i:end] {
+			element := "<item>"
+			if item.plural {
+				element = "<item quantity=\"" + escapeAttribute(item.id) + "\">"
+			}
+
+			items += f.indent + f.indent + element + a.encode(f, item, item.value) + "</item>" + f.newline
+		}
+
+		if offset, ok := f.groupEnds[r.group().ID]; ok {
+			edits = append(edits, edit{from: offset, to: offset, text: items})
+		} else {
+			name := "string-array"
+			if r.plural {
+				name = "plurals"
+			}
+
+			text := f.indent + "<" + name + " name=\"" + escapeAttribute(r.group().ID) + "\">" + f.newline +
+				items + f.indent + "</" + name + ">" + f.newline
+
+			edits = append(edits, edit{from: f.end, to: f.end, text: text})
+		}
+
+		i = end
+	}
+
+	return edits
+}
+
+// androidReader reads the resources of a file.
+type androidReader struct {
+	xmlResourceReader
+}
+
+// read reads the resources element and what it holds.
+func (r *androidReader) read() error {
+	root := false
+
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			if !root {
+				return r.syntaxError("no resources element")
+			}
+
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if root {
+				return r.syntaxError("element " + t.Name.Local + " outside of resources")
+			}
+
+			if t.Name.Local != "resources" {
+				return r.syntaxError("root element is " + t.Name.Local + ", not resources")
+			}
+
+			root = true
+
+			if r.selfClosing() {
+				r.expand(t)
+				return r.read()
+			}
+
+			if err := r.resources(); err != nil {
+				return err
+			}
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return r.syntaxError("text outside of resources")
+			}
+		}
+	}
+}
+
+// resources reads the members of the resources element.
+func (r *androidReader) resources() error {
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return r.syntaxError("resources element is not closed")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if r.file.indent == "" {
+				r.file.indent = string(r.file.data[lineStart(r.file.data, r.offset):r.offset])
+			}
+
+			switch t.Name.Local {
+			case "string":
+				err = r.string(t)
+			case "string-array", "plurals":
+				err = r.group(t)
+			default:
+				err = r.skip()
+			}
+
+			if err != nil {
+				return err
+			}
+
+			r.comment = ""
+		case xml.EndElement:
+			r.file.end = lineStart(r.file.data, r.offset)
+			return nil
+		case xml.Comment:
+			r.comment = strings.TrimSpace(string(t))
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				r.comment = ""
+			}
+		}
+	}
+}
+
+// string reads a string element.
+func (r *androidReader) string(start xml.StartElement) error {
+	name := androidAttribute(start, "name")
+
+	if name == "" {
+		return r.syntaxError("string without a name")
+	}
+
+	if product := androidAttribute(start, "product"); product != "" {
+		name += "#" + product
+	}
+
+	resource, err := r.value(start, name)
+
+	if err != nil {
+		return err
+	}
+
+	resource.translate = resource.translate && androidAttribute(start, "translatable") != "false"
+	r.file.resources = append(r.file.resources, resource)
+
+	return nil
+}
+
+// group reads a string-array or plurals element.
+func (r *androidReader) group(start xml.StartElement) error {
+	name := androidAttribute(start, "name")
+
+	if name == "" {
+		return r.syntaxError(start.Name.Local + " without a name")
+	}
+
+	if r.selfClosing() {
+		return r.skip()
+	}
+
+	group := &xliff.Group{ID: name, Resname: name}
+	translatable := androidAttribute(start, "translatable") != "false"
+	plural := start.Name.Local == "plurals"
+	count := 0
+
+	if !translatable {
+		group.Translate = "no"
+	}
+
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return r.syntaxError(start.Name.Local + " element is not closed")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "item" {
+				return r.syntaxError("element " + t.Name.Local + " in " + start.Name.Local)
+			}
+
+			id := strconv.Itoa(count)
+			if plural {
+				id = androidAttribute(t, "quantity")
+			}
+
+			resource, err := r.value(t, id)
+
+			if err != nil {
+				return err
+			}
+
+			resource.groups = []*xliff.Group{group}
+			resource.plural = plural
+			resource.translate = resource.translate && translatable
+			r.file.resources = append(r.file.resources, resource)
+			count++
+		case xml.EndElement:
+			r.file.groupEnds[name] = lineStart(r.file.data, r.offset)
+			return nil
+		case xml.Comment:
+			r.comment = strings.TrimSpace(string(t))
+		}
+	}
+}
+
+// value reads the value of the element started by start as a resource.
+// References to other resources are kept as written.
+func (r *androidReader) value(start xml.StartElement, id string) (resource, error) {
+	result, err := r.xmlResourceReader.value(start, id)
+
+	if err != nil {
+		return result, err
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(r.file.data[result.from:result.to])), "@") {
+		result.markup = true
+		result.translate = false
+		result.value = string(r.file.data[result.from:result.to])
+	} else if result.markup {
+		result.inline = true
+		result.content, result.cdata = androidContent(result.value)
+	} else {
+		result.value = androidUnescape(result.value)
+	}
+
+	return result, nil
+}
+
+// androidAttribute returns the value of the attribute of element with the
+// given local name.
+func androidAttribute(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name && attr.Name.Space == "" {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// androidLanguage returns the language of the qualifier of a values folder,
+// as values-fr, values-pt-rBR or values-b+sr+Latn have them.
+func androidLanguage(qualifier string) (string, bool) {
+	if strings.HasPrefix(qualifier, "b+") {
+		parts := strings.Split(strings.TrimPrefix(qualifier, "b+"), "+")
+
+		if !isLanguageCode(parts[0]) {
+			return "", false
+		}
+
+		return strings.Join(parts, "-"), true
+	}
+
+	parts := strings.Split(qualifier, "-")
+
+	// car is the qualifier of a UI mode rather than a language.
+	if len(parts) > 2 || !isLanguageCode(parts[0]) || parts[0] == "car" {
+		return "", false
+	}
+
+	if len(parts) == 1 {
+		return parts[0], true
+	}
+
+	region := parts[1]
+
+	if len(region) != 3 || region[0] != 'r' || !isRegionCode(region[1:]) {
+		return "", false
+	}
+
+	return parts[0] + "-" + region[1:], true
+}
+
+// isLanguageCode returns true if code is an ISO 639 code of two or three
+// lowercase letters.
+func isLanguageCode(code string) bool {
+	if len(code) < 2 || len(code) > 3 {
+		return false
+	}
+
+	for _, c := range code {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isRegionCode returns true if code is an ISO 3166 code of two uppercase
+// letters.
+func isRegionCode(code string) bool {
+	return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
+}
+
+// androidUnescape returns the text of a string as Android reads it: escaped
+// characters are unescaped and double quotes left out.
+func androidUnescape(text string) string {
+	var result strings.Builder
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		if c == '"' {
+			continue
+		}
+
+		if c != '\\' || i+1 == len(text) {
+			result.WriteByte(c)
+			continue
+		}
+
+		i++
+
+		switch text[i] {
+		case 'n':
+			result.WriteByte('\n')
+		case 't':
+			result.WriteByte('\t')
+		case 'u':
+			if i+5 <= len(text) {
+				if code, err := strconv.ParseUint(text[i+1:i+5], 16, 32); err == nil {
+					result.WriteRune(rune(code))
+					i += 4
+					continue
+				}
+			}
+
+			result.WriteByte('u')
+		default:
+			result.WriteByte(text[i])
+		}
+	}
+
+	return result.String()
+}
+
+// Inline tags Android styles strings with, which are codes within CDATA
+// sections.
+var androidTags = map[string]bool{
+	"a": true, "annotation": true, "b": true, "big": true, "br": true, "em": true, "font": true, "i": true,
+	"li": true, "ol": true, "p": true, "s": true, "small": true, "span": true, "strike": true, "strong": true,
+	"sub": true, "sup": true, "tt": true, "u": true, "ul": true, "xliff:g": true,
+}
+
+// androidContent returns the content of the raw XML of a string holding
+// markup, its tags, comments and CDATA sections being inline codes whose
+// native code is the tag as written. A string that is a CDATA section is
+// given as the content of the section, the tags Android knows being codes,
+// and true.
+func androidContent(raw string) (xliff.Content, bool) {
+	if strings.HasPrefix(raw, "<![CDATA[") && strings.Index(raw, "]]>") == len(raw)-len("]]>") {
+		return androidCodes(raw[len("<![CDATA["):len(raw)-len("]]>")], true), true
+	}
+
+	return androidCodes(raw, false), false
+}
+
+// androidCodes returns the content of markup, with its tags as codes. Text
+// is unescaped, and its entities decoded unless it is within a CDATA
+// section, where only the tags Android knows are codes.
+func androidCodes(markup string, cdata bool) xliff.Content {
+	var content xliff.Content
+	var text strings.Builder
+	var open []string
+
+	codes := 0
+
+	flush := func() {
+		if text.Len() > 0 {
+			content = append(content, xliff.Inline{Kind: xliff.InlineText, Text: androidUnescape(text.String())})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(markup); i++ {
+		c := markup[i]
+		rest := markup[i:]
+
+		switch {
+		case c == '<':
+			end := androidMarkupEnd(rest)
+
+			if end == 0 && !cdata {
+				end = strings.IndexByte(rest, '>') + 1
+			}
+
+			if end == 0 {
+				text.WriteByte(c)
+				continue
+			}
+
+			tag := rest[:end]
+			i += end - 1
+			flush()
+
+			code := xliff.Inline{Kind: xliff.InlinePlaceholder, Name: "ph", Content: xliff.TextContent(tag)}
+
+			switch {
+			case strings.HasPrefix(tag, "<!") || strings.HasPrefix(tag, "<?") || strings.HasSuffix(tag, "/>"):
+				codes++
+				code.ID = strconv.Itoa(codes)
+			case strings.HasPrefix(tag, "</") && len(open) > 0:
+				code.Kind, code.Name, code.ID = xliff.InlineClosing, "ept", open[len(open)-1]
+				open = open[:len(open)-1]
+			case strings.HasPrefix(tag, "</"):
+				codes++
+				code.Kind, code.Name, code.ID = xliff.InlineClosing, "ept", strconv.Itoa(codes)
+			default:
+				codes++
+				code.Kind, code.Name, code.ID = xliff.InlineOpening, "bpt", strconv.Itoa(codes)
+				open = append(open, code.ID)
+			}
+
+			content = append(content, code)
+		case c == '&' && !cdata:
+			if end := strings.IndexByte(rest, ';'); end > 1 && isEntity(rest[1:end]) {
+				text.WriteString(xmlEntity(rest[1:end]))
+				i += end
+			} else {
+				text.WriteByte(c)
+			}
+		default:
+			text.WriteByte(c)
+		}
+	}
+
+	flush()
+
+	return content
+}
+
+// androidMarkup returns the raw XML of a string holding markup, from the
+// markup of its content. Codes are written as their native code, or that of
+// the code of source with the same id when they have none, and text is
+// escaped. The string is written as a CDATA section if cdata is set.
+func androidMarkup(markup string, source xliff.Content, cdata bool) string {
+	content, err := xliff.ParseMarkup(markup)
+
+	if err != nil {
+		content = xliff.TextContent(markup)
+	}
+
+	natives := make(map[string]string)
+
+	for _, code := range source.Elements() {
+		natives[strconv.Itoa(int(code.Kind))+"/"+code.ID] = code.Content.Text()
+	}
+
+	var result strings.Builder
+	var write func(content xliff.Content)
+
+	write = func(content xliff.Content) {
+		for _, inline := range content {
+			switch inline.Kind {
+			case xliff.InlineText:
+				if cdata {
+					result.WriteString(androidEscapeCDATA(inline.Text))
+				} else {
+					result.WriteString(androidEscape(inline.Text))
+				}
+			case xliff.InlinePaired, xliff.InlineMarker, xliff.InlineOther:
+				write(inline.Content)
+			default:
+				if native := inline.Content.Text(); native != "" {
+					result.WriteString(native)
+				} else {
+					result.WriteString(natives[strconv.Itoa(int(inline.Kind))+"/"+inline.ID])
+				}
+			}
+		}
+	}
+
+	write(content)
+
+	if cdata {
+		return "<![CDATA[" + result.String() + "]]>"
+	}
+
+	return result.String()
+}
+
+// androidMarkupEnd returns the length of the inline tag, comment or CDATA
+// section markup starts with, or 0.
+func androidMarkupEnd(markup string) int {
+	for _, delimiters := range [][2]string{{"<!--", "-->"}, {"<![CDATA[", "]]>"}} {
+		if strings.HasPrefix(markup, delimiters[0]) {
+			if end := strings.Index(markup, delimiters[1]); end >= 0 {
+				return end + len(delimiters[1])
+			}
+
+			return 0
+		}
+	}
+
+	end := strings.IndexAny(markup[1:], "<>") + 1
+	if end == 0 || markup[end] != '>' {
+		return 0
+	}
+
+	name := strings.TrimPrefix(strings.TrimSuffix(markup[1:end], "/"), "/")
+	if index := strings.IndexAny(name, " \t\r\n"); index >= 0 {
+		name = name[:index]
+	}
+
+	if !androidTags[strings.ToLower(name)] {
+		return 0
+	}
+
+	return end + 1
+}
+
+// isEntity returns true if name is the name of an entity XML predefines or
+// a character reference.
+func isEntity(name string) bool {
+	switch name {
+	case "amp", "lt", "gt", "quot", "apos":
+		return true
+	}
+
+	if strings.HasPrefix(name, "#x") {
+		_, err := strconv.ParseUint(name[2:], 16, 32)
+		return err == nil
+	}
+
+	if strings.HasPrefix(name, "#") {
+		_, err := strconv.ParseUint(name[1:], 10, 32)
+		return err == nil
+	}
+
+	return false
+}
+
+// xmlEntity returns the text of the entity XML predefines or character
+// reference of the given name, as isEntity takes it.
+func xmlEntity(name string) string {
+	switch name {
+	case "amp":
+		return "&"
+	case "lt":
+		return "<"
+	case "gt":
+		return ">"
+	case "quot":
+		return "\""
+	case "apos":
+		return "'"
+	}
+
+	base, digits := 10, name[1:]
+
+	if strings.HasPrefix(name, "#x") {
+		base, digits = 16, name[2:]
+	}
+
+	code, _ := strconv.ParseUint(digits, base, 32)
+
+	return string(rune(code))
+}
+
+// androidEscapeCDATA returns text escaped as the value of a string within
+// a CDATA section, where markup is not escaped.
+func androidEscapeCDATA(text string) string {
+	var result strings.Builder
+
+	for i, c := range text {
+		switch c {
+		case '\\', '\'', '"':
+			result.WriteRune('\\')
+			result.WriteRune(c)
+		case '\n':
+			result.WriteString(`\n`)
+		case '\t':
+			result.WriteString(`\t`)
+		case '@', '?':
+			if i == 0 {
+				result.WriteRune('\\')
+			}
+
+			result.WriteRune(c)
+		default:
+			result.WriteRune(c)
+		}
+	}
+
+	return strings.Replace(result.String(), "]]>", "]]]]><![CDATA[>", -1)
+}
+
+// androidEscape returns text escaped as the value of a string.
+func androidEscape(text string) string {
+	var result strings.Builder
+
+	for i, c := range text {
+		switch c {
+		case '\\', '\'', '"':
+			result.WriteRune('\\')
+			result.WriteRune(c)
+		case '\n':
+			result.WriteString(`\n`)
+		case '\t':
+			result.WriteString(`\t`)
+		case '@', '?':
+			if i == 0 {
+				result.WriteRune('\\')
+			}
+
+			result.WriteRune(c)
+		case '&':
+			result.WriteString("&amp;")
+		case '<':
+			result.WriteString("&lt;")
+		default:
+			if unicode.IsControl(c) {
+				result.WriteString(`\u` + strconv.FormatInt(int64(c)+0x10000, 16)[1:])
+			} else {
+				result.WriteRune(c)
+			}
+		}
+	}
+
+	return result.String()
+}
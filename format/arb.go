@@ -0,0 +1,154 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// ARB reads and writes the Application Resource Bundles of Flutter, as
+// app_xx.arb. A message is a trans-unit whose id is its key, and the
+// description of the metadata of its @key is a note from "developer".
+// Messages are ICU messages, whose translations have to keep the arguments,
+// plurals and selects of their sources to be written.
+//
+// The language of a file is told by its @@locale, or else by the suffix of
+// its name.
+//
+// Translations are written in place of the messages of a file, and the
+// messages missing from it are added at its end.
+type ARB struct{}
+
+func init() {
+	Register(ARB{})
+}
+
+func (ARB) Name() string {
+	return "arb"
+}
+
+func (ARB) Extensions() []string {
+	return []string{".arb"}
+}
+
+func (ARB) Sniff(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) && bytes.Contains(data, []byte(`"@@locale"`))
+}
+
+func (ARB) Language(path string) (string, bool) {
+	_, language := propertiesLocale(path)
+	return language, language != ""
+}
+
+func (ARB) SourcePath(path string, sourceLanguage string) string {
+	base, _ := propertiesLocale(path)
+	return filepath.Join(filepath.Dir(path), base+"_"+strings.Replace(sourceLanguage, "-", "_", -1)+filepath.Ext(path))
+}
+
+func (ARB) ContentLanguage(input io.Reader) (string, bool) {
+	var bundle struct {
+		Locale string `json:"@@locale"`
+	}
+
+	if err := json.NewDecoder(input).Decode(&bundle); err != nil || bundle.Locale == "" {
+		return "", false
+	}
+
+	return strings.Replace(bundle.Locale, "_", "-", -1), true
+}
+
+func (ARB) ValidateTarget(source string, target string) error {
+	return CheckMessage(source, target)
+}
+
+func (a ARB) Read(input io.Reader, fn xliff.WalkFunc) error {
+	_, err := readResources(a, input, nil, "plaintext", fn)
+	return err
+}
+
+func (a ARB) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return readResources(a, input, output, "plaintext", fn)
+}
+
+func (a ARB) ReadTranslation(source io.Reader, target io.Reader, language string, fn xliff.WalkFunc) error {
+	return readTranslation(a, source, target, language, "plaintext", fn)
+}
+
+// WriteTranslation starts a file with no messages yet with the @@locale of
+// language.
+func (a ARB) WriteTranslation(source io.Reader, target io.Reader, output io.Writer, language string, fn xliff.WalkFunc) (bool, error) {
+	var data []byte
+
+	if target != nil {
+		var err error
+
+		data, err = ioutil.ReadAll(target)
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("{\n  \"@@locale\": " + strconv.Quote(strings.Replace(language, "-", "_", -1)) + "\n}\n")
+	}
+
+	return writeTranslation(a, source, bytes.NewReader(data), output, language, "plaintext", fn)
+}
+
+func (ARB) decode(data []byte) (*resourceFile, error) {
+	f, err := JSON{}.decode(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	descriptions := make(map[string]string)
+
+	for _, r := range f.resources {
+		if len(r.path) == 2 && strings.HasPrefix(r.path[0], "@") && r.path[1] == "description" {
+			descriptions[r.path[0][1:]] = r.value
+		}
+	}
+
+	var resources []resource
+
+	for _, r := range f.resources {
+		if len(r.path) != 1 || strings.HasPrefix(r.path[0], "@") {
+			continue
+		}
+
+		r.groups = nil
+		r.plural = false
+		r.id = r.path[0]
+
+		if description := descriptions[r.id]; description != "" {
+			r.notes = []xliff.Note{{Data: description, From: "developer"}}
+		}
+
+		resources = append(resources, r)
+	}
+
+	f.resources = resources
+	f.groupEnds = make(map[string]int)
+
+	return f, nil
+}
+
+func (ARB) encode(f *resourceFile, r resource, value string) string {
+	return JSON{}.encode(f, r, value)
+}
+
+func (ARB) insert(f *resourceFile, resources []resource) []edit {
+	return JSON{}.insert(f, resources)
+}
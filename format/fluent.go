@@ -0,0 +1,386 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// Fluent reads and writes the FTL files of Project Fluent. The value of a
+// message or a term is a trans-unit whose id is the identifier of the
+// message, and each of its attributes a trans-unit whose id is the
+// identifier and the name of the attribute joined by a dot. Values are
+// patterns as written, placeables and selectors included, with the
+// indentation of their lines removed. The comment before a message is a
+// note from "developer" of its units.
+//
+// The language of a file is told by its folder, as locales/fr/main.ftl.
+//
+// Translations are written in place of the values of a file, and the
+// values missing from it are added to their messages, or at its end.
+type Fluent struct{}
+
+func init() {
+	Register(Fluent{})
+}
+
+func (Fluent) Name() string {
+	return "fluent"
+}
+
+func (Fluent) Extensions() []string {
+	return []string{".ftl"}
+}
+
+func (Fluent) Language(path string) (string, bool) {
+	_, language := fluentLocale(path)
+	return language, language != ""
+}
+
+func (Fluent) SourcePath(path string, sourceLanguage string) string {
+	index, language := fluentLocale(path)
+
+	if language == "" {
+		return path
+	}
+
+	return path[:index] + sourceLanguage + path[index+len(language):]
+}
+
+// fluentLocale returns the offset in path and the language of the innermost
+// folder of path that is a language.
+func fluentLocale(path string) (int, string) {
+	for folder := filepath.Dir(path); folder != filepath.Dir(folder); folder = filepath.Dir(folder) {
+		if name := filepath.Base(folder); isLanguageTag(name) {
+			return len(folder) - len(name), name
+		}
+	}
+
+	return 0, ""
+}
+
+func (fl Fluent) Read(input io.Reader, fn xliff.WalkFunc) error {
+	_, err := readResources(fl, input, nil, "plaintext", fn)
+	return err
+}
+
+func (fl Fluent) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return readResources(fl, input, output, "plaintext", fn)
+}
+
+func (fl Fluent) ReadTranslation(source io.Reader, target io.Reader, language string, fn xliff.WalkFunc) error {
+	return readTranslation(fl, source, target, language, "plaintext", fn)
+}
+
+func (fl Fluent) WriteTranslation(source io.Reader, target io.Reader, output io.Writer, language string, fn xliff.WalkFunc) (bool, error) {
+	return writeTranslation(fl, source, target, output, language, "plaintext", fn)
+}
+
+var (
+	fluentMessage   = regexp.MustCompile(`^(-?[a-zA-Z][a-zA-Z0-9_-]*)[ \t]*=`)
+	fluentAttribute = regexp.MustCompile(`^([ \t]+)\.([a-zA-Z][a-zA-Z0-9_-]*)[ \t]*=`)
+)
+
+func (Fluent) decode(data []byte) (*resourceFile, error) {
+	f := &resourceFile{
+		data:      data,
+		end:       len(data),
+		groupEnds: make(map[string]int),
+		objects:   make(map[string]*object),
+		indent:    "    ",
+		newline:   detectNewline(data),
+	}
+
+	p := &fluentParser{data: data}
+	indented := false
+
+	var comments []string
+
+	for p.offset < len(data) {
+		line := p.line()
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			comments = nil
+			p.next()
+		case line == "#" || strings.HasPrefix(line, "# "):
+			comments = append(comments, strings.TrimPrefix(line[1:], " "))
+			p.next()
+		case fluentMessage.MatchString(line):
+			match := fluentMessage.FindStringSubmatchIndex(line)
+			id := line[match[2]:match[3]]
+			o := &object{start: p.offset + match[1], depth: 1}
+
+			var notes []xliff.Note
+			if len(comments) > 0 {
+				notes = []xliff.Note{{Data: strings.Join(comments, "\n"), From: "developer"}}
+				comments = nil
+			}
+
+			if r, ok := p.pattern(o.start); ok {
+				r.id, r.path, r.notes = id, []string{id}, notes
+				f.resources = append(f.resources, r)
+			}
+
+			for {
+				match := fluentAttribute.FindStringSubmatchIndex(p.line())
+
+				if match == nil {
+					break
+				}
+
+				line := p.line()
+
+				if !indented {
+					f.indent, indented = line[match[2]:match[3]], true
+				}
+
+				name := line[match[4]:match[5]]
+
+				if r, ok := p.pattern(p.offset + match[1]); ok {
+					r.id, r.path, r.notes = id+"."+name, []string{id, name}, notes
+					f.resources = append(f.resources, r)
+				}
+			}
+
+			o.last = p.offset
+			f.objects[id] = o
+		default:
+			// Group and resource comments, and junk.
+			comments = nil
+			p.next()
+		}
+	}
+
+	return f, nil
+}
+
+func (Fluent) encode(f *resourceFile, r resource, value string) string {
+	if value == "" {
+		return `{ "" }`
+	}
+
+	lines := strings.Split(value, "\n")
+
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = f.indent + lines[i]
+		}
+	}
+
+	return strings.Join(lines, f.newline)
+}
+
+func (fl Fluent) insert(f *resourceFile, resources []resource) []edit {
+	var edits []edit
+	var text string
+
+	if len(f.data) > 0 && !bytes.HasSuffix(f.data, []byte("\n")) {
+		text = f.newline
+	}
+
+	messages := make(map[string]bool)
+
+	for _, r := range resources {
+		message := r.path[0]
+		value := fl.encode(f, r, r.value)
+
+		if o, ok := f.objects[message]; ok {
+			if len(r.path) == 1 {
+				edits = append(edits, edit{from: o.start, to: o.start, text: " " + value})
+				continue
+			}
+
+			line := f.indent + "." + r.path[1] + " = " + value + f.newline
+
+			if o.last == len(f.data) && !bytes.HasSuffix(f.data, []byte("\n")) {
+				line = f.newline + line
+			}
+
+			edits = append(edits, edit{from: o.last, to: o.last, text: line})
+
+			continue
+		}
+
+		if len(r.path) == 1 {
+			text += message + " = " + value + f.newline
+		} else {
+			if !messages[message] {
+				text += message + " =" + f.newline
+			}
+
+			text += f.indent + "." + r.path[1] + " = " + value + f.newline
+		}
+
+		messages[message] = true
+	}
+
+	if strings.TrimSpace(text) != "" {
+		edits = append(edits, edit{from: f.end, to: f.end, text: text})
+	}
+
+	return edits
+}
+
+// fluentParser reads the lines of an FTL file.
+type fluentParser struct {
+	data   []byte
+	offset int
+}
+
+// line returns the line at the offset, without its line ending.
+func (p *fluentParser) line() string {
+	end := bytes.IndexByte(p.data[p.offset:], '\n')
+
+	if end < 0 {
+		end = len(p.data) - p.offset
+	}
+
+	return strings.TrimSuffix(string(p.data[p.offset:p.offset+end]), "\r")
+}
+
+// next moves the offset to the start of the next line.
+func (p *fluentParser) next() {
+	end := bytes.IndexByte(p.data[p.offset:], '\n')
+
+	if end < 0 {
+		p.offset = len(p.data)
+	} else {
+		p.offset += end + 1
+	}
+}
+
+// isFluentContinuation returns true if line is a line of the pattern before it:
+// an indented line that is not an attribute, or a line closing a placeable
+// left open at the given depth, indented or not.
+func isFluentContinuation(line string, depth int) bool {
+	if depth > 0 && isFluentClosing(line) {
+		return true
+	}
+
+	return (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) &&
+		strings.TrimSpace(line) != "" && !fluentAttribute.MatchString(line)
+}
+
+// isFluentClosing returns true if line starts with the end of a placeable.
+func isFluentClosing(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " \t"), "}")
+}
+
+// fluentDepth returns the depth of the placeables open after line, starting
+// at the given depth. Braces in string literals are left out.
+func fluentDepth(depth int, line string) int {
+	quoted := false
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quoted && c == '\\':
+			i++
+		case depth > 0 && c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		}
+	}
+
+	return depth
+}
+
+// pattern reads the pattern starting at offset, on the line at the offset
+// of the parser, and the lines that continue it, and returns it as a
+// resource, or false if it is empty. The parser is moved to the line after
+// the pattern.
+func (p *fluentParser) pattern(offset int) (resource, bool) {
+	rest := p.line()[offset-p.offset:]
+	inline := strings.TrimLeft(rest, " \t")
+	from := offset + len(rest) - len(inline)
+	inline = strings.TrimRight(inline, " \t")
+	to := from + len(inline)
+
+	var lines []string
+	var starts []int
+
+	depth := fluentDepth(0, inline)
+
+	p.next()
+
+	for p.offset < len(p.data) {
+		// Blank lines are part of the pattern if a line continues it after
+		// them.
+		blank := p.offset
+
+		for p.offset < len(p.data) && strings.TrimSpace(p.line()) == "" {
+			p.next()
+		}
+
+		if p.offset == len(p.data) || !isFluentContinuation(p.line(), depth) {
+			p.offset = blank
+			break
+		}
+
+		if inline != "" || len(lines) > 0 {
+			for i := blank; i < p.offset; i += bytes.IndexByte(p.data[i:], '\n') + 1 {
+				lines = append(lines, "")
+				starts = append(starts, i)
+			}
+		}
+
+		line := p.line()
+		depth = fluentDepth(depth, line)
+		lines = append(lines, strings.TrimRight(line, " \t"))
+		starts = append(starts, p.offset)
+		to = p.offset + len(strings.TrimRight(line, " \t"))
+		p.next()
+	}
+
+	if inline == "" && len(lines) == 0 {
+		return resource{}, false
+	}
+
+	indent := -1
+
+	// Placeables closed at the start of a line take no part in the common
+	// indentation.
+	for _, line := range lines {
+		width := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		if line == "" || width == 0 {
+			continue
+		}
+
+		if indent < 0 || width < indent {
+			indent = width
+		}
+	}
+
+	if indent < 0 {
+		indent = 0
+	}
+
+	for i, line := range lines {
+		if width := len(line) - len(strings.TrimLeft(line, " \t")); width < indent {
+			lines[i] = line[width:]
+		} else {
+			lines[i] = line[indent:]
+		}
+	}
+
+	if inline == "" {
+		from = starts[0] + indent
+	} else {
+		lines = append([]string{inline}, lines...)
+	}
+
+	return resource{value: strings.Join(lines, "\n"), translate: true, from: from, to: to}, true
+}
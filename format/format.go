@@ -0,0 +1,193 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+// Package format reads and writes the translation files of the formats push
+// and pull support. Entries of every format are given as XLIFF trans-units,
+// so that they are stored and sent to jobs the same way. Formats register
+// themselves, and so can the ones of a plugin.
+package format
+
+import (
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// Format is a file format of translation files.
+type Format interface {
+	// Name of the format, as given in configuration.
+	Name() string
+	// Extensions of the files of the format, with the leading dot.
+	Extensions() []string
+	// Reads a file from input and calls fn for each of its units.
+	Read(input io.Reader, fn xliff.WalkFunc) error
+	// Copies a file from input to output, calling fn for each of its units
+	// and writing back the targets fn changes. Returns true if it changed
+	// any.
+	Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error)
+}
+
+// Validator is implemented by formats that check more of a file than that
+// it can be read.
+type Validator interface {
+	Validate(input io.Reader) []xliff.ValidationError
+}
+
+// TargetValidator is implemented by formats whose targets have to keep
+// the structure of their sources to be written, as the ICU messages of
+// ARB.
+type TargetValidator interface {
+	// Returns nil if target can be written as the translation of source.
+	ValidateTarget(source string, target string) error
+}
+
+// Matcher is implemented by formats whose files are told apart by more than
+// their extension.
+type Matcher interface {
+	Match(path string) bool
+}
+
+// Sniffer is implemented by formats whose files can be told by their
+// content, for files whose path tells no format.
+type Sniffer interface {
+	// Returns true if data, the start of a file, is of the format.
+	Sniff(data []byte) bool
+}
+
+// Localizer is implemented by formats whose paths tell the language of their
+// files in a way of their own, rather than by the language pattern.
+type Localizer interface {
+	// Returns the language of the file at path, empty for a file of the
+	// source language kept apart from any language, or false if the path
+	// tells no language.
+	Language(path string) (string, bool)
+	// Returns the path of the file of the source language, sourceLanguage,
+	// that corresponds to the file at path.
+	SourcePath(path string, sourceLanguage string) string
+}
+
+// ContentLocalizer is implemented by Localizers whose files tell their
+// language in their content as well, which is told rather than the one of
+// their path.
+type ContentLocalizer interface {
+	Localizer
+	// Returns the language the file read from input tells, or false if it
+	// tells none.
+	ContentLanguage(input io.Reader) (string, bool)
+}
+
+// Monolingual is implemented by formats whose files hold the strings of a
+// single language, translations being kept in a file for each language.
+// Read gives the strings of a file as the sources of its units.
+type Monolingual interface {
+	Format
+	// Reads the units of source, the file of the source language, and calls
+	// fn for each with its target in language from target, the file of
+	// language, or nil if there is none yet.
+	ReadTranslation(source io.Reader, target io.Reader, language string, fn xliff.WalkFunc) error
+	// Copies target, the file of language or nil if there is none yet, to
+	// output, calling fn for the units of source as ReadTranslation does
+	// and writing the targets fn changes. Units target is missing are added
+	// to it once translated. Returns true if any target changed.
+	WriteTranslation(source io.Reader, target io.Reader, output io.Writer, language string, fn xliff.WalkFunc) (bool, error)
+}
+
+var formats []Format
+
+// Registers f, in place of a format of the same name.
+func Register(f Format) {
+	for i, registered := range formats {
+		if registered.Name() == f.Name() {
+			formats[i] = f
+			return
+		}
+	}
+
+	formats = append(formats, f)
+}
+
+// Returns the format with the given name, or nil.
+func Get(name string) Format {
+	for _, f := range formats {
+		if f.Name() == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// Returns the format of the file at path by its extension, or nil. Formats
+// that are a Matcher have to match the path as well.
+func ForPath(path string) Format {
+	extension := strings.ToLower(filepath.Ext(path))
+
+	for _, f := range formats {
+		if matcher, ok := f.(Matcher); ok && !matcher.Match(path) {
+			continue
+		}
+
+		for _, e := range f.Extensions() {
+			if e == extension {
+				return f
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the format of a file by data, its start, or nil. Only formats that
+// are a Sniffer are told.
+func Detect(data []byte) Format {
+	for _, f := range formats {
+		if sniffer, ok := f.(Sniffer); ok && sniffer.Sniff(data) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// Returns the diagnostics of the file read from input: those of the format
+// if it is a Validator, or an error if the file cannot be read.
+func Validate(f Format, input io.Reader) []xliff.ValidationError {
+	if validator, ok := f.(Validator); ok {
+		return validator.Validate(input)
+	}
+
+	err := f.Read(input, func(file *xliff.File, groups []*xliff.Group, transUnit *xliff.TransUnit) error {
+		return nil
+	})
+
+	if err == nil {
+		return nil
+	}
+
+	line := 0
+	if syntaxError, ok := err.(*SyntaxError); ok {
+		line = syntaxError.Line
+	}
+
+	return []xliff.ValidationError{{
+		Code:     xliff.MalformedDocument,
+		Severity: xliff.SeverityError,
+		Message:  "Document cannot be read: " + err.Error(),
+		Line:     line,
+	}}
+}
+
+// SyntaxError is an error in the syntax of a file of the named format.
+type SyntaxError struct {
+	Format string
+	Line   int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Format + ": line " + strconv.Itoa(e.Line) + ": " + e.Msg
+}
@@ -0,0 +1,380 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// icuArgument is an argument of an ICU message: its name, its type, empty
+// for a simple one, and the messages of the options of a plural or select.
+// The # of a plural stands for a simple argument of the name of the plural.
+type icuArgument struct {
+	name    string
+	kind    string
+	options map[string][]icuArgument
+}
+
+// Returns nil if target, the translation of the ICU message source, keeps
+// its arguments: the same names of the same types, and the same options
+// of each select. Plurals need their "other" option only, as other
+// languages have other categories.
+func CheckMessage(source string, target string) error {
+	sourceArguments, err := parseMessage(source)
+
+	if err != nil {
+		return errors.New("source is not a valid ICU message: " + err.Error())
+	}
+
+	targetArguments, err := parseMessage(target)
+
+	if err != nil {
+		return errors.New("target is not a valid ICU message: " + err.Error())
+	}
+
+	sourceNames := icuNames(sourceArguments, nil)
+	targetNames := icuNames(targetArguments, nil)
+
+	for name := range sourceNames {
+		if !targetNames[name] {
+			return errors.New("target is missing argument " + name)
+		}
+	}
+
+	for name := range targetNames {
+		if !sourceNames[name] {
+			return errors.New("target has argument " + name + " that source has not")
+		}
+	}
+
+	selects := make(map[string][]string)
+	icuSelects(sourceArguments, selects)
+
+	return checkOptions(targetArguments, selects)
+}
+
+// icuNames adds the names and types of arguments, as "name" or
+// "name, type", to names, which it returns.
+func icuNames(arguments []icuArgument, names map[string]bool) map[string]bool {
+	if names == nil {
+		names = make(map[string]bool)
+	}
+
+	for _, argument := range arguments {
+		name := argument.name
+
+		if argument.kind != "" {
+			name += ", " + argument.kind
+		}
+
+		names[name] = true
+
+		for _, option := range argument.options {
+			icuNames(option, names)
+		}
+	}
+
+	return names
+}
+
+// icuSelects adds the sorted options of the selects of arguments to
+// selects, by name.
+func icuSelects(arguments []icuArgument, selects map[string][]string) {
+	for _, argument := range arguments {
+		if argument.kind == "select" {
+			selects[argument.name] = icuOptions(argument)
+		}
+
+		for _, option := range argument.options {
+			icuSelects(option, selects)
+		}
+	}
+}
+
+// icuOptions returns the sorted options of argument.
+func icuOptions(argument icuArgument) []string {
+	var options []string
+
+	for option := range argument.options {
+		options = append(options, option)
+	}
+
+	sort.Strings(options)
+
+	return options
+}
+
+// checkOptions returns an error if a select of arguments has other options
+// than the select of the same name in selects, or a plural has no "other"
+// option.
+func checkOptions(arguments []icuArgument, selects map[string][]string) error {
+	for _, argument := range arguments {
+		switch argument.kind {
+		case "select":
+			if strings.Join(icuOptions(argument), " ") != strings.Join(selects[argument.name], " ") {
+				return errors.New("target has other options of select " + argument.name)
+			}
+		case "plural", "selectordinal":
+			if _, ok := argument.options["other"]; !ok {
+				return errors.New("target has no other option of plural " + argument.name)
+			}
+
+			for option := range argument.options {
+				if !isPluralCategory(option) && !strings.HasPrefix(option, "=") {
+					return errors.New("target has option " + option + " of plural " + argument.name + " that is no plural category")
+				}
+			}
+		}
+
+		for _, option := range argument.options {
+			if err := checkOptions(option, selects); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseMessage returns the arguments of an ICU message.
+func parseMessage(message string) ([]icuArgument, error) {
+	p := &icuParser{data: message}
+	arguments, err := p.message("")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.offset < len(p.data) {
+		return nil, p.syntaxError("unexpected }")
+	}
+
+	return arguments, nil
+}
+
+// icuParser reads the arguments of an ICU message.
+type icuParser struct {
+	data   string
+	offset int
+}
+
+func (p *icuParser) syntaxError(message string) error {
+	return errors.New(message + " at offset " + strconv.Itoa(p.offset))
+}
+
+// space reads white space.
+func (p *icuParser) space() {
+	for p.offset < len(p.data) && strings.IndexByte(" \t\r\n", p.data[p.offset]) >= 0 {
+		p.offset++
+	}
+}
+
+// word reads a name, a type or the selector of an option.
+func (p *icuParser) word() string {
+	from := p.offset
+
+	for p.offset < len(p.data) && strings.IndexByte(" \t\r\n{},#'", p.data[p.offset]) < 0 {
+		p.offset++
+	}
+
+	return p.data[from:p.offset]
+}
+
+// message reads a message up to a } or the end, in an option of the plural
+// of the given name, if any.
+func (p *icuParser) message(plural string) ([]icuArgument, error) {
+	var arguments []icuArgument
+
+	for p.offset < len(p.data) {
+		switch p.data[p.offset] {
+		case '}':
+			return arguments, nil
+		case '{':
+			p.offset++
+			argument, err := p.argument()
+
+			if err != nil {
+				return nil, err
+			}
+
+			arguments = append(arguments, argument)
+		case '#':
+			p.offset++
+
+			if plural != "" {
+				arguments = append(arguments, icuArgument{name: plural})
+			}
+		case '\'':
+			p.quote(plural != "")
+		default:
+			p.offset++
+		}
+	}
+
+	return arguments, nil
+}
+
+// quote reads an apostrophe, which quotes the text up to the next one if
+// it is before a special character.
+func (p *icuParser) quote(plural bool) {
+	p.offset++
+
+	if p.offset == len(p.data) {
+		return
+	}
+
+	if p.data[p.offset] == '\'' {
+		p.offset++
+		return
+	}
+
+	if strings.IndexByte("{}|", p.data[p.offset]) < 0 && !(plural && p.data[p.offset] == '#') {
+		return
+	}
+
+	for p.offset < len(p.data) {
+		p.offset++
+
+		if p.offset < len(p.data) && p.data[p.offset] == '\'' {
+			p.offset++
+
+			if p.offset == len(p.data) || p.data[p.offset] != '\'' {
+				return
+			}
+		}
+	}
+}
+
+// argument reads an argument just started.
+func (p *icuParser) argument() (icuArgument, error) {
+	p.space()
+	argument := icuArgument{name: p.word()}
+
+	if argument.name == "" {
+		return argument, p.syntaxError("expected the name of an argument")
+	}
+
+	p.space()
+
+	if p.next('}') {
+		return argument, nil
+	}
+
+	if !p.next(',') {
+		return argument, p.syntaxError("expected , or } after argument " + argument.name)
+	}
+
+	p.space()
+	argument.kind = p.word()
+	p.space()
+
+	if p.next('}') {
+		return argument, nil
+	}
+
+	if !p.next(',') {
+		return argument, p.syntaxError("expected , or } after the type of argument " + argument.name)
+	}
+
+	switch argument.kind {
+	case "plural", "selectordinal", "select":
+		return argument, p.options(&argument)
+	}
+
+	return argument, p.style()
+}
+
+// options reads the options of a plural or select up to its end.
+func (p *icuParser) options(argument *icuArgument) error {
+	argument.options = make(map[string][]icuArgument)
+
+	plural := ""
+	if argument.kind != "select" {
+		plural = argument.name
+	}
+
+	for {
+		p.space()
+
+		if p.next('}') {
+			if len(argument.options) == 0 {
+				return p.syntaxError("expected options of argument " + argument.name)
+			}
+
+			return nil
+		}
+
+		if p.offset == len(p.data) {
+			return p.syntaxError("argument " + argument.name + " is not closed")
+		}
+
+		selector := p.word()
+
+		if selector == "" {
+			return p.syntaxError("expected an option of argument " + argument.name)
+		}
+
+		p.space()
+
+		if plural != "" && strings.HasPrefix(selector, "offset:") {
+			continue
+		}
+
+		if !p.next('{') {
+			return p.syntaxError("expected { after option " + selector)
+		}
+
+		message, err := p.message(plural)
+
+		if err != nil {
+			return err
+		}
+
+		if !p.next('}') {
+			return p.syntaxError("option " + selector + " is not closed")
+		}
+
+		argument.options[selector] = message
+	}
+}
+
+// style reads the style of an argument up to its end.
+func (p *icuParser) style() error {
+	depth := 0
+
+	for p.offset < len(p.data) {
+		switch p.data[p.offset] {
+		case '\'':
+			p.quote(false)
+			continue
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				p.offset++
+				return nil
+			}
+
+			depth--
+		}
+
+		p.offset++
+	}
+
+	return p.syntaxError("argument is not closed")
+}
+
+// next reads c if it is the next character.
+func (p *icuParser) next(c byte) bool {
+	if p.offset < len(p.data) && p.data[p.offset] == c {
+		p.offset++
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,397 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// JSON reads and writes JSON locale files, flat or nested, as i18next and
+// most web frameworks have them. A string is a trans-unit whose id is its
+// keys joined by dots. Strings of i18next plurals, whose keys end with the
+// plural categories, as in files_one and files_other, are a group of the
+// id of the key without category holding a trans-unit for each plural
+// category of the target language. Values that are not strings are left
+// out.
+//
+// Translations are written in place of the strings of a file, ordering and
+// indentation being kept, and strings missing from it are added to the end
+// of their objects.
+type JSON struct{}
+
+func init() {
+	Register(JSON{})
+}
+
+func (JSON) Name() string {
+	return "json"
+}
+
+func (JSON) Extensions() []string {
+	return []string{".json"}
+}
+
+func (j JSON) Read(input io.Reader, fn xliff.WalkFunc) error {
+	_, err := readResources(j, input, nil, "plaintext", fn)
+	return err
+}
+
+func (j JSON) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return readResources(j, input, output, "plaintext", fn)
+}
+
+func (j JSON) ReadTranslation(source io.Reader, target io.Reader, language string, fn xliff.WalkFunc) error {
+	return readTranslation(j, source, target, language, "plaintext", fn)
+}
+
+func (j JSON) WriteTranslation(source io.Reader, target io.Reader, output io.Writer, language string, fn xliff.WalkFunc) (bool, error) {
+	return writeTranslation(j, source, target, output, language, "plaintext", fn)
+}
+
+func (JSON) decode(data []byte) (*resourceFile, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("{}\n")
+	}
+
+	f := &resourceFile{
+		data:      data,
+		groupEnds: make(map[string]int),
+		objects:   make(map[string]*object),
+		newline:   detectNewline(data),
+	}
+
+	p := &jsonParser{file: f, data: data}
+
+	if bytes.HasPrefix(data, []byte("\xef\xbb\xbf")) {
+		p.offset = 3
+	}
+
+	p.space()
+
+	if !p.next('{') {
+		return nil, p.syntaxError("expected an object")
+	}
+
+	if err := p.object(nil, 1); err != nil {
+		return nil, err
+	}
+
+	p.space()
+
+	if p.offset < len(data) {
+		return nil, p.syntaxError("unexpected text after the object")
+	}
+
+	if f.indent == "" {
+		f.indent = "  "
+	}
+
+	return f, nil
+}
+
+func (JSON) encode(f *resourceFile, r resource, value string) string {
+	return jsonEscape(value)
+}
+
+func (j JSON) insert(f *resourceFile, resources []resource) []edit {
+	var edits []edit
+
+	order, anchors := f.members(resources, func(r resource) []string {
+		last := r.path[len(r.path)-1]
+		return append(append([]string{}, r.path[:len(r.path)-1]...), last[:strings.LastIndex(last, "_")+1]+r.id)
+	})
+
+	for _, anchor := range order {
+		o := f.objects[anchor]
+		text := strings.Join(j.render(f, anchors[anchor].children, o.depth), ","+f.newline)
+
+		if o.last >= 0 {
+			edits = append(edits, edit{from: o.last, to: o.last, text: "," + f.newline + text})
+		} else {
+			edits = append(edits, edit{from: o.start, to: o.end, text: f.newline + text + f.newline + strings.Repeat(f.indent, o.depth-1)})
+		}
+	}
+
+	return edits
+}
+
+// render returns the members of nodes at the given depth.
+func (j JSON) render(f *resourceFile, nodes []*member, depth int) []string {
+	var members []string
+
+	indent := strings.Repeat(f.indent, depth)
+
+	for _, node := range nodes {
+		member := indent + `"` + jsonEscape(node.key) + `": `
+
+		if node.value != nil {
+			member += `"` + j.encode(f, *node.value, node.value.value) + `"`
+		} else {
+			member += "{" + f.newline + strings.Join(j.render(f, node.children, depth+1), ","+f.newline) + f.newline + indent + "}"
+		}
+
+		members = append(members, member)
+	}
+
+	return members
+}
+
+// jsonParser reads the objects of a JSON file.
+type jsonParser struct {
+	file   *resourceFile
+	data   []byte
+	offset int
+}
+
+func (p *jsonParser) syntaxError(message string) error {
+	line := bytes.Count(p.data[:p.offset], []byte("\n")) + 1
+	return &SyntaxError{Format: "json", Line: line, Msg: message}
+}
+
+// next reads c if it is the next character.
+func (p *jsonParser) next(c byte) bool {
+	if p.offset < len(p.data) && p.data[p.offset] == c {
+		p.offset++
+		return true
+	}
+
+	return false
+}
+
+// space reads white space.
+func (p *jsonParser) space() {
+	for p.offset < len(p.data) && strings.IndexByte(" \t\r\n", p.data[p.offset]) >= 0 {
+		p.offset++
+	}
+}
+
+// object reads the members of an object just started, with the given keys
+// and members at the given depth.
+func (p *jsonParser) object(path []string, depth int) error {
+	o := &object{start: p.offset, last: -1, depth: depth}
+	p.file.objects[strings.Join(path, "\x00")] = o
+	first := len(p.file.resources)
+
+	for {
+		p.space()
+
+		if p.next('}') {
+			o.end = p.offset - 1
+			p.plurals(path, first)
+
+			return nil
+		}
+
+		if o.last >= 0 {
+			if !p.next(',') {
+				return p.syntaxError("expected , or } after a member")
+			}
+
+			p.space()
+		}
+
+		if p.file.indent == "" && depth == 1 {
+			p.file.indent = string(p.data[lineStart(p.data, p.offset):p.offset])
+		}
+
+		key, err := p.string()
+
+		if err != nil {
+			return err
+		}
+
+		p.space()
+
+		if !p.next(':') {
+			return p.syntaxError("expected : after " + strconv.Quote(key))
+		}
+
+		p.space()
+
+		if err := p.value(append(append([]string{}, path...), key), depth); err != nil {
+			return err
+		}
+
+		o.last = p.offset
+	}
+}
+
+// value reads the value of the member with the given keys.
+func (p *jsonParser) value(path []string, depth int) error {
+	if p.offset == len(p.data) {
+		return p.syntaxError("expected a value")
+	}
+
+	switch p.data[p.offset] {
+	case '{':
+		p.offset++
+		return p.object(path, depth+1)
+	case '[':
+		return p.skip()
+	case '"':
+		from := p.offset + 1
+		value, err := p.string()
+
+		if err != nil {
+			return err
+		}
+
+		p.file.resources = append(p.file.resources, resource{
+			id:        strings.Join(path, "."),
+			path:      path,
+			value:     value,
+			translate: true,
+			from:      from,
+			to:        p.offset - 1,
+		})
+
+		return nil
+	}
+
+	from := p.offset
+
+	for p.offset < len(p.data) && strings.IndexByte(",}] \t\r\n", p.data[p.offset]) < 0 {
+		p.offset++
+	}
+
+	if p.offset == from {
+		return p.syntaxError("expected a value")
+	}
+
+	return nil
+}
+
+// skip reads an array.
+func (p *jsonParser) skip() error {
+	depth := 0
+
+	for p.offset < len(p.data) {
+		switch p.data[p.offset] {
+		case '"':
+			if _, err := p.string(); err != nil {
+				return err
+			}
+
+			continue
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+
+		p.offset++
+
+		if depth == 0 {
+			return nil
+		}
+	}
+
+	return p.syntaxError("array is not closed")
+}
+
+// string reads a string and returns it unescaped.
+func (p *jsonParser) string() (string, error) {
+	from := p.offset
+
+	if !p.next('"') {
+		return "", p.syntaxError("expected a string")
+	}
+
+	for p.offset < len(p.data) {
+		c := p.data[p.offset]
+		p.offset++
+
+		if c == '\\' {
+			p.offset++
+		} else if c == '"' {
+			var value string
+
+			if err := json.Unmarshal(p.data[from:p.offset], &value); err != nil {
+				return "", p.syntaxError(err.Error())
+			}
+
+			return value, nil
+		}
+	}
+
+	return "", p.syntaxError("string is not closed")
+}
+
+// plurals groups the strings of i18next plurals among the members of the
+// object with the given keys, read from the resource of index first.
+func (p *jsonParser) plurals(path []string, first int) {
+	keys := make(map[string]bool)
+	resources := p.file.resources[first:]
+
+	for _, r := range resources {
+		if len(r.path) == len(path)+1 {
+			keys[r.path[len(path)]] = true
+		}
+	}
+
+	groups := make(map[string]*xliff.Group)
+
+	for i := range resources {
+		r := &resources[i]
+
+		if len(r.path) != len(path)+1 {
+			continue
+		}
+
+		key := r.path[len(path)]
+		index := strings.LastIndex(key, "_")
+
+		if index < 0 || !isPluralCategory(key[index+1:]) || !keys[key[:index]+"_other"] {
+			continue
+		}
+
+		base := key[:index]
+		group, ok := groups[base]
+
+		if !ok {
+			id := strings.Join(append(append([]string{}, path...), base), ".")
+			group = &xliff.Group{ID: id, Resname: id}
+			groups[base] = group
+			p.file.groupEnds[id] = 0
+		}
+
+		r.groups = []*xliff.Group{group}
+		r.id = key[index+1:]
+		r.plural = true
+	}
+}
+
+// jsonEscape returns text escaped as the content of a JSON string.
+func jsonEscape(text string) string {
+	var result strings.Builder
+
+	for _, c := range text {
+		switch c {
+		case '"', '\\':
+			result.WriteRune('\\')
+			result.WriteRune(c)
+		case '\n':
+			result.WriteString(`\n`)
+		case '\r':
+			result.WriteString(`\r`)
+		case '\t':
+			result.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				result.WriteString(`\u` + strconv.FormatInt(int64(c)+0x10000, 16)[1:])
+			} else {
+				result.WriteRune(c)
+			}
+		}
+	}
+
+	return result.String()
+}
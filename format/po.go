@@ -0,0 +1,562 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// PO reads and writes gettext PO and POT files. An entry is a trans-unit
+// whose id is its msgid, prefixed by its msgctxt and an EOT character as
+// gettext does, and whose resname is its msgctxt. An entry with plural
+// forms is a group of that id holding a trans-unit for each plural form of
+// the target language, numbered from 0. Translator comments, extracted
+// comments and references are notes from "translator", "developer" and
+// "reference". Fuzzy entries are in the needs-review-translation state.
+//
+// Entries that are not changed are written back as read, as are obsolete
+// entries and the header.
+type PO struct{}
+
+func init() {
+	Register(PO{})
+}
+
+func (PO) Name() string {
+	return "po"
+}
+
+func (PO) Extensions() []string {
+	return []string{".po", ".pot"}
+}
+
+func (PO) Sniff(data []byte) bool {
+	return bytes.Contains(data, []byte("msgid \"")) && bytes.Contains(data, []byte("msgstr"))
+}
+
+func (PO) Read(input io.Reader, fn xliff.WalkFunc) error {
+	return readPO(input, nil, fn)
+}
+
+func (PO) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	var changed bool
+
+	err := readPO(input, func(entry *poEntry, raw string) error {
+		var err error
+
+		if entry != nil && entry.changed {
+			changed = true
+			_, err = io.WriteString(output, entry.render())
+		} else {
+			_, err = io.WriteString(output, raw)
+		}
+
+		return err
+	}, fn)
+
+	return changed, err
+}
+
+var pluralForms = regexp.MustCompile(`nplurals\s*=\s*(\d+)`)
+
+// poEntry is an entry of a PO file, as its raw lines and what they hold.
+type poEntry struct {
+	lines []string
+	kinds []string
+
+	comments   []string
+	extracted  []string
+	references []string
+	flags      []string
+	obsolete   bool
+
+	context    string
+	hasContext bool
+	id         string
+	plural     string
+	hasPlural  bool
+	str        []string
+
+	// Targets and fuzzy flag written in place of the read ones when changed
+	// is set.
+	changed  bool
+	newStr   []string
+	newFuzzy bool
+}
+
+// readPO reads the entries of a PO file from input and calls fn for each
+// of their units. The file is passed to write, if any, an entry or a blank
+// line at a time.
+func readPO(input io.Reader, write func(entry *poEntry, raw string) error, fn xliff.WalkFunc) error {
+	file := xliff.File{Datatype: "po"}
+	plurals := 0
+	reader := bufio.NewReader(input)
+	number := 0
+
+	var entry *poEntry
+
+	flush := func() error {
+		if entry == nil {
+			return nil
+		}
+
+		current := entry
+		entry = nil
+
+		if current.isHeader() {
+			for _, field := range strings.Split(current.str[0], "\n") {
+				name, value := field, ""
+				if index := strings.Index(field, ":"); index >= 0 {
+					name, value = field[:index], strings.TrimSpace(field[index+1:])
+				}
+
+				switch strings.ToLower(strings.TrimSpace(name)) {
+				case "language":
+					file.TargetLanguage = value
+				case "plural-forms":
+					if match := pluralForms.FindStringSubmatch(value); match != nil {
+						plurals, _ = strconv.Atoi(match[1])
+					}
+				}
+			}
+		} else if !current.obsolete {
+			if err := current.walk(&file, plurals, fn); err != nil {
+				return err
+			}
+		}
+
+		if write == nil {
+			return nil
+		}
+
+		return write(current, strings.Join(current.lines, ""))
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if line != "" {
+			number++
+			text := strings.TrimSpace(line)
+
+			if text == "" {
+				if err := flush(); err != nil {
+					return err
+				}
+
+				if write != nil {
+					if err := write(nil, line); err != nil {
+						return err
+					}
+				}
+			} else {
+				if entry != nil && entry.startsAnother(text) {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+
+				if entry == nil {
+					entry = &poEntry{}
+				}
+
+				if err := entry.add(line, text, number); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return flush()
+		}
+	}
+}
+
+// startsAnother returns true if text, a line that follows the entry
+// without a blank line between, starts another entry.
+func (entry *poEntry) startsAnother(text string) bool {
+	if len(entry.str) == 0 {
+		return false
+	}
+
+	return strings.HasPrefix(text, "#") || strings.HasPrefix(text, "msgctxt") ||
+		(strings.HasPrefix(text, "msgid") && !strings.HasPrefix(text, "msgid_plural"))
+}
+
+// add reads line, whose text without surrounding space is given, into the
+// entry.
+func (entry *poEntry) add(line string, text string, number int) error {
+	kind := "comment"
+
+	switch {
+	case strings.HasPrefix(text, "#~"):
+		entry.obsolete = true
+	case strings.HasPrefix(text, "#,"):
+		kind = "flags"
+
+		for _, flag := range strings.Split(text[2:], ",") {
+			if flag = strings.TrimSpace(flag); flag != "" {
+				entry.flags = append(entry.flags, flag)
+			}
+		}
+	case strings.HasPrefix(text, "#|"):
+		kind = "previous"
+	case strings.HasPrefix(text, "#."):
+		entry.extracted = append(entry.extracted, strings.TrimSpace(text[2:]))
+	case strings.HasPrefix(text, "#:"):
+		entry.references = append(entry.references, strings.TrimSpace(text[2:]))
+	case strings.HasPrefix(text, "#"):
+		entry.comments = append(entry.comments, strings.TrimPrefix(text[1:], " "))
+	case entry.obsolete:
+	default:
+		keyword, value, err := poField(text, number)
+		if err != nil {
+			return err
+		}
+
+		if keyword == "" {
+			if len(entry.kinds) > 0 {
+				keyword = entry.kinds[len(entry.kinds)-1]
+			}
+
+			if !strings.HasPrefix(keyword, "msg") {
+				return &SyntaxError{Format: "po", Line: number, Msg: "string without keyword"}
+			}
+
+			entry.extend(keyword, value)
+		} else if err := entry.set(keyword, value, number); err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(keyword, "msgstr") {
+			keyword = "msgstr"
+		}
+
+		kind = keyword
+	}
+
+	entry.lines = append(entry.lines, line)
+	entry.kinds = append(entry.kinds, kind)
+
+	return nil
+}
+
+func (entry *poEntry) set(keyword string, value string, number int) error {
+	switch {
+	case keyword == "msgctxt":
+		entry.context, entry.hasContext = value, true
+	case keyword == "msgid":
+		entry.id = value
+	case keyword == "msgid_plural":
+		entry.plural, entry.hasPlural = value, true
+	case keyword == "msgstr":
+		entry.str = append(entry.str, value)
+	case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+		index, err := strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+		if err != nil || index != len(entry.str) {
+			return &SyntaxError{Format: "po", Line: number, Msg: "unexpected " + keyword}
+		}
+
+		entry.str = append(entry.str, value)
+	default:
+		return &SyntaxError{Format: "po", Line: number, Msg: "unknown keyword " + keyword}
+	}
+
+	return nil
+}
+
+// extend adds value, from a string on its own line, to the field of the
+// given kind.
+func (entry *poEntry) extend(kind string, value string) {
+	switch kind {
+	case "msgctxt":
+		entry.context += value
+	case "msgid":
+		entry.id += value
+	case "msgid_plural":
+		entry.plural += value
+	default:
+		if len(entry.str) > 0 {
+			entry.str[len(entry.str)-1] += value
+		}
+	}
+}
+
+func (entry *poEntry) isHeader() bool {
+	return !entry.obsolete && !entry.hasContext && entry.id == "" && len(entry.str) > 0
+}
+
+func (entry *poEntry) isFuzzy() bool {
+	for _, flag := range entry.flags {
+		if flag == "fuzzy" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// walk calls fn for the units of the entry and keeps what fn changes.
+func (entry *poEntry) walk(file *xliff.File, plurals int, fn xliff.WalkFunc) error {
+	key := entry.id
+	if entry.hasContext {
+		key = entry.context + "\x04" + entry.id
+	}
+
+	if !entry.hasPlural {
+		transUnits := []xliff.TransUnit{entry.transUnit(file, key, entry.id, 0)}
+		before := transUnits[0].Target
+
+		if err := fn(file, nil, &transUnits[0]); err != nil {
+			return err
+		}
+
+		entry.update(transUnits, []xliff.Target{before})
+
+		return nil
+	}
+
+	count := plurals
+	if count < len(entry.str) {
+		count = len(entry.str)
+	}
+	if count < 2 {
+		count = 2
+	}
+
+	group := &xliff.Group{ID: key, Resname: entry.context}
+	transUnits := make([]xliff.TransUnit, count)
+	before := make([]xliff.Target, count)
+
+	for n := range transUnits {
+		source := entry.plural
+		if n == 0 {
+			source = entry.id
+		}
+
+		transUnits[n] = entry.transUnit(file, strconv.Itoa(n), source, n)
+		before[n] = transUnits[n].Target
+
+		if err := fn(file, []*xliff.Group{group}, &transUnits[n]); err != nil {
+			return err
+		}
+	}
+
+	entry.update(transUnits, before)
+
+	return nil
+}
+
+// transUnit returns the unit of the entry with the given id and source,
+// translated by the msgstr of the given index.
+func (entry *poEntry) transUnit(file *xliff.File, id string, source string, index int) xliff.TransUnit {
+	var notes []xliff.Note
+
+	if len(entry.comments) > 0 {
+		notes = append(notes, xliff.Note{From: "translator", Data: strings.Join(entry.comments, "\n")})
+	}
+	if len(entry.extracted) > 0 {
+		notes = append(notes, xliff.Note{From: "developer", Data: strings.Join(entry.extracted, "\n")})
+	}
+	if len(entry.references) > 0 {
+		notes = append(notes, xliff.Note{From: "reference", Data: strings.Join(entry.references, " ")})
+	}
+
+	target := xliff.Target{Language: file.TargetLanguage}
+
+	if index < len(entry.str) && entry.str[index] != "" {
+		target.Data = entry.str[index]
+		target.State = "translated"
+
+		if entry.isFuzzy() {
+			target.State = "needs-review-translation"
+		}
+	}
+
+	return xliff.TransUnit{
+		ID:      id,
+		Resname: entry.context,
+		Source:  xliff.Source{Data: source},
+		Target:  target,
+		Notes:   notes,
+	}
+}
+
+// update keeps the targets of transUnits if they are not the ones before.
+// The entry is fuzzy if one of them is translated in a state that is not
+// final, as is a new or needs-review one.
+func (entry *poEntry) update(transUnits []xliff.TransUnit, before []xliff.Target) {
+	entry.newStr = make([]string, len(transUnits))
+	entry.newFuzzy = false
+
+	for n, transUnit := range transUnits {
+		target := transUnit.Target
+
+		if target.Data != before[n].Data || target.State != before[n].State {
+			entry.changed = true
+		}
+
+		entry.newStr[n] = target.Data
+		entry.newFuzzy = entry.newFuzzy || (target.Data != "" && (target.State == "new" || strings.HasPrefix(target.State, "needs-")))
+	}
+}
+
+// render returns the entry with its new targets and fuzzy flag, and the
+// other lines as read. Previous strings are left out of entries that are no
+// longer fuzzy.
+func (entry *poEntry) render() string {
+	var b strings.Builder
+	var flagsWritten, strWritten bool
+
+	newline := "\n"
+	if strings.HasSuffix(entry.lines[0], "\r\n") {
+		newline = "\r\n"
+	}
+
+	var flags []string
+	if entry.newFuzzy {
+		flags = append(flags, "fuzzy")
+	}
+	for _, flag := range entry.flags {
+		if flag != "fuzzy" {
+			flags = append(flags, flag)
+		}
+	}
+
+	writeFlags := func() {
+		if !flagsWritten && len(flags) > 0 {
+			b.WriteString("#, " + strings.Join(flags, ", ") + newline)
+		}
+		flagsWritten = true
+	}
+
+	writeStr := func() {
+		if entry.hasPlural {
+			for n, str := range entry.newStr {
+				b.WriteString(poString("msgstr["+strconv.Itoa(n)+"]", str, newline))
+			}
+		} else {
+			b.WriteString(poString("msgstr", entry.newStr[0], newline))
+		}
+		strWritten = true
+	}
+
+	for i, line := range entry.lines {
+		switch entry.kinds[i] {
+		case "comment":
+			b.WriteString(line)
+		case "flags":
+			writeFlags()
+		case "previous":
+			if entry.newFuzzy {
+				writeFlags()
+				b.WriteString(line)
+			}
+		case "msgstr":
+			if !strWritten {
+				writeStr()
+			}
+		default:
+			writeFlags()
+			b.WriteString(line)
+		}
+	}
+
+	if !strWritten {
+		writeStr()
+	}
+
+	rendered := b.String()
+	if last := entry.lines[len(entry.lines)-1]; !strings.HasSuffix(last, "\n") {
+		rendered = strings.TrimSuffix(rendered, newline)
+	}
+
+	return rendered
+}
+
+var poEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t", "\r", "\\r")
+
+// poString returns the keyword and value as written by gettext, with a
+// line for each line of a value holding several.
+func poString(keyword string, value string, newline string) string {
+	lines := strings.SplitAfter(value, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) <= 1 {
+		return keyword + " \"" + poEscaper.Replace(value) + "\"" + newline
+	}
+
+	result := keyword + " \"\"" + newline
+	for _, line := range lines {
+		result += "\"" + poEscaper.Replace(line) + "\"" + newline
+	}
+
+	return result
+}
+
+// poField returns the keyword of a line and the string it holds. Lines
+// holding only a string have no keyword.
+func poField(text string, number int) (string, string, error) {
+	keyword := ""
+
+	if !strings.HasPrefix(text, "\"") {
+		index := strings.IndexAny(text, " \t")
+		if index < 0 {
+			return "", "", &SyntaxError{Format: "po", Line: number, Msg: "missing string after " + text}
+		}
+
+		keyword, text = text[:index], strings.TrimSpace(text[index:])
+	}
+
+	if len(text) < 2 || !strings.HasPrefix(text, "\"") || !strings.HasSuffix(text, "\"") {
+		return "", "", &SyntaxError{Format: "po", Line: number, Msg: "malformed string " + text}
+	}
+
+	var value strings.Builder
+
+	text = text[1 : len(text)-1]
+
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i+1 == len(text) {
+			value.WriteByte(text[i])
+			continue
+		}
+
+		i++
+
+		switch text[i] {
+		case 'n':
+			value.WriteByte('\n')
+		case 't':
+			value.WriteByte('\t')
+		case 'r':
+			value.WriteByte('\r')
+		case 'a':
+			value.WriteByte('\a')
+		case 'b':
+			value.WriteByte('\b')
+		case 'f':
+			value.WriteByte('\f')
+		case 'v':
+			value.WriteByte('\v')
+		default:
+			value.WriteByte(text[i])
+		}
+	}
+
+	return keyword, value.String(), nil
+}
@@ -0,0 +1,339 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/dragosv/delta/xliff"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Properties reads and writes Java properties files, the resource bundles
+// of messages_xx.properties. A property is a trans-unit whose id is its
+// key, and the comment lines before it are a note from "developer".
+//
+// The language of a file is told by the suffix of its name, the file
+// without one, as messages.properties, being the one of the source
+// language. Files in UTF-8 are written back in UTF-8, the others in
+// ISO-8859-1 with unicode escapes for the characters out of ASCII.
+//
+// Translations are written in place of the values of a file, and the
+// properties missing from it are added at its end.
+type Properties struct{}
+
+func init() {
+	Register(Properties{})
+}
+
+func (Properties) Name() string {
+	return "properties"
+}
+
+func (Properties) Extensions() []string {
+	return []string{".properties"}
+}
+
+func (Properties) Language(path string) (string, bool) {
+	_, language := propertiesLocale(path)
+	return language, true
+}
+
+func (Properties) SourcePath(path string, sourceLanguage string) string {
+	base, _ := propertiesLocale(path)
+	return filepath.Join(filepath.Dir(path), base+filepath.Ext(path))
+}
+
+// propertiesLocale returns the base name of the file at path and the
+// language of its suffix, if any.
+func propertiesLocale(path string) (string, string) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	parts := strings.Split(name, "_")
+	count := len(parts)
+
+	if count >= 3 && isLanguageCode(parts[count-2]) && isRegionCode(parts[count-1]) {
+		return strings.Join(parts[:count-2], "_"), parts[count-2] + "-" + parts[count-1]
+	}
+
+	if count >= 2 && isLanguageCode(parts[count-1]) {
+		return strings.Join(parts[:count-1], "_"), parts[count-1]
+	}
+
+	return name, ""
+}
+
+func (p Properties) Read(input io.Reader, fn xliff.WalkFunc) error {
+	_, err := readResources(p, input, nil, "javapropertyresourcebundle", fn)
+	return err
+}
+
+func (p Properties) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return readResources(p, input, output, "javapropertyresourcebundle", fn)
+}
+
+func (p Properties) ReadTranslation(source io.Reader, target io.Reader, language string, fn xliff.WalkFunc) error {
+	return readTranslation(p, source, target, language, "javapropertyresourcebundle", fn)
+}
+
+func (p Properties) WriteTranslation(source io.Reader, target io.Reader, output io.Writer, language string, fn xliff.WalkFunc) (bool, error) {
+	return writeTranslation(p, source, target, output, language, "javapropertyresourcebundle", fn)
+}
+
+func (Properties) decode(data []byte) (*resourceFile, error) {
+	f := &resourceFile{
+		groupEnds: make(map[string]int),
+		newline:   detectNewline(data),
+	}
+
+	if !utf8.Valid(data) || !hasNonASCII(data) {
+		f.encoding = charmap.ISO8859_1
+
+		var err error
+
+		data, err = f.encoding.NewDecoder().Bytes(data)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.data = data
+	f.end = len(data)
+
+	p := &propertiesParser{data: data}
+
+	var comments []string
+
+	for p.offset < len(data) {
+		p.space()
+
+		switch {
+		case p.offset == len(data):
+		case p.newline():
+			comments = nil
+		case data[p.offset] == '#' || data[p.offset] == '!':
+			comments = append(comments, strings.TrimSpace(p.line()[1:]))
+			// The end of a comment line is not an empty line, which would
+			// drop the comments before the next key.
+			p.newline()
+		default:
+			key := p.text(true)
+			p.space()
+
+			if p.offset < len(data) && (data[p.offset] == '=' || data[p.offset] == ':') {
+				p.offset++
+				p.space()
+			}
+
+			from := p.offset
+			value := p.text(false)
+			r := resource{id: key, value: value, translate: true, from: from, to: p.offset}
+
+			if len(comments) > 0 {
+				r.notes = []xliff.Note{{Data: strings.Join(comments, "\n"), From: "developer"}}
+				comments = nil
+			}
+
+			f.resources = append(f.resources, r)
+			p.newline()
+		}
+	}
+
+	return f, nil
+}
+
+func (Properties) encode(f *resourceFile, r resource, value string) string {
+	return propertiesEscape(value, false, f.encoding != nil)
+}
+
+func (p Properties) insert(f *resourceFile, resources []resource) []edit {
+	var text string
+
+	if len(f.data) > 0 && !bytes.HasSuffix(f.data, []byte("\n")) {
+		text = f.newline
+	}
+
+	for _, r := range resources {
+		text += propertiesEscape(r.id, true, f.encoding != nil) + "=" + p.encode(f, r, r.value) + f.newline
+	}
+
+	return []edit{{from: f.end, to: f.end, text: text}}
+}
+
+// propertiesParser reads the lines of a properties file.
+type propertiesParser struct {
+	data   []byte
+	offset int
+}
+
+// space reads spaces up to the end of the line.
+func (p *propertiesParser) space() {
+	for p.offset < len(p.data) && strings.IndexByte(" \t\f", p.data[p.offset]) >= 0 {
+		p.offset++
+	}
+}
+
+// newline reads the end of a line, if it is next.
+func (p *propertiesParser) newline() bool {
+	if p.offset < len(p.data) && p.data[p.offset] == '\r' {
+		p.offset++
+
+		if p.offset < len(p.data) && p.data[p.offset] == '\n' {
+			p.offset++
+		}
+
+		return true
+	}
+
+	if p.offset < len(p.data) && p.data[p.offset] == '\n' {
+		p.offset++
+		return true
+	}
+
+	return false
+}
+
+// line reads the rest of the line, without its end.
+func (p *propertiesParser) line() string {
+	from := p.offset
+
+	for p.offset < len(p.data) && p.data[p.offset] != '\n' && p.data[p.offset] != '\r' {
+		p.offset++
+	}
+
+	return string(p.data[from:p.offset])
+}
+
+// text reads a key, which ends at a separator or a space, or a value,
+// which ends at the end of its line, and returns it unescaped. Lines
+// ending with a backslash go on at the next line.
+func (p *propertiesParser) text(key bool) string {
+	var text strings.Builder
+
+	for p.offset < len(p.data) {
+		c := p.data[p.offset]
+
+		if c == '\n' || c == '\r' || key && strings.IndexByte("=: \t\f", c) >= 0 {
+			break
+		}
+
+		p.offset++
+
+		if c != '\\' {
+			text.WriteByte(c)
+			continue
+		}
+
+		if p.offset == len(p.data) {
+			break
+		}
+
+		escaped := p.data[p.offset]
+
+		if p.newline() {
+			p.space()
+			continue
+		}
+
+		p.offset++
+
+		switch escaped {
+		case 't':
+			text.WriteByte('\t')
+		case 'n':
+			text.WriteByte('\n')
+		case 'r':
+			text.WriteByte('\r')
+		case 'f':
+			text.WriteByte('\f')
+		case 'u':
+			if p.offset+4 <= len(p.data) {
+				if code, err := strconv.ParseUint(string(p.data[p.offset:p.offset+4]), 16, 32); err == nil {
+					p.offset += 4
+					text.WriteRune(p.surrogate(rune(code)))
+					continue
+				}
+			}
+
+			text.WriteByte('u')
+		default:
+			text.WriteByte(escaped)
+		}
+	}
+
+	return text.String()
+}
+
+// surrogate returns the character of a unicode escape, which is the first
+// half of a pair of surrogates if it is followed by the other.
+func (p *propertiesParser) surrogate(code rune) rune {
+	if !utf16.IsSurrogate(code) || p.offset+6 > len(p.data) || string(p.data[p.offset:p.offset+2]) != `\u` {
+		return code
+	}
+
+	next, err := strconv.ParseUint(string(p.data[p.offset+2:p.offset+6]), 16, 32)
+
+	if err != nil {
+		return code
+	}
+
+	if decoded := utf16.DecodeRune(code, rune(next)); decoded != utf8.RuneError {
+		p.offset += 6
+		return decoded
+	}
+
+	return code
+}
+
+// propertiesEscape returns text escaped as a key or a value, with unicode
+// escapes for the characters out of ASCII if ascii is set.
+func propertiesEscape(text string, key bool, ascii bool) string {
+	var result strings.Builder
+
+	for i, c := range text {
+		switch {
+		case c == '\\':
+			result.WriteString(`\\`)
+		case c == '\n':
+			result.WriteString(`\n`)
+		case c == '\r':
+			result.WriteString(`\r`)
+		case c == '\t':
+			result.WriteString(`\t`)
+		case c == '\f':
+			result.WriteString(`\f`)
+		case c == ' ' && (key || i == 0):
+			result.WriteString(`\ `)
+		case strings.ContainsRune("=:#!", c) && (key || i == 0):
+			result.WriteRune('\\')
+			result.WriteRune(c)
+		case c < 0x20 || ascii && c > 0x7e:
+			for _, code := range utf16.Encode([]rune{c}) {
+				result.WriteString(`\u` + strings.ToUpper(strconv.FormatInt(int64(code)+0x10000, 16)[1:]))
+			}
+		default:
+			result.WriteRune(c)
+		}
+	}
+
+	return result.String()
+}
+
+// hasNonASCII returns true if data has characters out of ASCII.
+func hasNonASCII(data []byte) bool {
+	for _, c := range data {
+		if c >= 0x80 {
+			return true
+		}
+	}
+
+	return false
+}
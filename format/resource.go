@@ -0,0 +1,652 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// resource is a string of a monolingual file, read with the offsets of its
+// raw value so that the file can be written back by replacing it in place.
+type resource struct {
+	// Groups holding the resource, outermost first, as arrays, plurals and
+	// nested keys do.
+	groups []*xliff.Group
+	// Plural is set if the innermost group is a plural, whose resources
+	// have the plural categories as ids.
+	plural bool
+	id     string
+	// Keys of the resource in a file of nested keys, outermost first.
+	path      []string
+	value     string
+	notes     []xliff.Note
+	translate bool
+	// Markup is set if the raw value is written as is, rather than escaped.
+	markup bool
+	// Inline is set if the value is given as content, with its tags as
+	// inline codes, and targets as the markup of their content.
+	inline  bool
+	content xliff.Content
+	// CDATA is set if the value is a CDATA section, as targets are written.
+	cdata bool
+	// Offsets of the raw value in the file. Open and close are written
+	// around a new value, in place of an element with no value.
+	from, to    int
+	open, close string
+}
+
+// key returns the group path and id of the resource.
+func (r resource) key() string {
+	return xliff.GroupPath(r.groups) + "\x00" + r.id
+}
+
+// group returns the innermost group holding the resource, or nil.
+func (r resource) group() *xliff.Group {
+	if len(r.groups) == 0 {
+		return nil
+	}
+
+	return r.groups[len(r.groups)-1]
+}
+
+// resourceFile is a monolingual file as read.
+type resourceFile struct {
+	data      []byte
+	resources []resource
+	// Offset at which resources of new groups are added, and offsets at
+	// which resources of each group are added to it, by group path.
+	end       int
+	groupEnds map[string]int
+	// Objects of a file of nested keys, by their keys joined by NUL.
+	objects map[string]*object
+	indent  string
+	newline string
+	// Encoding of the file, if it is not UTF-8.
+	encoding encoding.Encoding
+}
+
+// write writes the file to output with edits made, in its encoding.
+func (f *resourceFile) write(output io.Writer, edits []edit) error {
+	data := applyEdits(f.data, edits)
+
+	if f.encoding != nil {
+		var err error
+
+		data, err = f.encoding.NewEncoder().Bytes(data)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := output.Write(data)
+
+	return err
+}
+
+// object is an object of a file of nested keys, to which resources are
+// added after its last member, or after its start if it has none.
+type object struct {
+	start, last, end int
+	// Depth of the members of the object, 1 for those of the root object.
+	depth int
+	// Flow is set for an object written on a line, as the flow mappings of
+	// YAML, whose members are added before its end.
+	flow bool
+}
+
+// member is a member added to an object of a file of nested keys, a value
+// or an object holding other added members.
+type member struct {
+	key      string
+	value    *resource
+	children []*member
+}
+
+// child returns the object of the member with the given key, which is added
+// if it is missing.
+func (m *member) child(key string) *member {
+	for _, child := range m.children {
+		if child.key == key && child.value == nil {
+			return child
+		}
+	}
+
+	child := &member{key: key}
+	m.children = append(m.children, child)
+
+	return child
+}
+
+// members returns the members to add to the objects of the file for
+// resources, by the keys of the innermost object of their keys that the
+// file has, and those keys in the order resources need them. The keys of a
+// plural resource are given by plural, as the category of the resource
+// stands for the last of them.
+func (f *resourceFile) members(resources []resource, plural func(r resource) []string) ([]string, map[string]*member) {
+	var order []string
+
+	anchors := make(map[string]*member)
+
+	for i := range resources {
+		r := &resources[i]
+		path := r.path
+
+		if r.plural {
+			path = plural(*r)
+		}
+
+		depth := len(path) - 1
+		for depth > 0 && f.objects[strings.Join(path[:depth], "\x00")] == nil {
+			depth--
+		}
+
+		anchor := strings.Join(path[:depth], "\x00")
+		node, ok := anchors[anchor]
+
+		if !ok {
+			node = &member{}
+			anchors[anchor] = node
+			order = append(order, anchor)
+		}
+
+		for _, key := range path[depth : len(path)-1] {
+			node = node.child(key)
+		}
+
+		node.children = append(node.children, &member{key: path[len(path)-1], value: r})
+	}
+
+	return order, anchors
+}
+
+// index returns the resources of the file by key.
+func (f *resourceFile) index() map[string]resource {
+	resources := make(map[string]resource)
+
+	for _, r := range f.resources {
+		resources[r.key()] = r
+	}
+
+	return resources
+}
+
+// resourceCodec reads and writes the files of a monolingual format.
+type resourceCodec interface {
+	// decode reads a file, which is a new one if data is empty.
+	decode(data []byte) (*resourceFile, error)
+	// encode returns value as the raw value of r, in file.
+	encode(file *resourceFile, r resource, value string) string
+	// insert returns the edits that add resources, in the order of the file
+	// of the source language, to file.
+	insert(file *resourceFile, resources []resource) []edit
+}
+
+// edit replaces the bytes of a file between two offsets with text.
+type edit struct {
+	from, to int
+	text     string
+}
+
+// applyEdits returns data with edits made, in the order of their offsets.
+func applyEdits(data []byte, edits []edit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].from < edits[j].from
+	})
+
+	var result []byte
+	offset := 0
+
+	for _, e := range edits {
+		result = append(result, data[offset:e.from]...)
+		result = append(result, e.text...)
+		offset = e.to
+	}
+
+	return append(result, data[offset:]...)
+}
+
+// decodeResources reads the file of input, or a new file if input is nil.
+func decodeResources(codec resourceCodec, input io.Reader) (*resourceFile, error) {
+	var data []byte
+
+	if input != nil {
+		var err error
+
+		data, err = ioutil.ReadAll(input)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codec.decode(data)
+}
+
+// readResources calls fn for the resources of a file read from input, with
+// the values as sources. If output is not nil, the file is written to it
+// with the targets fn changes in place of the values.
+func readResources(codec resourceCodec, input io.Reader, output io.Writer, datatype string, fn xliff.WalkFunc) (bool, error) {
+	f, err := decodeResources(codec, input)
+
+	if err != nil {
+		return false, err
+	}
+
+	file := xliff.File{Datatype: datatype}
+
+	var edits []edit
+
+	for _, r := range f.resources {
+		transUnit := r.transUnit()
+		transUnit.Target = r.target()
+		before := r.targetValue(transUnit.Target)
+
+		if err := fn(&file, r.groups, &transUnit); err != nil {
+			return false, err
+		}
+
+		if value := r.targetValue(transUnit.Target); value != before {
+			edits = append(edits, r.replace(codec, f, value))
+		}
+	}
+
+	if output == nil {
+		return false, nil
+	}
+
+	return len(edits) > 0, f.write(output, edits)
+}
+
+// translation is a unit of a file of a target language, with the resource
+// of the file of the source language it translates.
+type translation struct {
+	source    resource
+	transUnit xliff.TransUnit
+}
+
+// readTranslations returns the units of source, with targets in language
+// from target, and target as read. Plurals have the categories of language.
+// Units of resources that are not translatable are given as well.
+func readTranslations(codec resourceCodec, source io.Reader, target io.Reader, language string) ([]translation, *resourceFile, error) {
+	sourceFile, err := decodeResources(codec, source)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetFile, err := decodeResources(codec, target)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targets := targetFile.index()
+
+	var translations []translation
+
+	for _, r := range pluralResources(sourceFile.resources, language, targets) {
+		transUnit := r.transUnit()
+		transUnit.Target.Language = language
+
+		if t, ok := targets[r.key()]; ok && t.value != "" {
+			target := t.target()
+			transUnit.Target.Data = target.Data
+			transUnit.Target.Content = target.Content
+			transUnit.Target.State = "translated"
+		}
+
+		translations = append(translations, translation{source: r, transUnit: transUnit})
+	}
+
+	return translations, targetFile, nil
+}
+
+// readTranslation implements ReadTranslation of Monolingual for a codec.
+func readTranslation(codec resourceCodec, source io.Reader, target io.Reader, language string, datatype string, fn xliff.WalkFunc) error {
+	translations, _, err := readTranslations(codec, source, target, language)
+
+	if err != nil {
+		return err
+	}
+
+	file := xliff.File{Datatype: datatype, TargetLanguage: language}
+
+	for _, t := range translations {
+		if !t.source.translate {
+			continue
+		}
+
+		if err := fn(&file, t.source.groups, &t.transUnit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTranslation implements WriteTranslation of Monolingual for a codec.
+// A group added to the file gets its other resources as well, with their
+// values in the source language, so that it is whole.
+func writeTranslation(codec resourceCodec, source io.Reader, target io.Reader, output io.Writer, language string, datatype string, fn xliff.WalkFunc) (bool, error) {
+	translations, targetFile, err := readTranslations(codec, source, target, language)
+
+	if err != nil {
+		return false, err
+	}
+
+	file := xliff.File{Datatype: datatype, TargetLanguage: language}
+	targets := targetFile.index()
+	added := make(map[int]bool)
+	addedGroups := make(map[*xliff.Group]bool)
+
+	var edits []edit
+
+	for i := range translations {
+		t := &translations[i]
+
+		if !t.source.translate {
+			continue
+		}
+
+		before := t.source.targetValue(t.transUnit.Target)
+
+		if err := fn(&file, t.source.groups, &t.transUnit); err != nil {
+			return false, err
+		}
+
+		value := t.source.targetValue(t.transUnit.Target)
+
+		if value == before {
+			continue
+		}
+
+		if r, ok := targets[t.source.key()]; ok {
+			// Values are written as those of the source are.
+			r.inline, r.content, r.cdata = t.source.inline, t.source.content, t.source.cdata
+			edits = append(edits, r.replace(codec, targetFile, value))
+		} else if value != "" {
+			added[i] = true
+
+			for j, group := range t.source.groups {
+				if _, ok := targetFile.groupEnds[xliff.GroupPath(t.source.groups[:j+1])]; !ok {
+					addedGroups[group] = true
+				}
+			}
+		}
+	}
+
+	var missing []resource
+
+	for i, t := range translations {
+		r := t.source
+
+		if added[i] {
+			r.value = r.targetValue(t.transUnit.Target)
+		} else if !addedGroups[r.group()] || r.group().Translate == "no" {
+			continue
+		} else if r.inline {
+			r.value = r.content.Markup()
+		}
+
+		missing = append(missing, r)
+	}
+
+	if len(missing) > 0 {
+		edits = append(edits, codec.insert(targetFile, missing)...)
+	}
+
+	err = targetFile.write(output, edits)
+
+	return len(edits) > 0, err
+}
+
+// transUnit returns the unit of the resource, with its value as source.
+func (r resource) transUnit() xliff.TransUnit {
+	target := r.target()
+
+	transUnit := xliff.TransUnit{
+		ID:      r.id,
+		Resname: r.id,
+		Source:  xliff.Source{Data: target.Data, Content: target.Content},
+		Notes:   r.notes,
+	}
+
+	if group := r.group(); group != nil {
+		transUnit.Resname = group.ID
+	}
+
+	if !r.translate {
+		transUnit.Translate = "no"
+	}
+
+	return transUnit
+}
+
+// target returns the value of the resource as a target.
+func (r resource) target() xliff.Target {
+	if r.inline {
+		return xliff.Target{Data: r.content.Text(), Content: r.content}
+	}
+
+	return xliff.Target{Data: r.value}
+}
+
+// targetValue returns the value target is written with as the target of
+// the resource: the markup of its content if the resource is given as
+// content, or else its text.
+func (r resource) targetValue(target xliff.Target) string {
+	if r.inline {
+		return target.Markup()
+	}
+
+	return target.Data
+}
+
+// replace returns the edit writing value in place of the value of r, in
+// file.
+func (r resource) replace(codec resourceCodec, file *resourceFile, value string) edit {
+	return edit{from: r.from, to: r.to, text: r.open + codec.encode(file, r, value) + r.close}
+}
+
+// pluralResources returns resources with the resources of each plural in
+// the categories of language. A category missing from the file takes the
+// value of the "other" category, unless it is an optional one, which is
+// left out if neither the source nor the targets have it.
+func pluralResources(resources []resource, language string, targets map[string]resource) []resource {
+	categories := cldrPluralCategories(language)
+
+	var result []resource
+
+	for i := 0; i < len(resources); i++ {
+		r := resources[i]
+
+		if !r.plural {
+			result = append(result, r)
+			continue
+		}
+
+		end := i + 1
+		for end < len(resources) && resources[end].plural && resources[end].group() == r.group() {
+			end++
+		}
+
+		forms := make(map[string]resource)
+		for _, form := range resources[i:end] {
+			forms[form.id] = form
+		}
+
+		for _, category := range categories {
+			form, ok := forms[category]
+
+			if !ok && isOptionalPlural(language, category) {
+				probe := r
+				probe.id = category
+
+				if _, ok := targets[probe.key()]; !ok {
+					continue
+				}
+			}
+
+			if !ok {
+				form, ok = forms["other"]
+			}
+
+			if !ok {
+				form = resources[end-1]
+			}
+
+			form.id = category
+			result = append(result, form)
+		}
+
+		i = end - 1
+	}
+
+	return result
+}
+
+// Categories of cardinal plurals, as CLDR has them, by language.
+var pluralCategories = map[string][]string{
+	"ar": {"zero", "one", "two", "few", "many", "other"},
+	"be": {"one", "few", "many", "other"},
+	"bs": {"one", "few", "other"},
+	"cs": {"one", "few", "many", "other"},
+	"cy": {"zero", "one", "two", "few", "many", "other"},
+	"es": {"one", "many", "other"},
+	"fr": {"one", "many", "other"},
+	"ga": {"one", "two", "few", "many", "other"},
+	"he": {"one", "two", "other"},
+	"hr": {"one", "few", "other"},
+	"id": {"other"},
+	"it": {"one", "many", "other"},
+	"ja": {"other"},
+	"km": {"other"},
+	"ko": {"other"},
+	"lt": {"one", "few", "many", "other"},
+	"lv": {"zero", "one", "other"},
+	"ms": {"other"},
+	"my": {"other"},
+	"pl": {"one", "few", "many", "other"},
+	"pt": {"one", "many", "other"},
+	"ro": {"one", "few", "other"},
+	"ru": {"one", "few", "many", "other"},
+	"sk": {"one", "few", "many", "other"},
+	"sl": {"one", "two", "few", "other"},
+	"sr": {"one", "few", "other"},
+	"th": {"other"},
+	"uk": {"one", "few", "many", "other"},
+	"vi": {"other"},
+	"zh": {"other"},
+}
+
+// Categories of cardinal plurals that only large numbers take, as in
+// "1 000 000 de fichiers", by language. Files seldom have them.
+var optionalPluralCategories = map[string]string{
+	"es": "many",
+	"fr": "many",
+	"it": "many",
+	"pt": "many",
+}
+
+// Returns the categories of cardinal plurals of language, as CLDR names
+// them: "one" and "other" for languages it does not know. The optional
+// categories are left out.
+func PluralCategories(language string) []string {
+	var categories []string
+
+	for _, category := range cldrPluralCategories(language) {
+		if !isOptionalPlural(language, category) {
+			categories = append(categories, category)
+		}
+	}
+
+	return categories
+}
+
+// cldrPluralCategories returns the categories of cardinal plurals of
+// language, the optional ones included.
+func cldrPluralCategories(language string) []string {
+	if categories, ok := pluralCategories[baseLanguage(language)]; ok {
+		return categories
+	}
+
+	return []string{"one", "other"}
+}
+
+func isOptionalPlural(language string, category string) bool {
+	return optionalPluralCategories[baseLanguage(language)] == category
+}
+
+// baseLanguage returns the language of a tag, in lower case, without its
+// region or script.
+func baseLanguage(language string) string {
+	language = strings.ToLower(language)
+
+	if index := strings.IndexAny(language, "-_"); index >= 0 {
+		language = language[:index]
+	}
+
+	return language
+}
+
+// lineStart returns the offset of the start of the line of offset in data,
+// if only spaces are before it on the line, or offset.
+func lineStart(data []byte, offset int) int {
+	for i := offset - 1; i >= 0; i-- {
+		if data[i] == '\n' {
+			return i + 1
+		}
+
+		if data[i] != ' ' && data[i] != '\t' {
+			return offset
+		}
+	}
+
+	return 0
+}
+
+// decodeUnicode returns data, in UTF-8, and its encoding if it is in
+// UTF-16 with a byte order mark rather than in UTF-8.
+func decodeUnicode(data []byte) ([]byte, encoding.Encoding, error) {
+	var e encoding.Encoding
+
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		e = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		e = unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	default:
+		return data, nil, nil
+	}
+
+	data, err := e.NewDecoder().Bytes(data)
+
+	return data, e, err
+}
+
+// detectNewline returns the line ending of data.
+func detectNewline(data []byte) string {
+	if strings.Contains(string(data), "\r\n") {
+		return "\r\n"
+	}
+
+	return "\n"
+}
+
+// isLanguageTag returns true if name is a language, with a region or not,
+// as fr or pt-BR.
+func isLanguageTag(name string) bool {
+	parts := strings.Split(name, "-")
+	return len(parts) <= 2 && isLanguageCode(parts[0]) && (len(parts) == 1 || isRegionCode(parts[1]))
+}
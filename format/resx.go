@@ -0,0 +1,288 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// RESX reads and writes .NET resource files, as Resources.xx.resx. A data
+// element holding a string is a trans-unit whose id is its name, and its
+// comment is a note from "developer". Data of other types, and properties
+// of designers, are left out.
+//
+// The language of a file is told by the culture before its extension, the
+// file without one, as Resources.resx, being the one of the source
+// language.
+//
+// Translations are written in place of the values of a file, and the data
+// missing from it are added at its end.
+type RESX struct{}
+
+func init() {
+	Register(RESX{})
+}
+
+func (RESX) Name() string {
+	return "resx"
+}
+
+func (RESX) Extensions() []string {
+	return []string{".resx"}
+}
+
+func (RESX) Sniff(data []byte) bool {
+	return xmlRoot(data) == "root" && bytes.Contains(data, []byte("<resheader"))
+}
+
+func (RESX) Language(path string) (string, bool) {
+	_, language := resxLocale(path)
+	return language, true
+}
+
+func (RESX) SourcePath(path string, sourceLanguage string) string {
+	base, _ := resxLocale(path)
+	return filepath.Join(filepath.Dir(path), base+filepath.Ext(path))
+}
+
+// resxLocale returns the base name of the file at path and the language of
+// its culture, if any.
+func resxLocale(path string) (string, string) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	index := strings.LastIndex(name, ".")
+
+	if index < 0 {
+		return name, ""
+	}
+
+	culture := name[index+1:]
+
+	if !isLanguageCode(strings.SplitN(culture, "-", 2)[0]) {
+		return name, ""
+	}
+
+	return name[:index], culture
+}
+
+func (x RESX) Read(input io.Reader, fn xliff.WalkFunc) error {
+	_, err := readResources(x, input, nil, "resx", fn)
+	return err
+}
+
+func (x RESX) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return readResources(x, input, output, "resx", fn)
+}
+
+func (x RESX) ReadTranslation(source io.Reader, target io.Reader, language string, fn xliff.WalkFunc) error {
+	return readTranslation(x, source, target, language, "resx", fn)
+}
+
+func (x RESX) WriteTranslation(source io.Reader, target io.Reader, output io.Writer, language string, fn xliff.WalkFunc) (bool, error) {
+	return writeTranslation(x, source, target, output, language, "resx", fn)
+}
+
+const resxFile = `<?xml version="1.0" encoding="utf-8"?>
+<root>
+  <resheader name="resmimetype">
+    <value>text/microsoft-resx</value>
+  </resheader>
+  <resheader name="version">
+    <value>2.0</value>
+  </resheader>
+  <resheader name="reader">
+    <value>System.Resources.ResXResourceReader, System.Windows.Forms, Version=4.0.0.0, Culture=neutral, PublicKeyToken=b77a5c561934e089</value>
+  </resheader>
+  <resheader name="writer">
+    <value>System.Resources.ResXResourceWriter, System.Windows.Forms, Version=4.0.0.0, Culture=neutral, PublicKeyToken=b77a5c561934e089</value>
+  </resheader>
+</root>
+`
+
+func (RESX) decode(data []byte) (*resourceFile, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte(resxFile)
+	}
+
+	f := &resourceFile{
+		data:      data,
+		groupEnds: make(map[string]int),
+		newline:   detectNewline(data),
+	}
+
+	r := &resxReader{newXMLResourceReader(f, "resx")}
+
+	if err := r.read(); err != nil {
+		return nil, err
+	}
+
+	if f.indent == "" {
+		f.indent = "  "
+	}
+
+	return f, nil
+}
+
+func (RESX) encode(f *resourceFile, r resource, value string) string {
+	if r.markup {
+		return value
+	}
+
+	return escapeText(value)
+}
+
+func (x RESX) insert(f *resourceFile, resources []resource) []edit {
+	var text string
+
+	for _, r := range resources {
+		text += f.indent + "<data name=\"" + escapeAttribute(r.id) + "\" xml:space=\"preserve\">" + f.newline +
+			f.indent + f.indent + "<value>" + x.encode(f, r, r.value) + "</value>" + f.newline +
+			f.indent + "</data>" + f.newline
+	}
+
+	return []edit{{from: f.end, to: f.end, text: text}}
+}
+
+// resxReader reads the data of a file.
+type resxReader struct {
+	xmlResourceReader
+}
+
+// read reads the root element and the data it holds.
+func (r *resxReader) read() error {
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return r.syntaxError("no root element")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+
+		if !ok {
+			continue
+		}
+
+		if start.Name.Local != "root" {
+			return r.syntaxError("root element is " + start.Name.Local + ", not root")
+		}
+
+		if r.selfClosing() {
+			r.expand(start)
+			return r.read()
+		}
+
+		return r.root()
+	}
+}
+
+// root reads the members of the root element.
+func (r *resxReader) root() error {
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return r.syntaxError("root element is not closed")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if r.file.indent == "" {
+				r.file.indent = string(r.file.data[lineStart(r.file.data, r.offset):r.offset])
+			}
+
+			if t.Name.Local == "data" && isResxString(t) {
+				err = r.data(t)
+			} else {
+				err = r.skip()
+			}
+
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			r.file.end = lineStart(r.file.data, r.offset)
+			return nil
+		}
+	}
+}
+
+// data reads the value and comment of a data element holding a string.
+func (r *resxReader) data(start xml.StartElement) error {
+	if r.selfClosing() {
+		return r.skip()
+	}
+
+	var value *resource
+	var comment string
+
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return r.syntaxError("data element is not closed")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "value":
+				var read resource
+
+				read, err = r.value(t, androidAttribute(start, "name"))
+				value = &read
+			case "comment":
+				comment, err = r.text()
+			default:
+				err = r.skip()
+			}
+
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if value == nil {
+				return nil
+			}
+
+			if comment = strings.TrimSpace(comment); comment != "" {
+				value.notes = []xliff.Note{{Data: comment, From: "developer"}}
+			}
+
+			r.file.resources = append(r.file.resources, *value)
+
+			return nil
+		}
+	}
+}
+
+// isResxString returns true if the data element started by start holds a
+// string rather than an object or a property of a designer.
+func isResxString(start xml.StartElement) bool {
+	name := androidAttribute(start, "name")
+
+	if name == "" || strings.HasPrefix(name, ">>") || strings.HasPrefix(name, "$this.") {
+		return false
+	}
+
+	return androidAttribute(start, "type") == "" && androidAttribute(start, "mimetype") == ""
+}
@@ -0,0 +1,312 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// Strings reads and writes Apple strings files, as the Localizable.strings
+// of the xx.lproj folders of an app. A string is a trans-unit whose id is
+// its key, and the comment before it is a note from "developer". Files in
+// UTF-16 are written back in UTF-16.
+//
+// Translations are written in place of the strings of a file, comments and
+// ordering being kept, and strings missing from it are added at its end.
+type Strings struct {
+	lproj
+}
+
+func init() {
+	Register(Strings{})
+}
+
+func (Strings) Name() string {
+	return "strings"
+}
+
+func (Strings) Extensions() []string {
+	return []string{".strings"}
+}
+
+func (s Strings) Read(input io.Reader, fn xliff.WalkFunc) error {
+	_, err := readResources(s, input, nil, "plaintext", fn)
+	return err
+}
+
+func (s Strings) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return readResources(s, input, output, "plaintext", fn)
+}
+
+func (s Strings) ReadTranslation(source io.Reader, target io.Reader, language string, fn xliff.WalkFunc) error {
+	return readTranslation(s, source, target, language, "plaintext", fn)
+}
+
+func (s Strings) WriteTranslation(source io.Reader, target io.Reader, output io.Writer, language string, fn xliff.WalkFunc) (bool, error) {
+	return writeTranslation(s, source, target, output, language, "plaintext", fn)
+}
+
+// Comment that genstrings gives strings that have none.
+const noComment = "No comment provided by engineer."
+
+func (Strings) decode(data []byte) (*resourceFile, error) {
+	data, e, err := decodeUnicode(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &resourceFile{
+		data:      data,
+		end:       len(data),
+		groupEnds: make(map[string]int),
+		newline:   detectNewline(data),
+		encoding:  e,
+	}
+
+	p := &stringsParser{data: data}
+
+	if bytes.HasPrefix(data, []byte("\xef\xbb\xbf")) {
+		p.offset = 3
+	}
+
+	for {
+		comment, err := p.space()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.offset == len(data) {
+			return f, nil
+		}
+
+		key, _, _, err := p.string()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.space(); err != nil {
+			return nil, err
+		}
+
+		if p.next(';') {
+			continue
+		}
+
+		if !p.next('=') {
+			return nil, p.syntaxError("expected = after " + strconv.Quote(key))
+		}
+
+		if _, err := p.space(); err != nil {
+			return nil, err
+		}
+
+		quoted := p.offset < len(data) && data[p.offset] == '"'
+		value, from, to, err := p.string()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.space(); err != nil {
+			return nil, err
+		}
+
+		if !p.next(';') {
+			return nil, p.syntaxError("expected ; after the value of " + strconv.Quote(key))
+		}
+
+		r := resource{id: key, value: value, translate: true, from: from, to: to}
+
+		if !quoted {
+			r.open = `"`
+			r.close = `"`
+		}
+
+		if comment != "" && comment != noComment {
+			r.notes = []xliff.Note{{Data: comment, From: "developer"}}
+		}
+
+		f.resources = append(f.resources, r)
+	}
+}
+
+func (Strings) encode(f *resourceFile, r resource, value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(value)
+}
+
+func (s Strings) insert(f *resourceFile, resources []resource) []edit {
+	var text string
+
+	if len(f.data) > 0 && !bytes.HasSuffix(f.data, []byte("\n")) {
+		text = f.newline
+	}
+
+	for _, r := range resources {
+		if len(f.data) > 0 || text != "" {
+			text += f.newline
+		}
+
+		for _, note := range r.notes {
+			text += "/* " + strings.Replace(note.Data, "*/", "* /", -1) + " */" + f.newline
+		}
+
+		text += `"` + s.encode(f, r, r.id) + `" = "` + s.encode(f, r, r.value) + `";` + f.newline
+	}
+
+	return []edit{{from: f.end, to: f.end, text: text}}
+}
+
+// stringsParser reads the tokens of a strings file.
+type stringsParser struct {
+	data   []byte
+	offset int
+}
+
+func (p *stringsParser) syntaxError(message string) error {
+	line := bytes.Count(p.data[:p.offset], []byte("\n")) + 1
+	return &SyntaxError{Format: "strings", Line: line, Msg: message}
+}
+
+// next reads c if it is the next character.
+func (p *stringsParser) next(c byte) bool {
+	if p.offset < len(p.data) && p.data[p.offset] == c {
+		p.offset++
+		return true
+	}
+
+	return false
+}
+
+// space reads spaces and comments, and returns the last comment.
+func (p *stringsParser) space() (string, error) {
+	var comment string
+
+	for p.offset < len(p.data) {
+		rest := p.data[p.offset:]
+
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r' || rest[0] == '\n':
+			p.offset++
+		case bytes.HasPrefix(rest, []byte("/*")):
+			end := bytes.Index(rest[2:], []byte("*/"))
+
+			if end < 0 {
+				return "", p.syntaxError("comment is not closed")
+			}
+
+			comment = strings.TrimSpace(string(rest[2 : end+2]))
+			p.offset += end + 4
+		case bytes.HasPrefix(rest, []byte("//")):
+			end := bytes.IndexByte(rest, '\n')
+
+			if end < 0 {
+				end = len(rest)
+			}
+
+			comment = strings.TrimSpace(string(rest[2:end]))
+			p.offset += end
+		default:
+			return comment, nil
+		}
+	}
+
+	return comment, nil
+}
+
+// string reads a quoted or unquoted string, and returns it unescaped with
+// the offsets of its raw text.
+func (p *stringsParser) string() (string, int, int, error) {
+	if !p.next('"') {
+		from := p.offset
+
+		for p.offset < len(p.data) && isUnquoted(p.data[p.offset]) {
+			p.offset++
+		}
+
+		if p.offset == from {
+			return "", 0, 0, p.syntaxError("expected a string")
+		}
+
+		return string(p.data[from:p.offset]), from, p.offset, nil
+	}
+
+	from := p.offset
+
+	var value strings.Builder
+
+	for p.offset < len(p.data) {
+		c := p.data[p.offset]
+		p.offset++
+
+		switch c {
+		case '"':
+			return value.String(), from, p.offset - 1, nil
+		case '\\':
+			if p.offset == len(p.data) {
+				break
+			}
+
+			escaped := p.data[p.offset]
+			p.offset++
+
+			switch escaped {
+			case 'n':
+				value.WriteByte('\n')
+			case 'r':
+				value.WriteByte('\r')
+			case 't':
+				value.WriteByte('\t')
+			case 'U', 'u':
+				if p.offset+4 <= len(p.data) {
+					if code, err := strconv.ParseUint(string(p.data[p.offset:p.offset+4]), 16, 32); err == nil {
+						value.WriteRune(rune(code))
+						p.offset += 4
+						continue
+					}
+				}
+
+				value.WriteByte(escaped)
+			default:
+				value.WriteByte(escaped)
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+
+	return "", 0, 0, p.syntaxError("string is not closed")
+}
+
+// isUnquoted returns true if c can be part of an unquoted string.
+func isUnquoted(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_$./:-", c) >= 0
+}
+
+// lproj tells the language of Apple resources by their xx.lproj folder.
+// Base.lproj, which holds interface files, tells none.
+type lproj struct{}
+
+func (lproj) Language(path string) (string, bool) {
+	folder := filepath.Base(filepath.Dir(path))
+
+	if !strings.HasSuffix(folder, ".lproj") || folder == "Base.lproj" {
+		return "", false
+	}
+
+	return strings.Replace(strings.TrimSuffix(folder, ".lproj"), "_", "-", -1), true
+}
+
+func (lproj) SourcePath(path string, sourceLanguage string) string {
+	return filepath.Join(filepath.Dir(filepath.Dir(path)), sourceLanguage+".lproj", filepath.Base(path))
+}
@@ -0,0 +1,325 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// Stringsdict reads and writes Apple stringsdict files, the property lists
+// of plural rules of the xx.lproj folders of an app. Each dictionary is a
+// group of its key holding a trans-unit for each of its strings, whose id
+// is the key of the string. The strings of a dictionary of plural rules are
+// given for each plural category of the target language. The types of
+// format specifiers are not translatable.
+//
+// Translations are written in place of the strings of a file, and the
+// strings missing from it are added to their dictionaries.
+type Stringsdict struct {
+	lproj
+}
+
+func init() {
+	Register(Stringsdict{})
+}
+
+func (Stringsdict) Name() string {
+	return "stringsdict"
+}
+
+func (Stringsdict) Extensions() []string {
+	return []string{".stringsdict"}
+}
+
+func (Stringsdict) Sniff(data []byte) bool {
+	return xmlRoot(data) == "plist" && bytes.Contains(data, []byte("NSStringLocalizedFormatKey"))
+}
+
+func (s Stringsdict) Read(input io.Reader, fn xliff.WalkFunc) error {
+	_, err := readResources(s, input, nil, "xml", fn)
+	return err
+}
+
+func (s Stringsdict) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return readResources(s, input, output, "xml", fn)
+}
+
+func (s Stringsdict) ReadTranslation(source io.Reader, target io.Reader, language string, fn xliff.WalkFunc) error {
+	return readTranslation(s, source, target, language, "xml", fn)
+}
+
+func (s Stringsdict) WriteTranslation(source io.Reader, target io.Reader, output io.Writer, language string, fn xliff.WalkFunc) (bool, error) {
+	return writeTranslation(s, source, target, output, language, "xml", fn)
+}
+
+const stringsdictFile = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+</dict>
+</plist>
+`
+
+const (
+	formatSpecTypeKey  = "NSStringFormatSpecTypeKey"
+	formatValueTypeKey = "NSStringFormatValueTypeKey"
+	pluralRuleType     = "NSStringPluralRuleType"
+)
+
+func (Stringsdict) decode(data []byte) (*resourceFile, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		data = []byte(stringsdictFile)
+	}
+
+	f := &resourceFile{
+		data:      data,
+		groupEnds: make(map[string]int),
+		newline:   detectNewline(data),
+	}
+
+	r := &stringsdictReader{newXMLResourceReader(f, "stringsdict")}
+
+	if err := r.read(); err != nil {
+		return nil, err
+	}
+
+	if f.indent == "" {
+		f.indent = "\t"
+	}
+
+	return f, nil
+}
+
+func (Stringsdict) encode(f *resourceFile, r resource, value string) string {
+	if r.markup {
+		return value
+	}
+
+	return escapeText(value)
+}
+
+func (s Stringsdict) insert(f *resourceFile, resources []resource) []edit {
+	var edits []edit
+
+	for i := 0; i < len(resources); {
+		groups := resources[i].groups
+		depth := len(groups)
+
+		for depth > 0 {
+			if _, ok := f.groupEnds[xliff.GroupPath(groups[:depth])]; ok {
+				break
+			}
+
+			depth--
+		}
+
+		offset := f.end
+		if depth > 0 {
+			offset = f.groupEnds[xliff.GroupPath(groups[:depth])]
+		}
+
+		// Resources of the same existing dictionary, or of the same new one
+		// in it, are added together.
+		shared := depth
+		if depth < len(groups) {
+			shared++
+		}
+
+		end := i + 1
+		for end < len(resources) && sameGroups(resources[end].groups, groups, shared) && (shared > depth || len(resources[end].groups) == depth) {
+			end++
+		}
+
+		edits = append(edits, edit{from: offset, to: offset, text: s.render(f, resources[i:end], depth)})
+		i = end
+	}
+
+	return edits
+}
+
+// render returns the keys and values of resources, and the dictionaries
+// holding them, nested in as many groups as depth.
+func (s Stringsdict) render(f *resourceFile, resources []resource, depth int) string {
+	var text string
+
+	indent := strings.Repeat(f.indent, depth+1)
+
+	for i := 0; i < len(resources); {
+		r := resources[i]
+
+		if len(r.groups) == depth {
+			text += indent + "<key>" + escapeText(r.id) + "</key>" + f.newline +
+				indent + "<string>" + s.encode(f, r, r.value) + "</string>" + f.newline
+			i++
+			continue
+		}
+
+		group := r.groups[depth]
+
+		end := i + 1
+		for end < len(resources) && len(resources[end].groups) > depth && resources[end].groups[depth] == group {
+			end++
+		}
+
+		text += indent + "<key>" + escapeText(group.ID) + "</key>" + f.newline +
+			indent + "<dict>" + f.newline +
+			s.render(f, resources[i:end], depth+1) +
+			indent + "</dict>" + f.newline
+		i = end
+	}
+
+	return text
+}
+
+// sameGroups returns true if a and b have the same first count groups.
+func sameGroups(a []*xliff.Group, b []*xliff.Group, count int) bool {
+	if len(a) < count || len(b) < count {
+		return false
+	}
+
+	for i := 0; i < count; i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stringsdictReader reads the dictionaries of a file.
+type stringsdictReader struct {
+	xmlResourceReader
+}
+
+// read reads the plist element and its dictionary.
+func (r *stringsdictReader) read() error {
+	plist := false
+
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return r.syntaxError("no dictionary in the property list")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+
+		if !ok {
+			continue
+		}
+
+		if !plist {
+			if start.Name.Local != "plist" {
+				return r.syntaxError("root element is " + start.Name.Local + ", not plist")
+			}
+
+			plist = true
+			continue
+		}
+
+		if start.Name.Local != "dict" {
+			return r.syntaxError("element " + start.Name.Local + " in place of the dictionary of the property list")
+		}
+
+		if r.selfClosing() {
+			r.expand(start)
+			return r.read()
+		}
+
+		return r.dict(nil)
+	}
+}
+
+// dict reads the keys and values of a dictionary nested in groups.
+func (r *stringsdictReader) dict(groups []*xliff.Group) error {
+	start := len(r.file.resources)
+	key := ""
+	plural := false
+
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return r.syntaxError("dictionary is not closed")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if r.file.indent == "" && len(groups) == 0 {
+				r.file.indent = string(r.file.data[lineStart(r.file.data, r.offset):r.offset])
+			}
+
+			switch t.Name.Local {
+			case "key":
+				key, err = r.text()
+			case "string":
+				var value resource
+
+				value, err = r.value(t, key)
+				value.groups = groups
+				value.translate = key != formatSpecTypeKey && key != formatValueTypeKey
+				plural = plural || key == formatSpecTypeKey && value.value == pluralRuleType
+				r.file.resources = append(r.file.resources, value)
+			case "dict":
+				if r.selfClosing() {
+					err = r.skip()
+					break
+				}
+
+				group := &xliff.Group{ID: key, Resname: key}
+				err = r.dict(append(append([]*xliff.Group{}, groups...), group))
+			default:
+				err = r.skip()
+			}
+
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			end := lineStart(r.file.data, r.offset)
+
+			if len(groups) == 0 {
+				r.file.end = end
+			} else {
+				r.file.groupEnds[xliff.GroupPath(groups)] = end
+			}
+
+			if plural {
+				for i := start; i < len(r.file.resources); i++ {
+					value := &r.file.resources[i]
+
+					if len(value.groups) == len(groups) && isPluralCategory(value.id) {
+						value.plural = true
+					}
+				}
+			}
+
+			return nil
+		}
+	}
+}
+
+// isPluralCategory returns true if name is a category of plurals of CLDR.
+func isPluralCategory(name string) bool {
+	switch name {
+	case "zero", "one", "two", "few", "many", "other":
+		return true
+	}
+
+	return false
+}
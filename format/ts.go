@@ -0,0 +1,470 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// TS reads and writes the translation files of Qt Linguist. A context is a
+// group whose id is its name, and a message of it a trans-unit whose id is
+// its id attribute, or else its source, prefixed by its comment and an EOT
+// character if it has one, as gettext does for contexts. A numerus message
+// is a group of that id holding a trans-unit for each numerus form of the
+// target language, numbered from 0. Extra comments and comments are notes
+// from "developer", translator comments notes from "translator" and
+// locations notes from "reference". Unfinished translations are in the
+// needs-review-translation state. Obsolete and vanished messages are left
+// out.
+//
+// The language of a file is told by its language attribute, or else by the
+// suffix of its name, as app_fr.ts. As .ts is the extension of TypeScript
+// as well, only files with such a suffix, or in a translations, i18n or
+// locale folder, are told to be Qt files.
+//
+// Translations are written in place of the translation elements of the
+// messages they changed, the rest of the file being written back as read.
+type TS struct{}
+
+func init() {
+	Register(TS{})
+}
+
+func (TS) Name() string {
+	return "ts"
+}
+
+func (TS) Extensions() []string {
+	return []string{".ts"}
+}
+
+func (TS) Match(path string) bool {
+	if strings.HasSuffix(path, ".d.ts") {
+		return false
+	}
+
+	if _, language := propertiesLocale(path); language != "" {
+		return true
+	}
+
+	for folder := filepath.Dir(path); folder != filepath.Dir(folder); folder = filepath.Dir(folder) {
+		switch strings.ToLower(filepath.Base(folder)) {
+		case "translations", "i18n", "locale", "locales":
+			return true
+		}
+	}
+
+	return false
+}
+
+func (TS) Sniff(data []byte) bool {
+	return xmlRoot(data) == "TS"
+}
+
+func (TS) Language(path string) (string, bool) {
+	_, language := propertiesLocale(path)
+	return language, language != ""
+}
+
+func (TS) SourcePath(path string, sourceLanguage string) string {
+	base, _ := propertiesLocale(path)
+	return filepath.Join(filepath.Dir(path), base+"_"+strings.Replace(sourceLanguage, "-", "_", -1)+filepath.Ext(path))
+}
+
+func (TS) ContentLanguage(input io.Reader) (string, bool) {
+	decoder := xml.NewDecoder(input)
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	for {
+		token, err := decoder.RawToken()
+
+		if err != nil {
+			return "", false
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			language := strings.Replace(androidAttribute(start, "language"), "_", "-", -1)
+			return language, start.Name.Local == "TS" && language != ""
+		}
+	}
+}
+
+func (TS) Read(input io.Reader, fn xliff.WalkFunc) error {
+	_, err := readTS(input, nil, fn)
+	return err
+}
+
+func (TS) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return readTS(input, output, fn)
+}
+
+// tsMessage is a message of a TS file and the offsets of its translation.
+type tsMessage struct {
+	context  string
+	id       string
+	source   string
+	comment  string
+	numerus  bool
+	obsolete bool
+
+	extraComment      string
+	translatorComment string
+	locations         []string
+	forms             []string
+	unfinished        bool
+
+	// Offsets of the translation element, its attributes, the indentation
+	// of its line and the one of its numerus forms.
+	from, to   int
+	attributes []xml.Attr
+	indent     string
+	formIndent string
+}
+
+// readTS reads the messages of a TS file from input and calls fn for each
+// of their units. If output is not nil, the file is written to it with the
+// translations fn changes.
+func readTS(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	data, err := ioutil.ReadAll(input)
+
+	if err != nil {
+		return false, err
+	}
+
+	f := &resourceFile{data: data, newline: detectNewline(data)}
+	r := newXMLResourceReader(f, "ts")
+	file := xliff.File{Datatype: "x-qt-ts"}
+	context := ""
+
+	var edits []edit
+
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		start, ok := token.(xml.StartElement)
+
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "TS":
+			file.SourceLanguage = strings.Replace(androidAttribute(start, "sourcelanguage"), "_", "-", -1)
+			file.TargetLanguage = strings.Replace(androidAttribute(start, "language"), "_", "-", -1)
+		case "context":
+			context = ""
+		case "name":
+			if context, err = r.text(); err != nil {
+				return false, err
+			}
+		case "message":
+			message, err := readTSMessage(&r, start, context)
+
+			if err != nil {
+				return false, err
+			}
+
+			if message.obsolete {
+				continue
+			}
+
+			changed, err := message.walk(&file, fn)
+
+			if err != nil {
+				return false, err
+			}
+
+			if changed {
+				edits = append(edits, edit{from: message.from, to: message.to, text: message.render(f.newline)})
+			}
+		}
+	}
+
+	if output == nil {
+		return false, nil
+	}
+
+	return len(edits) > 0, f.write(output, edits)
+}
+
+// readTSMessage reads the message of context just started by start.
+func readTSMessage(r *xmlResourceReader, start xml.StartElement, context string) (*tsMessage, error) {
+	message := &tsMessage{
+		context: context,
+		id:      androidAttribute(start, "id"),
+		numerus: androidAttribute(start, "numerus") == "yes",
+	}
+
+	indent := string(r.file.data[lineStart(r.file.data, r.offset):r.offset])
+
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return nil, r.syntaxError("message element is not closed")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.EndElement:
+			if message.to == 0 {
+				return nil, r.syntaxError("message element has no translation")
+			}
+
+			return message, nil
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "source":
+				message.source, err = r.text()
+			case "comment":
+				message.comment, err = r.text()
+			case "extracomment":
+				message.extraComment, err = r.text()
+			case "translatorcomment":
+				message.translatorComment, err = r.text()
+			case "location":
+				location := androidAttribute(t, "filename")
+
+				if line := androidAttribute(t, "line"); line != "" {
+					location += ":" + line
+				}
+
+				message.locations = append(message.locations, location)
+				err = r.skip()
+			case "translation":
+				err = message.readTranslation(r, t, indent)
+			default:
+				err = r.skip()
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// readTranslation reads the translation of the message just started by
+// start, in a message element of the given indentation.
+func (message *tsMessage) readTranslation(r *xmlResourceReader, start xml.StartElement, messageIndent string) error {
+	data := r.file.data
+	kind := androidAttribute(start, "type")
+
+	message.from = r.offset
+	message.unfinished = kind == "unfinished"
+	message.obsolete = kind == "obsolete" || kind == "vanished"
+	message.indent = string(data[lineStart(data, r.offset):r.offset])
+	message.formIndent = message.indent + "    "
+
+	if strings.HasPrefix(message.indent, messageIndent) && len(message.indent) > len(messageIndent) {
+		message.formIndent = message.indent + message.indent[len(messageIndent):]
+	}
+
+	for _, attribute := range start.Attr {
+		if attribute.Name.Local != "type" {
+			message.attributes = append(message.attributes, attribute)
+		}
+	}
+
+	var err error
+
+	if !message.numerus {
+		var text string
+
+		text, err = r.text()
+		message.forms = []string{text}
+	} else if r.selfClosing() {
+		err = r.skip()
+	} else {
+		err = message.readForms(r)
+	}
+
+	message.to = int(r.decoder.InputOffset())
+
+	return err
+}
+
+// readForms reads the numerus forms of the translation just started.
+func (message *tsMessage) readForms(r *xmlResourceReader) error {
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return r.syntaxError("translation element is not closed")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			if t.Name.Local != "numerusform" {
+				if err := r.skip(); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			form, err := r.text()
+
+			if err != nil {
+				return err
+			}
+
+			message.forms = append(message.forms, form)
+		}
+	}
+}
+
+// walk calls fn for the units of the message and returns true if fn
+// changed any of their targets, which are kept.
+func (message *tsMessage) walk(file *xliff.File, fn xliff.WalkFunc) (bool, error) {
+	key := message.id
+	if key == "" {
+		key = message.source
+
+		if message.comment != "" {
+			key = message.comment + "\x04" + message.source
+		}
+	}
+
+	groups := []*xliff.Group{{ID: message.context, Resname: message.context}}
+	count := 1
+
+	if message.numerus {
+		groups = append(groups, &xliff.Group{ID: key, Resname: message.context})
+		count = len(message.forms)
+
+		if count == 0 {
+			count = len(PluralCategories(file.TargetLanguage))
+		}
+	}
+
+	changed := false
+	forms := make([]string, count)
+	unfinished := false
+
+	for n := range forms {
+		id := key
+		if message.numerus {
+			id = strconv.Itoa(n)
+		}
+
+		transUnit := message.transUnit(file, id, n)
+		before := transUnit.Target
+
+		if err := fn(file, groups, &transUnit); err != nil {
+			return false, err
+		}
+
+		target := transUnit.Target
+
+		if target.Data != before.Data || target.State != before.State {
+			changed = true
+		}
+
+		forms[n] = target.Data
+		unfinished = unfinished || target.Data == "" || target.State == "new" || strings.HasPrefix(target.State, "needs-")
+	}
+
+	message.forms = forms
+	message.unfinished = unfinished
+
+	return changed, nil
+}
+
+// transUnit returns the unit of the message with the given id, translated
+// by its numerus form of the given index.
+func (message *tsMessage) transUnit(file *xliff.File, id string, index int) xliff.TransUnit {
+	var notes []xliff.Note
+
+	if message.translatorComment != "" {
+		notes = append(notes, xliff.Note{From: "translator", Data: message.translatorComment})
+	}
+	if message.extraComment != "" {
+		notes = append(notes, xliff.Note{From: "developer", Data: message.extraComment})
+	}
+	if message.comment != "" {
+		notes = append(notes, xliff.Note{From: "developer", Data: message.comment})
+	}
+	if len(message.locations) > 0 {
+		notes = append(notes, xliff.Note{From: "reference", Data: strings.Join(message.locations, " ")})
+	}
+
+	target := xliff.Target{Language: file.TargetLanguage}
+
+	if index < len(message.forms) && message.forms[index] != "" {
+		target.Data = message.forms[index]
+		target.State = "translated"
+
+		if message.unfinished {
+			target.State = "needs-review-translation"
+		}
+	}
+
+	return xliff.TransUnit{
+		ID:      id,
+		Resname: message.context,
+		Source:  xliff.Source{Data: message.source},
+		Target:  target,
+		Notes:   notes,
+	}
+}
+
+// render returns the translation element of the message, unfinished if one
+// of its forms is not translated or is not in a final state.
+func (message *tsMessage) render(newline string) string {
+	var b strings.Builder
+
+	b.WriteString("<translation")
+
+	if message.unfinished {
+		b.WriteString(` type="unfinished"`)
+	}
+
+	for _, attribute := range message.attributes {
+		b.WriteString(" " + qualifiedName(attribute.Name) + `="` + escapeAttribute(attribute.Value) + `"`)
+	}
+
+	b.WriteString(">")
+
+	if message.numerus {
+		for _, form := range message.forms {
+			b.WriteString(newline + message.formIndent + "<numerusform>" + escapeText(form) + "</numerusform>")
+		}
+
+		b.WriteString(newline + message.indent)
+	} else {
+		b.WriteString(escapeText(message.forms[0]))
+	}
+
+	b.WriteString("</translation>")
+
+	return b.String()
+}
@@ -0,0 +1,42 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"io"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// XLIFF reads and writes XLIFF 1.2, 2.0 and 2.1 documents.
+type XLIFF struct{}
+
+func init() {
+	Register(XLIFF{})
+}
+
+func (XLIFF) Name() string {
+	return "xliff"
+}
+
+func (XLIFF) Extensions() []string {
+	return []string{".xliff", ".xlf"}
+}
+
+func (XLIFF) Sniff(data []byte) bool {
+	return xmlRoot(data) == "xliff"
+}
+
+func (XLIFF) Read(input io.Reader, fn xliff.WalkFunc) error {
+	return xliff.Stream(input, fn)
+}
+
+func (XLIFF) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return xliff.Rewrite(input, output, fn)
+}
+
+func (XLIFF) Validate(input io.Reader) []xliff.ValidationError {
+	return xliff.ValidateStream(input)
+}
@@ -0,0 +1,243 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/dragosv/delta/xliff"
+)
+
+// xmlResourceReader reads the tokens of the XML file of a monolingual
+// format, keeping the offset of each.
+type xmlResourceReader struct {
+	file    *resourceFile
+	format  string
+	decoder *xml.Decoder
+	// Offset of the last token read.
+	offset int
+	// Comment before the next resource.
+	comment string
+}
+
+func newXMLResourceReader(file *resourceFile, format string) xmlResourceReader {
+	r := xmlResourceReader{file: file, format: format}
+	r.reset()
+
+	return r
+}
+
+// reset reads the file from its start again.
+func (r *xmlResourceReader) reset() {
+	r.decoder = xml.NewDecoder(bytes.NewReader(r.file.data))
+	r.decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+}
+
+// token returns the next token of the file.
+func (r *xmlResourceReader) token() (xml.Token, error) {
+	r.offset = int(r.decoder.InputOffset())
+
+	token, err := r.decoder.RawToken()
+
+	if err != nil && err != io.EOF {
+		return nil, r.syntaxError(err.Error())
+	}
+
+	return token, err
+}
+
+func (r *xmlResourceReader) syntaxError(message string) error {
+	line := bytes.Count(r.file.data[:r.offset], []byte("\n")) + 1
+	return &SyntaxError{Format: r.format, Line: line, Msg: message}
+}
+
+// selfClosing returns true if the last token read is an element with no
+// content.
+func (r *xmlResourceReader) selfClosing() bool {
+	end := int(r.decoder.InputOffset())
+	return end >= 2 && string(r.file.data[end-2:end]) == "/>"
+}
+
+// expand opens and closes the element with no content just started by
+// start, so that resources can be added to it, and resets the reader.
+func (r *xmlResourceReader) expand(start xml.StartElement) {
+	from := r.offset
+	to := int(r.decoder.InputOffset())
+	data := r.file.data
+	open := strings.TrimRight(string(data[from:to-2]), " \t") + ">"
+
+	r.file.data = append(append(append([]byte{}, data[:from]...), open+r.file.newline+"</"+qualifiedName(start.Name)+">"...), data[to:]...)
+	r.reset()
+}
+
+// skip reads up to the end of the element just started.
+func (r *xmlResourceReader) skip() error {
+	depth := 0
+
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return r.syntaxError("element is not closed")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			if depth == 0 {
+				return nil
+			}
+
+			depth--
+		}
+	}
+}
+
+// value reads the value of the element started by start as a resource:
+// its text, or its raw content if it holds markup.
+func (r *xmlResourceReader) value(start xml.StartElement, id string) (resource, error) {
+	elementStart := r.offset
+	from := int(r.decoder.InputOffset())
+	result := resource{id: id, translate: true}
+
+	if r.comment != "" {
+		result.notes = []xliff.Note{{Data: r.comment, From: "developer"}}
+		r.comment = ""
+	}
+
+	if r.selfClosing() {
+		result.from = elementStart
+		result.to = from
+		result.open = strings.TrimRight(string(r.file.data[elementStart:from-2]), " \t") + ">"
+		result.close = "</" + qualifiedName(start.Name) + ">"
+
+		return result, r.skip()
+	}
+
+	var text bytes.Buffer
+	depth := 0
+
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return result, r.syntaxError(start.Name.Local + " element is not closed")
+		}
+
+		if err != nil {
+			return result, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			result.markup = true
+			depth++
+		case xml.EndElement:
+			if depth > 0 {
+				depth--
+				continue
+			}
+
+			result.from = from
+			result.to = r.offset
+			raw := string(r.file.data[from:r.offset])
+
+			if strings.Contains(raw, "<![CDATA[") {
+				result.markup = true
+			}
+
+			if result.markup {
+				result.value = raw
+			} else {
+				result.value = text.String()
+			}
+
+			return result, nil
+		case xml.CharData:
+			text.Write(t)
+		case xml.Comment, xml.ProcInst, xml.Directive:
+			result.markup = true
+		}
+	}
+}
+
+// text reads the text of the element just started.
+func (r *xmlResourceReader) text() (string, error) {
+	var text bytes.Buffer
+
+	if r.selfClosing() {
+		return "", r.skip()
+	}
+
+	for {
+		token, err := r.token()
+
+		if err == io.EOF {
+			return "", r.syntaxError("element is not closed")
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := r.skip(); err != nil {
+				return "", err
+			}
+		case xml.EndElement:
+			return text.String(), nil
+		case xml.CharData:
+			text.Write(t)
+		}
+	}
+}
+
+// xmlRoot returns the local name of the root element of the XML file
+// starting with data, or an empty string if data is not XML.
+func xmlRoot(data []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.RawToken()
+
+		if err != nil {
+			return ""
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// qualifiedName returns name as written in the file.
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	return name.Space + ":" + name.Local
+}
+
+// escapeText returns text escaped as the content of an XML element.
+func escapeText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// escapeAttribute returns text escaped as the value of an XML attribute.
+func escapeAttribute(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", "\"", "&quot;").Replace(text)
+}
@@ -0,0 +1,604 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package format
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dragosv/delta/xliff"
+	"gopkg.in/yaml.v3"
+)
+
+// YAML reads and writes YAML locale files as Rails has them, whose strings
+// are nested under a root key of their language. A string is a trans-unit
+// whose id is its keys below the root joined by dots, and the comment
+// before its key is a note from "developer". The strings of a key of Rails
+// pluralization, whose keys are plural categories, are a group of the id of
+// the key holding a trans-unit for each plural category of the target
+// language. Sequences, values that are not strings and aliases are left
+// out.
+//
+// Only files whose root key is a language, or that are in a locales folder,
+// are locale files. The language of a file is told by its root key, or else
+// by the language of its name, as devise.fr.yml, or of its folder.
+//
+// Translations are written in place of the strings of a file, comments and
+// anchors being kept, and strings missing from it are added to the end of
+// their mappings.
+type YAML struct{}
+
+func init() {
+	Register(YAML{})
+}
+
+func (YAML) Name() string {
+	return "yaml"
+}
+
+func (YAML) Extensions() []string {
+	return []string{".yml", ".yaml"}
+}
+
+// Language tells the language of the path of files in a locales folder
+// only, as other YAML files, as ci.yml, are rather files of settings.
+func (YAML) Language(path string) (string, bool) {
+	if !isLocalesPath(path) {
+		return "", false
+	}
+
+	_, language := yamlLocale(path)
+	return language, language != ""
+}
+
+func (YAML) SourcePath(path string, sourceLanguage string) string {
+	index, language := yamlLocale(path)
+
+	if language == "" {
+		return path
+	}
+
+	return path[:index] + sourceLanguage + path[index+len(language):]
+}
+
+func (YAML) ContentLanguage(input io.Reader) (string, bool) {
+	var document yaml.Node
+
+	if err := yaml.NewDecoder(input).Decode(&document); err != nil {
+		return "", false
+	}
+
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode || len(document.Content[0].Content) == 0 {
+		return "", false
+	}
+
+	language := document.Content[0].Content[0].Value
+
+	if !isLanguageCode(strings.SplitN(strings.Replace(language, "_", "-", -1), "-", 2)[0]) {
+		return "", false
+	}
+
+	return language, true
+}
+
+// isLocalesPath returns true if a folder of path is a locales folder, as
+// config/locales of Rails.
+func isLocalesPath(path string) bool {
+	for _, folder := range strings.FieldsFunc(filepath.Dir(path), func(c rune) bool { return c == '/' || c == '\\' }) {
+		if folder == "locales" || folder == "locale" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// yamlLocale returns the offset in path and the language of the last part
+// of the name of the file at path, or else of its folder, that is a
+// language.
+func yamlLocale(path string) (int, string) {
+	name := strings.TrimSuffix(path, filepath.Ext(path))
+	start := strings.LastIndexAny(name, "./\\") + 1
+
+	if isLanguageTag(name[start:]) {
+		return start, name[start:]
+	}
+
+	folder := filepath.Dir(path)
+	start = len(folder) - len(filepath.Base(folder))
+
+	if isLanguageTag(folder[start:]) {
+		return start, folder[start:]
+	}
+
+	return 0, ""
+}
+
+func (y YAML) Read(input io.Reader, fn xliff.WalkFunc) error {
+	_, err := readResources(y, input, nil, "plaintext", fn)
+	return err
+}
+
+func (y YAML) Rewrite(input io.Reader, output io.Writer, fn xliff.WalkFunc) (bool, error) {
+	return readResources(y, input, output, "plaintext", fn)
+}
+
+func (y YAML) ReadTranslation(source io.Reader, target io.Reader, language string, fn xliff.WalkFunc) error {
+	return readTranslation(y, source, target, language, "plaintext", fn)
+}
+
+// WriteTranslation starts a file with no strings yet with the root key of
+// language.
+func (y YAML) WriteTranslation(source io.Reader, target io.Reader, output io.Writer, language string, fn xliff.WalkFunc) (bool, error) {
+	var data []byte
+
+	if target != nil {
+		var err error
+
+		data, err = ioutil.ReadAll(target)
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte(language + ":\n")
+	}
+
+	return writeTranslation(y, source, bytes.NewReader(data), output, language, "plaintext", fn)
+}
+
+func (YAML) decode(data []byte) (*resourceFile, error) {
+	f := &resourceFile{
+		data:      data,
+		end:       len(data),
+		groupEnds: make(map[string]int),
+		objects:   make(map[string]*object),
+		newline:   detectNewline(data),
+	}
+
+	var document yaml.Node
+
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, yamlSyntaxError(err)
+	}
+
+	f.indent = "  "
+
+	// Files that are no mapping of a language, as other files of settings,
+	// have no strings.
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode || len(document.Content[0].Content) == 0 {
+		return f, nil
+	}
+
+	p := &yamlParser{file: f}
+	p.index()
+
+	key, value := document.Content[0].Content[0], document.Content[0].Content[1]
+
+	switch {
+	case value.Kind == yaml.MappingNode:
+		if len(value.Content) > 0 && value.Style&yaml.FlowStyle == 0 {
+			f.indent = strings.Repeat(" ", value.Content[0].Column-key.Column)
+		}
+
+		p.mapping(value, nil, 1, false)
+	case value.Tag == "!!null" && value.Value == "":
+		// A language with no strings yet is an empty mapping.
+		f.objects[""] = &object{start: p.lineAfter(p.offset(key.Line, key.Column)), last: -1, depth: 1}
+	}
+
+	return f, nil
+}
+
+// yamlSyntaxError returns err, an error of the YAML decoder, as a syntax
+// error.
+func yamlSyntaxError(err error) error {
+	message := strings.TrimPrefix(err.Error(), "yaml: ")
+	line := 0
+
+	if strings.HasPrefix(message, "line ") {
+		if index := strings.Index(message, ": "); index >= 0 {
+			line, _ = strconv.Atoi(message[len("line "):index])
+			message = message[index+2:]
+		}
+	}
+
+	return &SyntaxError{Format: "yaml", Line: line, Msg: message}
+}
+
+func (YAML) encode(f *resourceFile, r resource, value string) string {
+	switch f.data[r.from] {
+	case '"':
+		return `"` + jsonEscape(value) + `"`
+	case '\'':
+		if !strings.ContainsAny(value, "\r\n") {
+			return "'" + strings.Replace(value, "'", "''", -1) + "'"
+		}
+	}
+
+	return yamlScalar(value)
+}
+
+func (y YAML) insert(f *resourceFile, resources []resource) []edit {
+	var edits []edit
+
+	order, anchors := f.members(resources, func(r resource) []string {
+		return append(append([]string{}, r.path[:len(r.path)-1]...), r.id)
+	})
+
+	for _, anchor := range order {
+		o := f.objects[anchor]
+		children := anchors[anchor].children
+
+		if o.flow {
+			text := y.renderFlow(children)
+
+			if o.last >= 0 {
+				text = ", " + text
+			}
+
+			edits = append(edits, edit{from: o.end, to: o.end, text: text})
+			continue
+		}
+
+		offset := o.start
+		if o.last >= 0 {
+			offset = o.last
+		}
+
+		text := y.render(f, children, o.depth)
+
+		if offset > 0 && f.data[offset-1] != '\n' {
+			text = f.newline + text
+		}
+
+		edits = append(edits, edit{from: offset, to: offset, text: text})
+	}
+
+	return edits
+}
+
+// render returns the lines of members at the given depth.
+func (y YAML) render(f *resourceFile, members []*member, depth int) string {
+	var text string
+
+	indent := strings.Repeat(f.indent, depth)
+
+	for _, m := range members {
+		if m.value != nil {
+			text += indent + yamlScalar(m.key) + ": " + yamlScalar(m.value.value) + f.newline
+		} else {
+			text += indent + yamlScalar(m.key) + ":" + f.newline + y.render(f, m.children, depth+1)
+		}
+	}
+
+	return text
+}
+
+// renderFlow returns members as those of a flow mapping.
+func (y YAML) renderFlow(members []*member) string {
+	var texts []string
+
+	for _, m := range members {
+		if m.value != nil {
+			texts = append(texts, yamlScalar(m.key)+": "+yamlScalar(m.value.value))
+		} else {
+			texts = append(texts, yamlScalar(m.key)+": {"+y.renderFlow(m.children)+"}")
+		}
+	}
+
+	return strings.Join(texts, ", ")
+}
+
+// yamlScalar returns text as a plain scalar if it reads back as the same
+// string in block and flow mappings alike, or else as a double quoted one.
+func yamlScalar(text string) string {
+	if text != "" && !strings.ContainsAny(text, "\r\n\t#,[]{}") {
+		if data, err := yaml.Marshal(text); err == nil && string(data) == text+"\n" {
+			return text
+		}
+	}
+
+	return `"` + jsonEscape(text) + `"`
+}
+
+// yamlParser reads the mappings of a YAML file from the nodes the decoder
+// gives, by the offsets of the lines of the file.
+type yamlParser struct {
+	file  *resourceFile
+	lines []int
+}
+
+// index reads the offsets of the lines of the file.
+func (p *yamlParser) index() {
+	p.lines = []int{0}
+
+	for i, c := range p.file.data {
+		if c == '\n' {
+			p.lines = append(p.lines, i+1)
+		}
+	}
+}
+
+// offset returns the offset of a position the decoder gives, whose column
+// counts characters.
+func (p *yamlParser) offset(line int, column int) int {
+	data := p.file.data
+	offset := p.lines[line-1]
+
+	for ; column > 1 && offset < len(data); column-- {
+		_, size := utf8.DecodeRune(data[offset:])
+		offset += size
+	}
+
+	return offset
+}
+
+// lineAfter returns the offset of the start of the line after the one of
+// offset, or the end of the file.
+func (p *yamlParser) lineAfter(offset int) int {
+	if index := bytes.IndexByte(p.file.data[offset:], '\n'); index >= 0 {
+		return offset + index + 1
+	}
+
+	return len(p.file.data)
+}
+
+// mapping reads the strings of a mapping node with the given keys, whose
+// members are at the given depth.
+func (p *yamlParser) mapping(node *yaml.Node, path []string, depth int, flow bool) {
+	flow = flow || node.Style&yaml.FlowStyle != 0
+	o := &object{start: p.offset(node.Line, node.Column), last: -1, depth: depth, flow: flow}
+	p.file.objects[strings.Join(path, "\x00")] = o
+	first := len(p.file.resources)
+
+	if flow {
+		o.end = p.end(node, 0, true) - 1
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		if key.Kind != yaml.ScalarNode || key.Tag == "!!merge" {
+			continue
+		}
+
+		keys := append(append([]string{}, path...), key.Value)
+		indent := key.Column - 1
+
+		switch {
+		case value.Kind == yaml.MappingNode:
+			p.mapping(value, keys, depth+1, flow)
+		case value.Kind == yaml.ScalarNode && value.Tag == "!!str":
+			from, to := p.scalar(value, indent, flow)
+			r := resource{id: strings.Join(keys, "."), path: keys, value: value.Value, translate: true, from: from, to: to}
+
+			if comment := yamlComment(key.HeadComment); comment != "" {
+				r.notes = []xliff.Note{{Data: comment, From: "developer"}}
+			}
+
+			p.file.resources = append(p.file.resources, r)
+		}
+
+		if flow {
+			o.last = o.end
+		} else {
+			o.last = p.lineAfter(p.end(value, indent, flow))
+		}
+	}
+
+	p.plurals(node, path, first)
+}
+
+// plurals groups the strings of the mapping node with the given keys, read
+// from the resource of index first, if its keys are plural categories.
+func (p *yamlParser) plurals(node *yaml.Node, path []string, first int) {
+	resources := p.file.resources[first:]
+
+	if len(path) == 0 || len(resources) == 0 || len(resources) != len(node.Content)/2 {
+		return
+	}
+
+	other := false
+
+	for _, r := range resources {
+		category := r.path[len(r.path)-1]
+
+		if len(r.path) != len(path)+1 || !isPluralCategory(category) {
+			return
+		}
+
+		other = other || category == "other"
+	}
+
+	if !other {
+		return
+	}
+
+	id := strings.Join(path, ".")
+	group := &xliff.Group{ID: id, Resname: id}
+	p.file.groupEnds[id] = 0
+
+	for i := range resources {
+		r := &resources[i]
+		r.groups = []*xliff.Group{group}
+		r.id = r.path[len(r.path)-1]
+		r.plural = true
+	}
+}
+
+// end returns the offset of the end of node, whose key is at the given
+// indentation.
+func (p *yamlParser) end(node *yaml.Node, indent int, flow bool) int {
+	data := p.file.data
+	start := p.offset(node.Line, node.Column)
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		_, to := p.scalar(node, indent, flow)
+		return to
+	case yaml.AliasNode:
+		return start + 1 + len(node.Value)
+	}
+
+	if node.Style&yaml.FlowStyle == 0 {
+		if len(node.Content) == 0 {
+			return start
+		}
+
+		last := node.Content[len(node.Content)-1]
+		return p.end(last, last.Column-1, flow)
+	}
+
+	depth := 0
+
+	for i := start; i < len(data); i++ {
+		switch data[i] {
+		case '"', '\'':
+			if strings.IndexByte("{[,: \t", data[i-1]) >= 0 {
+				i = p.quoted(i) - 1
+			}
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return len(data)
+}
+
+// scalar returns the offsets of the raw value of a scalar node, with its
+// quotes, whose key is at the given indentation. Its anchor and tag are
+// left out.
+func (p *yamlParser) scalar(node *yaml.Node, indent int, flow bool) (int, int) {
+	data := p.file.data
+	from := p.offset(node.Line, node.Column)
+
+	for from < len(data) && (data[from] == '&' || data[from] == '!') {
+		for from < len(data) && data[from] != ' ' && data[from] != '\t' && data[from] != '\n' {
+			from++
+		}
+
+		for from < len(data) && (data[from] == ' ' || data[from] == '\t') {
+			from++
+		}
+	}
+
+	switch {
+	case node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0:
+		return from, p.quoted(from)
+	case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		return from, p.block(p.lineEnd(from, false), indent, true)
+	}
+
+	to := p.lineEnd(from, flow)
+
+	if flow {
+		return from, to
+	}
+
+	return from, p.block(to, indent, false)
+}
+
+// quoted returns the offset after the end of the quoted scalar at offset.
+func (p *yamlParser) quoted(offset int) int {
+	data := p.file.data
+	quote := data[offset]
+
+	for i := offset + 1; i < len(data); i++ {
+		switch {
+		case quote == '"' && data[i] == '\\':
+			i++
+		case data[i] == quote && quote == '\'' && i+1 < len(data) && data[i+1] == '\'':
+			i++
+		case data[i] == quote:
+			return i + 1
+		}
+	}
+
+	return len(data)
+}
+
+// lineEnd returns the offset of the end of the text at offset on its line,
+// without a comment, and ending at a separator of members in a flow.
+func (p *yamlParser) lineEnd(offset int, flow bool) int {
+	data := p.file.data
+	end := offset
+
+	for i := offset; i < len(data) && data[i] != '\n' && data[i] != '\r'; i++ {
+		if data[i] == '#' && i > offset && (data[i-1] == ' ' || data[i-1] == '\t') {
+			break
+		}
+
+		if flow && strings.IndexByte(",]}", data[i]) >= 0 {
+			break
+		}
+
+		if data[i] != ' ' && data[i] != '\t' {
+			end = i + 1
+		}
+	}
+
+	return end
+}
+
+// block returns the offset of the end of the lines after offset that go on
+// a scalar whose key is at the given indentation: the lines indented more
+// than the key, and blank lines between them. Comments end plain scalars.
+func (p *yamlParser) block(offset int, indent int, literal bool) int {
+	data := p.file.data
+	end := offset
+
+	for line := p.lineAfter(offset); line < len(data); line = p.lineAfter(line) {
+		text := line
+
+		for text < len(data) && data[text] == ' ' {
+			text++
+		}
+
+		if text == len(data) || data[text] == '\n' || data[text] == '\r' {
+			continue
+		}
+
+		if text-line <= indent || !literal && data[text] == '#' {
+			break
+		}
+
+		if !literal {
+			end = p.lineEnd(text, false)
+			continue
+		}
+
+		for end = text; end < len(data) && data[end] != '\n' && data[end] != '\r'; end++ {
+		}
+	}
+
+	return end
+}
+
+// yamlComment returns the text of comment lines.
+func yamlComment(comment string) string {
+	var lines []string
+
+	for _, line := range strings.Split(comment, "\n") {
+		if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#")); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
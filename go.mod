@@ -12,4 +12,6 @@ require (
 	github.com/spf13/jwalterweatherman v1.0.0
 	github.com/spf13/viper v1.4.0
 	github.com/stretchr/testify v1.2.2
+	golang.org/x/text v0.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -4,3 +4,8 @@ type Job interface {
 	Push(config string, location string) error
 	Pull(config string, location string) error
 }
+
+// Canceler is implemented by jobs that are told when they are canceled.
+type Canceler interface {
+	Cancel(config string, location string) error
+}
@@ -0,0 +1,154 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package xliff
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+var encodingDeclaration = regexp.MustCompile(`^<\?xml[^>]*?\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// charset is the character encoding a document was read in, which it is
+// written back in. Documents are read and written as UTF-8 internally.
+type charset struct {
+	// Encoding of the document, nil for UTF-8, and its byte order mark.
+	encoding encoding.Encoding
+	bom      []byte
+}
+
+// detectCharset returns the charset of a document starting with prefix,
+// from its byte order mark or, without one, from the first bytes and the
+// encoding declaration.
+func detectCharset(prefix []byte) (charset, error) {
+	switch {
+	case bytes.HasPrefix(prefix, bomUTF8):
+		return charset{bom: bomUTF8}, nil
+	case bytes.HasPrefix(prefix, bomUTF16LE):
+		return charset{encoding: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), bom: bomUTF16LE}, nil
+	case bytes.HasPrefix(prefix, bomUTF16BE):
+		return charset{encoding: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), bom: bomUTF16BE}, nil
+	case bytes.HasPrefix(prefix, []byte{'<', 0}):
+		return charset{encoding: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)}, nil
+	case bytes.HasPrefix(prefix, []byte{0, '<'}):
+		return charset{encoding: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)}, nil
+	}
+
+	match := encodingDeclaration.FindSubmatch(prefix)
+	if match == nil {
+		return charset{}, nil
+	}
+
+	name := string(match[1])
+	if strings.EqualFold(name, "utf-8") || strings.EqualFold(name, "utf8") {
+		return charset{}, nil
+	}
+
+	e, err := ianaindex.IANA.Encoding(name)
+	if err != nil || e == nil {
+		return charset{}, errors.New("xliff: unsupported encoding " + name)
+	}
+
+	return charset{encoding: e}, nil
+}
+
+// decodeCharset returns the charset of data and data as UTF-8, without byte
+// order mark.
+func decodeCharset(data []byte) (charset, []byte, error) {
+	c, err := detectCharset(data)
+	if err != nil {
+		return c, nil, err
+	}
+
+	data = data[len(c.bom):]
+
+	if c.encoding != nil {
+		data, err = c.encoding.NewDecoder().Bytes(data)
+	}
+
+	return c, data, err
+}
+
+// decodeReader returns the charset of the document read from input and a
+// reader of the document as UTF-8, without byte order mark.
+func decodeReader(input io.Reader) (charset, io.Reader, error) {
+	buffered := bufio.NewReader(input)
+
+	prefix, err := buffered.Peek(1024)
+	if err != nil && err != io.EOF {
+		return charset{}, nil, err
+	}
+
+	c, err := detectCharset(prefix)
+	if err != nil {
+		return c, nil, err
+	}
+
+	buffered.Discard(len(c.bom))
+
+	if c.encoding != nil {
+		return c, c.encoding.NewDecoder().Reader(buffered), nil
+	}
+
+	return c, buffered, nil
+}
+
+// encode returns data, which is UTF-8, in the charset. Characters the
+// encoding has no place for are written as character references.
+func (c charset) encode(data []byte) ([]byte, error) {
+	if c.encoding != nil {
+		var err error
+
+		data, err = encoding.HTMLEscapeUnsupported(c.encoding.NewEncoder()).Bytes(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return append(append([]byte(nil), c.bom...), data...), nil
+}
+
+// writer returns a writer that encodes what it is given in the charset to
+// output. It has to be closed to flush what it holds.
+func (c charset) writer(output io.Writer) (io.WriteCloser, error) {
+	if _, err := output.Write(c.bom); err != nil {
+		return nil, err
+	}
+
+	if c.encoding == nil {
+		return nopCloser{output}, nil
+	}
+
+	return transform.NewWriter(output, encoding.HTMLEscapeUnsupported(c.encoding.NewEncoder())), nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// passCharset is the CharsetReader of decoders reading documents that were
+// decoded to UTF-8 already, whatever encoding they declare.
+func passCharset(label string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
@@ -0,0 +1,147 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package xliff
+
+import (
+	"encoding/xml"
+)
+
+// Extra keeps what the model does not know about an element, so that a
+// document is written back the way it was read. Attrs are the attributes
+// without a field in the model, with names keeping the prefix they were
+// written with in the name space field. Nodes are the child elements,
+// comments and processing instructions without a field, as raw XML.
+//
+// Extra also records the layout of the element: its start tag, the text
+// between its children and its content. The writer reuses them as long as
+// the model still matches what was read.
+type Extra struct {
+	Attrs []xml.Attr
+	Nodes []string
+
+	layout layout
+}
+
+type layout struct {
+	// Qualified name, start tag and attributes as read.
+	name  string
+	start string
+	attrs []xml.Attr
+	// Children in document order, with the text that came before each of
+	// them, and the text before the end tag.
+	children []slot
+	trailing string
+	// Whether the element was an empty-element tag.
+	empty bool
+	// Raw content of an element holding text, the markup of the model it
+	// was read into and the version of the document.
+	raw     string
+	markup  string
+	version string
+	// Line and column of the start tag, counted from 1.
+	line   int
+	column int
+}
+
+type slot struct {
+	space string
+	// Local name of a child read into the model, empty for nodes.
+	name string
+}
+
+// Returns a copy of the unit without the attributes, nodes and layout kept
+// from the document it was read from, for use in another document.
+func (transUnit TransUnit) WithoutExtra() TransUnit {
+	transUnit.Extra = Extra{}
+	transUnit.Source.Extra = Extra{}
+	transUnit.SegSource.Extra = Extra{}
+	transUnit.Target.Extra = Extra{}
+	transUnit.segments = nil
+	transUnit.notes = Extra{}
+
+	notes := transUnit.Notes
+	transUnit.Notes = nil
+
+	for _, note := range notes {
+		note.Extra = Extra{}
+		transUnit.Notes = append(transUnit.Notes, note)
+	}
+
+	return transUnit
+}
+
+func (header Header) isEmpty() bool {
+	return header.Tool.isEmpty() && len(header.Extra.Attrs) == 0 && len(header.Extra.Nodes) == 0
+}
+
+func (tool Tool) isEmpty() bool {
+	return tool.ToolID == "" && tool.ToolName == "" && tool.ToolVersion == "" && tool.BuildNum == "" &&
+		len(tool.Extra.Attrs) == 0 && len(tool.Extra.Nodes) == 0
+}
+
+// isKnown reports whether attr is one of the named attributes of the model.
+// Names match on their local part when unprefixed or in the xml name space.
+func isKnown(attr xml.Attr, known []string) bool {
+	if attr.Name.Space != "" && attr.Name.Space != "xml" {
+		return false
+	}
+
+	for _, name := range known {
+		if attr.Name.Local == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func equalAttrs(a []xml.Attr, b []xml.Attr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// orderAttrs returns attrs with those read before first, in the order they
+// were read.
+func orderAttrs(attrs []xml.Attr, read []xml.Attr) []xml.Attr {
+	var ordered []xml.Attr
+
+	used := make([]bool, len(attrs))
+
+	for _, r := range read {
+		for i, attr := range attrs {
+			if !used[i] && attr.Name == r.Name {
+				ordered = append(ordered, attr)
+				used[i] = true
+			}
+		}
+	}
+
+	for i, attr := range attrs {
+		if !used[i] {
+			ordered = append(ordered, attr)
+		}
+	}
+
+	return ordered
+}
+
+func hasAttr(attrs []xml.Attr, space string, local string) bool {
+	for _, attr := range attrs {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			return true
+		}
+	}
+
+	return false
+}
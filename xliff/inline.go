@@ -0,0 +1,505 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package xliff
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+// InlineKind classifies inline content independently of the XLIFF version
+// the element names come from.
+type InlineKind int
+
+const (
+	// Text, without markup.
+	InlineText InlineKind = iota
+	// Standalone code: <x>, <ph> in 1.2, <ph> in 2.x.
+	InlinePlaceholder
+	// Code pair enclosing content: <g> in 1.2, <pc> in 2.x.
+	InlinePaired
+	// Start of a code pair that may span content: <bx>, <bpt> in 1.2, <sc> in 2.x.
+	InlineOpening
+	// End of a code pair that may span content: <ex>, <ept> in 1.2, <ec> in 2.x.
+	InlineClosing
+	// Code whose counterpart is outside the unit: <it> in 1.2, isolated <sc> or <ec> in 2.x.
+	InlineIsolated
+	// Annotation enclosing content: <mrk>.
+	InlineMarker
+	// Start and end of an annotation that may span content: <sm> and <em> in 2.x.
+	InlineMarkerStart
+	InlineMarkerEnd
+	// Sub-flow within native code: <sub> in 1.2.
+	InlineSub
+	// Any other element, kept with its name and attributes.
+	InlineOther
+)
+
+// Inline is a run of text or an inline element of a source or target.
+type Inline struct {
+	Kind InlineKind
+	// Text of an InlineText run.
+	Text string
+	// Element name as read, e.g. "g" or "pc". Empty for text and for
+	// elements built by callers, which get the default name of their kind.
+	Name string
+	ID   string
+	// Attributes other than id, in document order. Names keep the prefix
+	// they were written with in the name space field.
+	Attrs []xml.Attr
+	// Children of the element. For codes in 1.2 documents this is the
+	// native code, which does not count as text.
+	Content Content
+
+	// version of the document the element was read from.
+	version string
+}
+
+// Content is the inline content of a source or target: text interleaved
+// with placeholders, paired codes and markers.
+type Content []Inline
+
+type inlineElement struct {
+	kind     InlineKind
+	version1 bool
+	version2 bool
+}
+
+var inlineElements = map[string]inlineElement{
+	"g":   {InlinePaired, true, false},
+	"x":   {InlinePlaceholder, true, false},
+	"bx":  {InlineOpening, true, false},
+	"ex":  {InlineClosing, true, false},
+	"ph":  {InlinePlaceholder, true, true},
+	"bpt": {InlineOpening, true, false},
+	"ept": {InlineClosing, true, false},
+	"it":  {InlineIsolated, true, false},
+	"mrk": {InlineMarker, true, true},
+	"sub": {InlineSub, true, false},
+	"pc":  {InlinePaired, false, true},
+	"sc":  {InlineOpening, false, true},
+	"ec":  {InlineClosing, false, true},
+	"sm":  {InlineMarkerStart, false, true},
+	"em":  {InlineMarkerEnd, false, true},
+}
+
+// Returns content holding text only.
+func TextContent(text string) Content {
+	if text == "" {
+		return nil
+	}
+
+	return Content{{Kind: InlineText, Text: text}}
+}
+
+// Parses inline markup, as returned by Content.Markup, back into content.
+func ParseMarkup(markup string) (Content, error) {
+	r := newReader([]byte("<content>" + markup + "</content>"))
+
+	root, err := r.root()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.content(root)
+}
+
+// Returns the text of the content as a translator sees it: text runs and
+// the text enclosed by paired codes and markers, without native code.
+func (c Content) Text() string {
+	var text strings.Builder
+
+	c.text(&text)
+
+	return text.String()
+}
+
+func (c Content) text(text *strings.Builder) {
+	for _, inline := range c {
+		switch inline.Kind {
+		case InlineText:
+			text.WriteString(inline.Text)
+		case InlinePaired, InlineMarker, InlineOther:
+			inline.Content.text(text)
+		}
+	}
+}
+
+// Returns the content as XML, with element names as they were read.
+func (c Content) Markup() string {
+	w := &writer{}
+	w.inline(c, nil)
+
+	return w.buffer.String()
+}
+
+// Returns the inline elements of the content, depth first.
+func (c Content) Elements() []Inline {
+	var elements []Inline
+
+	for _, inline := range c {
+		if inline.Kind == InlineText {
+			continue
+		}
+
+		elements = append(elements, inline)
+		elements = append(elements, inline.Content.Elements()...)
+	}
+
+	return elements
+}
+
+// appendContent appends content to c, merging adjacent text runs.
+func appendContent(c Content, content ...Inline) Content {
+	for _, inline := range content {
+		if inline.Kind == InlineText && len(c) > 0 && c[len(c)-1].Kind == InlineText {
+			c[len(c)-1].Text += inline.Text
+			continue
+		}
+
+		c = append(c, inline)
+	}
+
+	return c
+}
+
+// contentOf returns content when it still matches data, or data as text
+// when the caller has changed it.
+func contentOf(data string, content Content) Content {
+	if content.Text() == data {
+		return content
+	}
+
+	return TextContent(data)
+}
+
+// Returns the markup of the source, taking Data over Content when the two
+// no longer agree.
+func (source Source) Markup() string {
+	return contentOf(source.Data, source.Content).Markup()
+}
+
+// Returns the markup of the target, taking Data over Content when the two
+// no longer agree.
+func (target Target) Markup() string {
+	return contentOf(target.Data, target.Content).Markup()
+}
+
+// Replaces the content and data of the target with the given markup.
+func (target *Target) SetMarkup(markup string) error {
+	content, err := ParseMarkup(markup)
+	if err != nil {
+		return err
+	}
+
+	target.Content = content
+	target.Data = content.Text()
+
+	return nil
+}
+
+// content reads the inline content of element.
+func (r *reader) content(element xml.StartElement) (Content, error) {
+	var content Content
+
+	for {
+		token, err := r.token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			content = appendContent(content, Inline{Kind: InlineText, Text: string(t)})
+		case xml.StartElement:
+			inline, err := r.inline(t)
+			if err != nil {
+				return nil, err
+			}
+
+			content = appendContent(content, inline)
+		case xml.EndElement:
+			return content, r.end(element, t)
+		}
+	}
+}
+
+func (r *reader) inline(element xml.StartElement) (Inline, error) {
+	name := qualifiedName(element.Name)
+
+	if name == "cp" {
+		code, _ := strconv.ParseUint(attr(element, "hex"), 16, 32)
+
+		return Inline{Kind: InlineText, Text: string(rune(code))}, r.skip(element)
+	}
+
+	inline := Inline{Kind: InlineOther, Name: name, version: r.version}
+	if known, ok := inlineElements[name]; ok {
+		inline.Kind = known.kind
+	}
+
+	for _, a := range element.Attr {
+		if a.Name.Space == "" && a.Name.Local == "id" {
+			inline.ID = a.Value
+			continue
+		}
+
+		if a.Name.Space == "" && a.Name.Local == "isolated" && a.Value == "yes" {
+			inline.Kind = InlineIsolated
+		}
+
+		inline.Attrs = append(inline.Attrs, a)
+	}
+
+	content, err := r.content(element)
+	inline.Content = content
+
+	return inline, err
+}
+
+// inline writes content on the current line. Codes with the id of a code
+// in reference, the source of the unit, are written as that code, since
+// they stand for the same native data. Elements read from another version
+// are renamed to the vocabulary of the writer's version.
+func (w *writer) inline(content Content, reference map[string]Inline) {
+	for _, inline := range content {
+		if inline.Kind == InlineText {
+			w.text(inline.Text)
+			continue
+		}
+
+		if original, ok := reference[inline.ID]; ok && inline.ID != "" && original.Kind == inline.Kind {
+			if paired(inline.Kind) {
+				original.Content = inline.Content
+			}
+			inline = original
+		}
+
+		name := inlineName(inline, w.version)
+		if name == "" {
+			continue
+		}
+
+		attributes := append(attrs("id", inline.ID), inline.Attrs...)
+		children := inline.Content
+		if name != inline.Name || !inline.native(w.version) {
+			attributes = convertedAttrs(inline, name, w.version)
+		}
+		if isVersion2(w.version) && !paired(inline.Kind) {
+			children = nil
+		}
+
+		w.buffer.WriteByte('<')
+		w.buffer.WriteString(name)
+		w.attrs(attributes)
+
+		if len(children) == 0 {
+			w.buffer.WriteString("/>")
+			continue
+		}
+
+		w.buffer.WriteByte('>')
+		w.inline(children, reference)
+		w.endTag(name)
+	}
+}
+
+// text writes character data. XLIFF 2.x documents get characters that XML
+// cannot hold as <cp> elements.
+func (w *writer) text(text string) {
+	if !isVersion2(w.version) {
+		w.buffer.WriteString(textEscaper.Replace(text))
+		return
+	}
+
+	start := 0
+	for index, char := range text {
+		if isXMLChar(char) {
+			continue
+		}
+
+		w.buffer.WriteString(textEscaper.Replace(text[start:index]))
+		w.buffer.WriteString(`<cp hex="` + strings.ToUpper(strconv.FormatInt(int64(char), 16)) + `"/>`)
+		start = index + len(string(char))
+	}
+
+	w.buffer.WriteString(textEscaper.Replace(text[start:]))
+}
+
+// native reports whether inline was read from a document of the same major
+// version, or built without one.
+func (inline Inline) native(version string) bool {
+	return inline.version == "" || version == "" || isVersion2(inline.version) == isVersion2(version)
+}
+
+// references indexes the elements of content by id.
+func references(content Content) map[string]Inline {
+	elements := make(map[string]Inline)
+
+	for _, element := range content.Elements() {
+		if element.ID != "" {
+			elements[element.ID] = element
+		}
+	}
+
+	return elements
+}
+
+// inlineName returns the name inline is written with in version, or an
+// empty name when the version has no equivalent.
+func inlineName(inline Inline, version string) string {
+	if inline.Kind == InlineOther {
+		return inline.Name
+	}
+
+	if known, ok := inlineElements[inline.Name]; ok && known.kind == inline.Kind && known.in(version) && inline.native(version) {
+		return inline.Name
+	}
+
+	if isVersion2(version) {
+		switch inline.Kind {
+		case InlinePlaceholder:
+			return "ph"
+		case InlinePaired:
+			return "pc"
+		case InlineOpening:
+			return "sc"
+		case InlineClosing:
+			return "ec"
+		case InlineIsolated:
+			if isolatedPosition(inline) == "close" {
+				return "ec"
+			}
+			return "sc"
+		case InlineMarker:
+			return "mrk"
+		case InlineMarkerStart:
+			return "sm"
+		case InlineMarkerEnd:
+			return "em"
+		}
+
+		return ""
+	}
+
+	code := len(inline.Content) > 0 && inline.native(version)
+	switch inline.Kind {
+	case InlinePlaceholder:
+		if code {
+			return "ph"
+		}
+		return "x"
+	case InlinePaired:
+		return "g"
+	case InlineOpening:
+		if code {
+			return "bpt"
+		}
+		return "bx"
+	case InlineClosing:
+		if code {
+			return "ept"
+		}
+		return "ex"
+	case InlineIsolated:
+		return "it"
+	case InlineMarker:
+		return "mrk"
+	case InlineSub:
+		return "sub"
+	}
+
+	return ""
+}
+
+func (element inlineElement) in(version string) bool {
+	if version == "" {
+		return true
+	}
+
+	if isVersion2(version) {
+		return element.version2
+	}
+
+	return element.version1
+}
+
+// convertedAttrs returns the attributes of inline once renamed to name in
+// version. Only the attributes the two vocabularies share are carried over.
+func convertedAttrs(inline Inline, name string, version string) []xml.Attr {
+	id := inline.ID
+	if id == "" {
+		id = attrValue(inline.Attrs, "mid", "startRef", "rid")
+	}
+
+	switch name {
+	case "mrk":
+		term := attrValue(inline.Attrs, "mtype", "type") == "term"
+		if isSegment(inline) && !isVersion2(version) {
+			return attrs("mtype", "seg", "mid", id)
+		}
+		if isVersion2(version) {
+			if term {
+				return attrs("id", id, "type", "term")
+			}
+			return attrs("id", id)
+		}
+		if term {
+			return attrs("mid", id, "mtype", "term")
+		}
+		return attrs("mid", id, "mtype", "x-generic")
+	case "sc":
+		if inline.Kind == InlineIsolated {
+			return attrs("id", id, "isolated", "yes")
+		}
+	case "ec":
+		if inline.Kind == InlineIsolated {
+			return attrs("id", id, "isolated", "yes")
+		}
+		return attrs("startRef", id)
+	case "it":
+		return attrs("id", id, "pos", isolatedPosition(inline))
+	}
+
+	return attrs("id", id)
+}
+
+// attrValue returns the value of the first of the named attributes found.
+func attrValue(attributes []xml.Attr, names ...string) string {
+	for _, name := range names {
+		for _, a := range attributes {
+			if a.Name.Local == name {
+				return a.Value
+			}
+		}
+	}
+
+	return ""
+}
+
+func isolatedPosition(inline Inline) string {
+	if position := attrValue(inline.Attrs, "pos"); position != "" {
+		return position
+	}
+
+	if inline.Name == "ec" {
+		return "close"
+	}
+
+	return "open"
+}
+
+func paired(kind InlineKind) bool {
+	return kind == InlinePaired || kind == InlineMarker || kind == InlineOther
+}
+
+// isXMLChar reports whether char may appear in an XML 1.0 document.
+func isXMLChar(char rune) bool {
+	return char == 0x09 || char == 0x0A || char == 0x0D ||
+		char >= 0x20 && char <= 0xD7FF ||
+		char >= 0xE000 && char <= 0xFFFD ||
+		char >= 0x10000 && char <= 0x10FFFF
+}
@@ -0,0 +1,606 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package xliff
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+)
+
+// reader walks the raw tokens of a document. Elements are matched on their
+// local name so prefixed and unprefixed documents read the same. The input
+// offsets of the last token are kept so that the parts of the document the
+// model has no place for can be retained as written.
+type reader struct {
+	decoder *xml.Decoder
+	version string
+	charset charset
+
+	// data holds the input from offset base on. A streamed document is read
+	// through input, which adds to data what the decoder reads.
+	data  []byte
+	base  int64
+	input io.Reader
+
+	from int64
+	to   int64
+
+	// Line and column of offset lineOffset, from which the position of
+	// later offsets is counted.
+	lineOffset int64
+	line       int
+	column     int
+
+	// walk is called for every trans-unit of a streamed document, which is
+	// passed on to output, if any, up to offset copied. The document, file
+	// and groups being read are those of the trans-unit.
+	walk         WalkFunc
+	output       io.Writer
+	copied       int64
+	changed      bool
+	openDocument *Document
+	openFile     *File
+	openGroups   []*Group
+}
+
+// window adds the bytes read from input to the data of the reader.
+type window struct {
+	input io.Reader
+	r     *reader
+}
+
+func (w window) Read(p []byte) (int, error) {
+	n, err := w.input.Read(p)
+	w.r.data = append(w.r.data, p[:n]...)
+
+	return n, err
+}
+
+// newReader returns a reader of data, which is UTF-8 whatever encoding the
+// document declares.
+func newReader(data []byte) *reader {
+	r := &reader{decoder: xml.NewDecoder(bytes.NewReader(data)), data: data, line: 1, column: 1}
+	r.decoder.CharsetReader = passCharset
+
+	return r
+}
+
+// newStreamReader returns a reader of input that calls walk for every
+// trans-unit.
+func newStreamReader(input io.Reader, walk WalkFunc) (*reader, error) {
+	charset, input, err := decodeReader(input)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &reader{walk: walk, charset: charset, line: 1, column: 1}
+	r.input = window{input: input, r: r}
+	r.decoder = xml.NewDecoder(r.input)
+	r.decoder.CharsetReader = passCharset
+
+	return r, nil
+}
+
+// Parses an XLIFF 1.2, 2.0 or 2.1 document. The version is taken from the
+// root element. Documents in UTF-16, or in another encoding they declare,
+// are read as well and keep their encoding when written.
+func From(data []byte) (Document, error) {
+	charset, data, err := decodeCharset(data)
+	if err != nil {
+		return Document{}, err
+	}
+
+	r := newReader(data)
+	r.charset = charset
+
+	return r.read()
+}
+
+func (r *reader) read() (Document, error) {
+	root, err := r.root()
+	if err != nil {
+		return Document{}, err
+	}
+
+	r.version = attr(root, "version")
+
+	document := Document{Version: r.version, prolog: r.slice(0, r.from), charset: r.charset}
+	r.openDocument = &document
+
+	if isVersion2(r.version) {
+		err = r.document2(root, &document)
+	} else {
+		err = r.document(root, &document)
+	}
+
+	if err != nil {
+		return Document{}, err
+	}
+
+	if r.input != nil {
+		if _, err := ioutil.ReadAll(r.input); err != nil {
+			return Document{}, err
+		}
+	}
+
+	document.epilog = r.slice(r.to, r.base+int64(len(r.data)))
+	document.indent = detectIndent(document.Extra.layout)
+
+	return document, nil
+}
+
+// token returns the next token, copied so that it outlives further reads.
+func (r *reader) token() (xml.Token, error) {
+	r.from = r.decoder.InputOffset()
+
+	token, err := r.decoder.RawToken()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.to = r.decoder.InputOffset()
+
+	return xml.CopyToken(token), nil
+}
+
+// raw returns the last token as written.
+func (r *reader) raw() string {
+	return r.slice(r.from, r.to)
+}
+
+// slice returns the input between the two offsets.
+func (r *reader) slice(from int64, to int64) string {
+	return string(r.data[from-r.base : to-r.base])
+}
+
+// discard drops the input before offset, which is no longer needed.
+func (r *reader) discard(offset int64) {
+	if r.input == nil || offset <= r.base {
+		return
+	}
+
+	r.position(offset)
+
+	r.data = append(r.data[:0], r.data[offset-r.base:]...)
+	r.base = offset
+}
+
+// position returns the line and column of offset. Positions have to be
+// asked for in document order.
+func (r *reader) position(offset int64) (int, int) {
+	data := r.data[r.lineOffset-r.base : offset-r.base]
+
+	for len(data) > 0 {
+		if data[0] == '\n' {
+			r.line, r.column = r.line+1, 1
+			data = data[1:]
+			continue
+		}
+
+		_, size := utf8.DecodeRune(data)
+		r.column++
+		data = data[size:]
+	}
+
+	r.lineOffset = offset
+
+	return r.line, r.column
+}
+
+func (r *reader) root() (xml.StartElement, error) {
+	for {
+		token, err := r.token()
+		if err == io.ErrUnexpectedEOF {
+			return xml.StartElement{}, errors.New("xliff: document has no root element")
+		}
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+// element records start, which must be the last token read, in extra and
+// keeps the attributes other than the known ones.
+func (r *reader) element(start xml.StartElement, extra *Extra, known ...string) {
+	extra.layout.name = qualifiedName(start.Name)
+	extra.layout.start = r.raw()
+	extra.layout.attrs = start.Attr
+	extra.layout.line, extra.layout.column = r.position(r.from)
+
+	for _, a := range start.Attr {
+		if !isKnown(a, known) {
+			extra.Attrs = append(extra.Attrs, a)
+		}
+	}
+}
+
+// children calls fn for every child element of parent, which must be the
+// element that was just read, and records the layout of parent in extra.
+// fn has to consume the child, up to and including its end element, and
+// pass it to unknown when the model has no place for it. Comments and
+// processing instructions are kept as nodes.
+func (r *reader) children(parent xml.StartElement, extra *Extra, fn func(start xml.StartElement) error) error {
+	var space strings.Builder
+
+	contentStart := r.to
+
+	for {
+		token, err := r.token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			extra.layout.children = append(extra.layout.children, slot{space: space.String(), name: t.Name.Local})
+			space.Reset()
+
+			if err := fn(t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			extra.layout.trailing = space.String()
+			extra.layout.empty = r.from == contentStart && r.from == r.to
+
+			return r.end(parent, t)
+		case xml.CharData:
+			space.WriteString(r.raw())
+		default:
+			extra.layout.children = append(extra.layout.children, slot{space: space.String()})
+			extra.Nodes = append(extra.Nodes, r.raw())
+			space.Reset()
+		}
+	}
+}
+
+// unknown keeps element, whose start was the last token read by children,
+// as a node of its parent.
+func (r *reader) unknown(element xml.StartElement, extra *Extra) error {
+	start := r.from
+
+	if err := r.skip(element); err != nil {
+		return err
+	}
+
+	extra.layout.children[len(extra.layout.children)-1].name = ""
+	extra.Nodes = append(extra.Nodes, r.slice(start, r.to))
+
+	return nil
+}
+
+// text returns the character data of element, skipping any child element,
+// and records its content in extra.
+func (r *reader) text(element xml.StartElement, extra *Extra) (string, error) {
+	var text strings.Builder
+
+	contentStart := r.to
+
+	for {
+		token, err := r.token()
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			if err := r.skip(t); err != nil {
+				return "", err
+			}
+		case xml.EndElement:
+			r.contentLayout(extra, contentStart, text.String())
+
+			return text.String(), r.end(element, t)
+		}
+	}
+}
+
+// contentOf reads the inline content of element and records it in extra.
+func (r *reader) contentOf(element xml.StartElement, extra *Extra) (Content, error) {
+	contentStart := r.to
+
+	content, err := r.content(element)
+	if err != nil {
+		return nil, err
+	}
+
+	r.contentLayout(extra, contentStart, content.Markup())
+
+	return content, nil
+}
+
+// contentLayout records the content of the element whose end was the last
+// token read, along with the markup of the model it was read into.
+func (r *reader) contentLayout(extra *Extra, contentStart int64, markup string) {
+	extra.layout.raw = r.slice(contentStart, r.from)
+	extra.layout.markup = markup
+	extra.layout.version = r.version
+	extra.layout.empty = r.from == contentStart && r.from == r.to
+}
+
+// skip consumes element up to and including its end element.
+func (r *reader) skip(element xml.StartElement) error {
+	for {
+		token, err := r.token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := r.skip(t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return r.end(element, t)
+		}
+	}
+}
+
+func (r *reader) end(start xml.StartElement, end xml.EndElement) error {
+	if start.Name != end.Name {
+		line, _ := r.position(r.from)
+
+		return &xml.SyntaxError{Msg: "element <" + qualifiedName(start.Name) + "> closed by </" + qualifiedName(end.Name) + ">", Line: line}
+	}
+
+	return nil
+}
+
+func (r *reader) document(root xml.StartElement, document *Document) error {
+	r.element(root, &document.Extra, "version", "xmlns")
+
+	return r.children(root, &document.Extra, func(start xml.StartElement) error {
+		if start.Name.Local != "file" {
+			return r.unknown(start, &document.Extra)
+		}
+
+		file, err := r.file(start)
+		if err != nil {
+			return err
+		}
+
+		document.Files = append(document.Files, file)
+
+		return nil
+	})
+}
+
+func (r *reader) file(element xml.StartElement) (File, error) {
+	var hasHeader, hasBody bool
+
+	file := File{
+		Original:       attr(element, "original"),
+		SourceLanguage: attr(element, "source-language"),
+		Datatype:       attr(element, "datatype"),
+		TargetLanguage: attr(element, "target-language"),
+	}
+
+	r.element(element, &file.Extra, "original", "source-language", "datatype", "target-language")
+
+	r.openFile = &file
+
+	err := r.children(element, &file.Extra, func(start xml.StartElement) error {
+		var err error
+
+		switch {
+		case start.Name.Local == "header" && !hasHeader:
+			hasHeader = true
+			file.Header, err = r.header(start)
+		case start.Name.Local == "body" && !hasBody:
+			hasBody = true
+			file.Body, err = r.body(start, file)
+		default:
+			err = r.unknown(start, &file.Extra)
+		}
+
+		return err
+	})
+
+	return file, err
+}
+
+func (r *reader) header(element xml.StartElement) (Header, error) {
+	var hasTool bool
+
+	var header Header
+
+	r.element(element, &header.Extra)
+
+	err := r.children(element, &header.Extra, func(start xml.StartElement) error {
+		if start.Name.Local != "tool" || hasTool {
+			return r.unknown(start, &header.Extra)
+		}
+
+		hasTool = true
+		header.Tool = Tool{
+			ToolID:      attr(start, "tool-id"),
+			ToolName:    attr(start, "tool-name"),
+			ToolVersion: attr(start, "tool-version"),
+			BuildNum:    attr(start, "build-num"),
+		}
+
+		r.element(start, &header.Tool.Extra, "tool-id", "tool-name", "tool-version", "build-num")
+
+		return r.children(start, &header.Tool.Extra, func(start xml.StartElement) error {
+			return r.unknown(start, &header.Tool.Extra)
+		})
+	})
+
+	return header, err
+}
+
+func (r *reader) body(element xml.StartElement, file File) (Body, error) {
+	var body Body
+
+	r.element(element, &body.Extra)
+
+	err := r.children(element, &body.Extra, func(start xml.StartElement) error {
+		return r.member(start, file, &body.TransUnits, &body.Groups, &body.Extra)
+	})
+
+	return body, err
+}
+
+func (r *reader) group(element xml.StartElement, file File) (Group, error) {
+	group := Group{
+		ID:        attr(element, "id"),
+		Resname:   attr(element, "resname"),
+		Translate: attr(element, "translate"),
+	}
+
+	r.element(element, &group.Extra, "id", "resname", "translate")
+
+	r.openGroups = append(r.openGroups, &group)
+
+	err := r.children(element, &group.Extra, func(start xml.StartElement) error {
+		return r.member(start, file, &group.TransUnits, &group.Groups, &group.Extra)
+	})
+
+	r.openGroups = r.openGroups[:len(r.openGroups)-1]
+
+	return group, err
+}
+
+// member reads a child of a body or group into its trans-units or groups.
+func (r *reader) member(element xml.StartElement, file File, transUnits *[]TransUnit, groups *[]Group, extra *Extra) error {
+	start := r.from
+
+	switch element.Name.Local {
+	case "trans-unit":
+		transUnit, err := r.transUnit(element, file)
+		if err != nil {
+			return err
+		}
+
+		return r.add(transUnit, transUnits, start, extra)
+	case "group":
+		group, err := r.group(element, file)
+		if err != nil {
+			return err
+		}
+
+		r.addGroup(group, groups, extra)
+
+		return nil
+	}
+
+	return r.unknown(element, extra)
+}
+
+func (r *reader) transUnit(element xml.StartElement, file File) (TransUnit, error) {
+	var hasSource, hasSegSource, hasTarget bool
+
+	transUnit := TransUnit{
+		ID:        attr(element, "id"),
+		Resname:   attr(element, "resname"),
+		Translate: attr(element, "translate"),
+		Approved:  attr(element, "approved"),
+		Source:    Source{Language: file.SourceLanguage},
+		Target:    Target{Language: file.TargetLanguage},
+	}
+
+	r.element(element, &transUnit.Extra, "id", "resname", "translate", "approved")
+
+	err := r.children(element, &transUnit.Extra, func(start xml.StartElement) error {
+		var err error
+
+		switch {
+		case start.Name.Local == "source" && !hasSource:
+			hasSource = true
+			r.element(start, &transUnit.Source.Extra, "lang")
+			transUnit.Source.Language = attrOr(start, "lang", transUnit.Source.Language)
+			transUnit.Source.Content, err = r.contentOf(start, &transUnit.Source.Extra)
+			transUnit.Source.Data = transUnit.Source.Content.Text()
+		case start.Name.Local == "seg-source" && !hasSegSource:
+			hasSegSource = true
+			r.element(start, &transUnit.SegSource.Extra)
+			transUnit.SegSource.Content, err = r.contentOf(start, &transUnit.SegSource.Extra)
+		case start.Name.Local == "target" && !hasTarget:
+			hasTarget = true
+			r.element(start, &transUnit.Target.Extra, "state", "state-qualifier", "lang")
+			transUnit.Target.State = attr(start, "state")
+			transUnit.Target.StateQualifier = attr(start, "state-qualifier")
+			transUnit.Target.Language = attrOr(start, "lang", transUnit.Target.Language)
+			transUnit.Target.Content, err = r.contentOf(start, &transUnit.Target.Extra)
+			transUnit.Target.Data = transUnit.Target.Content.Text()
+		case start.Name.Local == "note":
+			var note Note
+			note, err = r.note(start, "from")
+			transUnit.Notes = append(transUnit.Notes, note)
+		default:
+			err = r.unknown(start, &transUnit.Extra)
+		}
+
+		return err
+	})
+
+	return transUnit, err
+}
+
+// note reads a note whose From is held by the named attribute.
+func (r *reader) note(element xml.StartElement, from string) (Note, error) {
+	note := Note{From: attr(element, from)}
+
+	if isVersion2(r.version) {
+		r.element(element, &note.Extra, from)
+	} else {
+		note.Language = attr(element, "lang")
+		r.element(element, &note.Extra, from, "lang")
+	}
+
+	data, err := r.text(element, &note.Extra)
+	note.Data = data
+
+	return note, err
+}
+
+// detectIndent returns the indentation of the first child of the root
+// element that starts on its own line.
+func detectIndent(root layout) string {
+	for _, child := range root.children {
+		if index := strings.LastIndex(child.space, "\n"); index >= 0 && index < len(child.space)-1 {
+			return child.space[index+1:]
+		}
+	}
+
+	return defaultIndent
+}
+
+// attr returns the value of the attribute with the given local name.
+func attr(element xml.StartElement, local string) string {
+	return attrOr(element, local, "")
+}
+
+func attrOr(element xml.StartElement, local string, value string) string {
+	for _, a := range element.Attr {
+		if isKnown(a, []string{local}) {
+			return a.Value
+		}
+	}
+
+	return value
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	return name.Space + ":" + name.Local
+}
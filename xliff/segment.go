@@ -0,0 +1,417 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package xliff
+
+import (
+	"encoding/xml"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// codePlaceholder stands for inline codes in the text matched by
+// segmentation rules, so that codes are never split.
+const codePlaceholder = "\uFFFC"
+
+// SegSource is the <seg-source> of a trans-unit: its source with each
+// sentence enclosed in a <mrk mtype="seg">.
+type SegSource struct {
+	Content Content
+	Extra   Extra
+}
+
+// Segment is a sentence of a segmented trans-unit along with its
+// translation. Target is empty while the segment is not translated.
+type Segment struct {
+	ID     string
+	Source Content
+	Target Content
+}
+
+// SegmentationRule is a break or no-break rule in the manner of SRX. It
+// applies at a position of the text when Before matches the text ending
+// there and After matches the text starting there.
+type SegmentationRule struct {
+	Break  bool
+	Before string
+	After  string
+}
+
+// DefaultSegmentationRules break after terminal punctuation followed by
+// white space, except after common abbreviations and initials.
+var DefaultSegmentationRules = []SegmentationRule{
+	{Break: false, Before: `\b(?:Mr|Mrs|Ms|Dr|Prof|Sr|Jr|St|vs|etc|e\.g|i\.e|No)\.`, After: `\s`},
+	{Break: false, Before: `\b\p{Lu}\.`, After: `\s`},
+	{Break: true, Before: `[.?!\x{2026}]+["'\x{201D}\x{2019})\]]*`, After: `\s+\S`},
+	{Break: true, Before: `[\x{3002}\x{FF01}\x{FF1F}]`, After: ``},
+}
+
+// Segmenter splits content into sentences.
+type Segmenter struct {
+	rules []segmentationRule
+}
+
+type segmentationRule struct {
+	breaks bool
+	before *regexp.Regexp
+	after  *regexp.Regexp
+}
+
+// Returns a segmenter applying rules in order; the first rule that applies
+// at a position decides whether the text breaks there.
+func NewSegmenter(rules []SegmentationRule) (*Segmenter, error) {
+	segmenter := &Segmenter{}
+
+	for _, rule := range rules {
+		before, err := regexp.Compile(rule.Before)
+		if err != nil {
+			return nil, err
+		}
+
+		after, err := regexp.Compile("^(?:" + rule.After + ")")
+		if err != nil {
+			return nil, err
+		}
+
+		segmenter.rules = append(segmenter.rules, segmentationRule{breaks: rule.Break, before: before, after: after})
+	}
+
+	return segmenter, nil
+}
+
+// Returns content with each sentence enclosed in a <mrk mtype="seg">,
+// numbered from 1, and the white space between sentences left outside.
+// Only text outside of inline elements is split. Content holding a single
+// sentence is returned as nil.
+func (segmenter *Segmenter) Segment(content Content) Content {
+	var text strings.Builder
+
+	for _, inline := range content {
+		if inline.Kind == InlineText {
+			text.WriteString(inline.Text)
+		} else {
+			text.WriteString(codePlaceholder)
+		}
+	}
+
+	breaks := segmenter.breaks(text.String())
+	if len(breaks) == 0 {
+		return nil
+	}
+
+	var result Content
+	var count int
+
+	for _, sentence := range split(content, breaks) {
+		leading, sentence, trailing := trimSpace(sentence)
+
+		result = appendContent(result, TextContent(leading)...)
+
+		if len(sentence) > 0 {
+			count++
+			result = append(result, segmentMarker(strconv.Itoa(count), sentence))
+		}
+
+		result = appendContent(result, TextContent(trailing)...)
+	}
+
+	if count < 2 {
+		return nil
+	}
+
+	return result
+}
+
+// breaks returns the offsets in text where a break rule applies first.
+// The matches of the before pattern of each rule are found once over the
+// whole text, and its after pattern tried where they end only, so that
+// long paragraphs segment in linear time.
+func (segmenter *Segmenter) breaks(text string) []int {
+	decided := make(map[int]bool)
+
+	for _, rule := range segmenter.rules {
+		for _, match := range rule.before.FindAllStringIndex(text, -1) {
+			offset := match[1]
+
+			if offset == 0 || offset == len(text) {
+				continue
+			}
+
+			if _, ok := decided[offset]; !ok && rule.after.MatchString(text[offset:]) {
+				decided[offset] = rule.breaks
+			}
+		}
+	}
+
+	var breaks []int
+
+	for offset, isBreak := range decided {
+		if isBreak {
+			breaks = append(breaks, offset)
+		}
+	}
+
+	sort.Ints(breaks)
+
+	return breaks
+}
+
+// split cuts content at the given offsets of its text, where codes count
+// as one placeholder.
+func split(content Content, breaks []int) []Content {
+	var parts []Content
+	var current Content
+
+	next, offset := 0, 0
+
+	for _, inline := range content {
+		for next < len(breaks) && breaks[next] <= offset {
+			parts = append(parts, current)
+			current = nil
+			next++
+		}
+
+		if inline.Kind != InlineText {
+			current = append(current, inline)
+			offset += len(codePlaceholder)
+			continue
+		}
+
+		rest, restOffset := inline.Text, offset
+
+		for next < len(breaks) && breaks[next] < offset+len(inline.Text) {
+			cut := breaks[next] - restOffset
+
+			parts = append(parts, appendContent(current, TextContent(rest[:cut])...))
+			current = nil
+			rest, restOffset = rest[cut:], breaks[next]
+			next++
+		}
+
+		current = appendContent(current, TextContent(rest)...)
+		offset += len(inline.Text)
+	}
+
+	return append(parts, current)
+}
+
+// trimSpace returns the white space content starts and ends with and the
+// content between.
+func trimSpace(content Content) (string, Content, string) {
+	var leading, trailing string
+
+	content = append(Content(nil), content...)
+
+	for len(content) > 0 && content[0].Kind == InlineText {
+		text := strings.TrimLeftFunc(content[0].Text, unicode.IsSpace)
+		leading += content[0].Text[:len(content[0].Text)-len(text)]
+
+		if text != "" {
+			content[0].Text = text
+			break
+		}
+
+		content = content[1:]
+	}
+
+	for len(content) > 0 && content[len(content)-1].Kind == InlineText {
+		last := &content[len(content)-1]
+
+		text := strings.TrimRightFunc(last.Text, unicode.IsSpace)
+		trailing = last.Text[len(text):] + trailing
+
+		if text != "" {
+			last.Text = text
+			break
+		}
+
+		content = content[:len(content)-1]
+	}
+
+	return leading, content, trailing
+}
+
+// Returns the segments of the unit, from its seg-source, with their
+// translation from the segments of the target with the same id.
+func (transUnit TransUnit) Segments() []Segment {
+	var segments []Segment
+
+	targets := make(map[string]Content)
+
+	for _, inline := range transUnit.Target.Content {
+		if isSegment(inline) {
+			targets[segmentID(inline)] = inline.Content
+		}
+	}
+
+	for _, inline := range transUnit.SegSource.Content {
+		if isSegment(inline) {
+			segments = append(segments, Segment{
+				ID:     segmentID(inline),
+				Source: inline.Content,
+				Target: targets[segmentID(inline)],
+			})
+		}
+	}
+
+	return segments
+}
+
+// Returns segSource with each segment replaced by the target of the segment
+// with the same id, which gives the translation of the whole unit.
+func JoinSegments(segSource Content, segments []Segment) Content {
+	var content Content
+
+	targets := make(map[string]Content)
+
+	for _, segment := range segments {
+		targets[segment.ID] = segment.Target
+	}
+
+	for _, inline := range segSource {
+		if isSegment(inline) {
+			content = appendContent(content, targets[segmentID(inline)]...)
+		} else {
+			content = appendContent(content, inline)
+		}
+	}
+
+	return content
+}
+
+// Returns segSource with the content of each segment replaced by the target
+// of the segment with the same id, keeping the segment markers, which gives
+// the target of a segmented unit.
+func SegmentTarget(segSource Content, segments []Segment) Content {
+	var content Content
+
+	targets := make(map[string]Content)
+
+	for _, segment := range segments {
+		targets[segment.ID] = segment.Target
+	}
+
+	for _, inline := range segSource {
+		if isSegment(inline) {
+			content = append(content, segmentMarker(segmentID(inline), targets[segmentID(inline)]))
+		} else {
+			content = appendContent(content, inline)
+		}
+	}
+
+	return content
+}
+
+// Returns the content with the segment markers removed and their content
+// kept.
+func (c Content) WithoutSegments() Content {
+	var content Content
+
+	for _, inline := range c {
+		if isSegment(inline) {
+			content = appendContent(content, inline.Content...)
+		} else {
+			content = appendContent(content, inline)
+		}
+	}
+
+	return content
+}
+
+// Returns true if the content holds segment markers.
+func (c Content) IsSegmented() bool {
+	for _, inline := range c {
+		if isSegment(inline) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// segmentMarker returns the <mrk mtype="seg"> of the segment with the given
+// id and content.
+func segmentMarker(id string, content Content) Inline {
+	return Inline{
+		Kind:    InlineMarker,
+		Name:    "mrk",
+		Attrs:   attrs("mtype", "seg", "mid", id),
+		Content: content,
+	}
+}
+
+func isSegment(inline Inline) bool {
+	return inline.Kind == InlineMarker && attrValue(inline.Attrs, "mtype") == "seg"
+}
+
+func segmentID(inline Inline) string {
+	if inline.ID != "" {
+		return inline.ID
+	}
+
+	return attrValue(inline.Attrs, "mid")
+}
+
+type srx struct {
+	LanguageRules []struct {
+		Name  string `xml:"languagerulename,attr"`
+		Rules []struct {
+			Break  string `xml:"break,attr"`
+			Before string `xml:"beforebreak"`
+			After  string `xml:"afterbreak"`
+		} `xml:"rule"`
+	} `xml:"body>languagerules>languagerule"`
+	LanguageMaps []struct {
+		Pattern string `xml:"languagepattern,attr"`
+		Name    string `xml:"languagerulename,attr"`
+	} `xml:"body>maprules>languagemap"`
+}
+
+// Parses the rules an SRX document applies to language: those of every
+// language map whose pattern matches it, in the order of the maps. The
+// expressions have to be valid Go regular expressions.
+func ParseSRX(data []byte, language string) ([]SegmentationRule, error) {
+	var document srx
+
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	var rules []SegmentationRule
+
+	for _, languageMap := range document.LanguageMaps {
+		pattern, err := regexp.Compile("^(?:" + languageMap.Pattern + ")$")
+		if err != nil {
+			return nil, err
+		}
+
+		if !pattern.MatchString(language) {
+			continue
+		}
+
+		for _, languageRule := range document.LanguageRules {
+			if languageRule.Name != languageMap.Name {
+				continue
+			}
+
+			for _, rule := range languageRule.Rules {
+				rules = append(rules, SegmentationRule{
+					Break:  rule.Break != "no",
+					Before: rule.Before,
+					After:  rule.After,
+				})
+			}
+		}
+	}
+
+	if len(rules) == 0 {
+		return nil, errors.New("srx: no rules for language " + language)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,109 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package xliff
+
+import (
+	"errors"
+	"strings"
+)
+
+// States is the XLIFF 1.2 target state vocabulary. Custom states start with
+// "x-". XLIFF 2.x states are read and written as their 1.2 equivalent.
+var States = []string{
+	"new",
+	"needs-translation",
+	"needs-l10n",
+	"needs-adaptation",
+	"translated",
+	"needs-review-translation",
+	"needs-review-l10n",
+	"needs-review-adaptation",
+	"signed-off",
+	"final",
+}
+
+// StatePolicy decides what happens to units by the state of their target.
+// States in the lists may end with "*" to match every state with that
+// prefix, as in "x-*", and "" stands for a target without state.
+type StatePolicy struct {
+	// States of complete targets. Units in any other state are pushed.
+	Complete []string
+	// States in which targets of a job are done and written back on pull.
+	// When empty, targets are written back in any state.
+	Done []string
+	// State given to the targets written back on pull. When empty, they
+	// keep the state of the job target.
+	Pull string
+}
+
+// Returns the policy under which translated and signed-off targets are
+// complete, and targets are written back in the state they were pulled in.
+func DefaultPolicy() StatePolicy {
+	return StatePolicy{Complete: []string{"translated", "signed-off"}}
+}
+
+// Returns the state of a target that has none yet, as job files give it.
+func (policy StatePolicy) InitialState() string {
+	return "new"
+}
+
+// Returns true if a target in state is complete.
+func (policy StatePolicy) IsComplete(state string) bool {
+	return matchState(policy.Complete, state)
+}
+
+// Returns true if a job target in state is done.
+func (policy StatePolicy) IsDone(state string) bool {
+	return len(policy.Done) == 0 || matchState(policy.Done, state)
+}
+
+// Returns the state of a target written back on pull from a job target in
+// state.
+func (policy StatePolicy) PulledState(state string) string {
+	if policy.Pull != "" {
+		return policy.Pull
+	}
+
+	return state
+}
+
+// Returns an error naming the first state of the policy that is neither in
+// States nor a custom one.
+func (policy StatePolicy) Validate() error {
+	states := append(append([]string{policy.Pull}, policy.Complete...), policy.Done...)
+
+	for _, state := range states {
+		if !strings.HasSuffix(state, "*") && !IsValidState(state) {
+			return errors.New("xliff: unknown state " + state)
+		}
+	}
+
+	return nil
+}
+
+// Returns true if state is empty, in States or a custom state.
+func IsValidState(state string) bool {
+	if state == "" || strings.HasPrefix(state, "x-") {
+		return true
+	}
+
+	for _, known := range States {
+		if state == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchState(states []string, state string) bool {
+	for _, pattern := range states {
+		if pattern == state || strings.HasSuffix(pattern, "*") && strings.HasPrefix(state, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,214 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package xliff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Reads a document from input and calls fn for every trans-unit as soon as
+// it is read, so that documents of any size are read in bounded memory.
+// The file and groups passed to fn hold their attributes and header but
+// none of their members, and the trans-unit is dropped once fn returns.
+func Stream(input io.Reader, fn WalkFunc) error {
+	r, err := newStreamReader(input, fn)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.read()
+
+	return err
+}
+
+// Copies a document from input to output, calling fn for every trans-unit
+// as Stream does. The trans-units fn changes are written the way Marshal
+// would write them, everything else is copied as read. Returns true if fn
+// changed any trans-unit. The output keeps the encoding of the input.
+func Rewrite(input io.Reader, output io.Writer, fn WalkFunc) (bool, error) {
+	r, err := newStreamReader(input, fn)
+	if err != nil {
+		return false, err
+	}
+
+	writer, err := r.charset.writer(output)
+	if err != nil {
+		return false, err
+	}
+
+	r.output = writer
+
+	if _, err := r.read(); err != nil {
+		return false, err
+	}
+
+	if err := r.copy(r.base + int64(len(r.data))); err != nil {
+		return false, err
+	}
+
+	return r.changed, writer.Close()
+}
+
+// add adds transUnit, which was read from offset start, to transUnits, or
+// passes it to the walk function of a streamed document instead.
+func (r *reader) add(transUnit TransUnit, transUnits *[]TransUnit, start int64, parent *Extra) error {
+	if r.walk == nil {
+		*transUnits = append(*transUnits, transUnit)
+		return nil
+	}
+
+	parent.layout.children = parent.layout.children[:len(parent.layout.children)-1]
+
+	depth := len(r.openGroups) + 3
+	if isVersion2(r.version) {
+		depth = len(r.openGroups) + 2
+	}
+
+	prefix := prefixOf(parent.layout.name)
+
+	var before []byte
+	if r.output != nil {
+		before = r.marshal(transUnit, depth, prefix)
+	}
+
+	if err := r.walk(r.openFile, r.openGroups, &transUnit); err != nil {
+		return err
+	}
+
+	if r.output == nil {
+		r.discard(r.to)
+		return nil
+	}
+
+	if err := r.copy(start); err != nil {
+		return err
+	}
+
+	after := r.marshal(transUnit, depth, prefix)
+
+	if bytes.Equal(before, after) {
+		if err := r.copy(r.to); err != nil {
+			return err
+		}
+	} else {
+		if _, err := r.output.Write(after); err != nil {
+			return err
+		}
+
+		r.changed = true
+		r.copied = r.to
+	}
+
+	r.discard(r.copied)
+
+	return nil
+}
+
+// addGroup adds group to groups unless the document is streamed.
+func (r *reader) addGroup(group Group, groups *[]Group, parent *Extra) {
+	if r.walk == nil {
+		*groups = append(*groups, group)
+		return
+	}
+
+	parent.layout.children = parent.layout.children[:len(parent.layout.children)-1]
+}
+
+// copy passes the input on to output up to offset.
+func (r *reader) copy(offset int64) error {
+	_, err := io.WriteString(r.output, r.slice(r.copied, offset))
+	r.copied = offset
+
+	return err
+}
+
+// marshal returns transUnit as written at the given depth of the document.
+func (r *reader) marshal(transUnit TransUnit, depth int, prefix string) []byte {
+	w := &writer{indent: detectIndent(r.openDocument.Extra.layout), depth: depth, prefix: prefix, version: r.version}
+
+	if isVersion2(r.version) {
+		w.unit2(transUnit).write()
+	} else {
+		w.transUnit(transUnit, *r.openFile).write()
+	}
+
+	return w.buffer.Bytes()
+}
+
+// Encoder writes a document holding a single file one trans-unit at a time.
+type Encoder struct {
+	output   io.Writer
+	document Document
+	head     []byte
+	tail     []byte
+	depth    int
+	count    int
+}
+
+// Returns an encoder writing a document of the given version to output,
+// with file, whose members are left out, as its only file.
+func NewEncoder(output io.Writer, version string, file File) (*Encoder, error) {
+	if !IsSupportedVersion(version) {
+		return nil, fmt.Errorf("xliff: version %s is not supported", version)
+	}
+
+	file.Body = Body{}
+
+	document := Document{Version: version, Files: []File{file}}
+
+	w := newWriter(document)
+	w.stream = true
+	w.marshal(document)
+
+	data := w.buffer.Bytes()
+
+	return &Encoder{
+		output:   output,
+		document: document,
+		head:     data[:w.split],
+		tail:     data[w.split:],
+		depth:    w.splitDepth,
+	}, nil
+}
+
+// Writes transUnit to the body of the file.
+func (e *Encoder) Encode(transUnit TransUnit) error {
+	w := newWriter(e.document)
+	w.depth = e.depth
+
+	if e.count == 0 {
+		w.buffer.Write(e.head)
+	} else {
+		w.buffer.WriteString(w.newline())
+	}
+
+	if isVersion2(e.document.Version) {
+		w.unit2(transUnit).write()
+	} else {
+		w.transUnit(transUnit, e.document.Files[0]).write()
+	}
+
+	e.count++
+
+	_, err := e.output.Write(w.buffer.Bytes())
+
+	return err
+}
+
+// Writes the end of the document. An encoder without trans-units writes the
+// whole document.
+func (e *Encoder) Close() error {
+	data := e.tail
+
+	if e.count == 0 {
+		data, _ = Marshal(e.document)
+	}
+
+	_, err := e.output.Write(data)
+
+	return err
+}
@@ -0,0 +1,277 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package xliff
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type ValidationErrorCode int
+
+const (
+	UnsupportedVersion ValidationErrorCode = iota
+	MissingOriginalAttribute
+	MissingSourceLanguage
+	MissingTargetLanguage
+	UnsupportedDatatype
+	InconsistentSourceLanguage
+	InconsistentTargetLanguage
+	MissingTransUnitID
+	MissingTransUnitSource
+	MissingTransUnitTarget
+	MissingFile
+	DuplicateTransUnitID
+	UnknownTargetState
+	MalformedDocument
+)
+
+// Severity tells whether a validation error keeps a document from being
+// processed.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "info"
+}
+
+// ValidationError is a diagnostic about a document. Line and Column give the
+// start tag of the element it is about, or are 0 when it has no position.
+// Path is left to callers that know where the document was read from.
+type ValidationError struct {
+	Code        ValidationErrorCode
+	Severity    Severity
+	Message     string
+	Path        string
+	Line        int
+	Column      int
+	TransUnitID string
+}
+
+func (ve ValidationError) Error() string {
+	code := "Unknown"
+	switch ve.Code {
+	case UnsupportedVersion:
+		code = "UnsupportedVersion"
+	case MissingOriginalAttribute:
+		code = "MissingOriginalAttribute"
+	case MissingSourceLanguage:
+		code = "MissingSourceLanguage"
+	case MissingTargetLanguage:
+		code = "MissingTargetLanguage"
+	case UnsupportedDatatype:
+		code = "UnsupportedDatatype"
+	case InconsistentSourceLanguage:
+		code = "InconsistentSourceLanguage"
+	case InconsistentTargetLanguage:
+		code = "InconsistentTargetLanguage"
+	case MissingTransUnitID:
+		code = "MissingTransUnitID"
+	case MissingTransUnitSource:
+		code = "MissingTransUnitSource"
+	case MissingTransUnitTarget:
+		code = "MissingTransUnitTarget"
+	case MissingFile:
+		code = "MissingFile"
+	case DuplicateTransUnitID:
+		code = "DuplicateTransUnitID"
+	case UnknownTargetState:
+		code = "UnknownTargetState"
+	case MalformedDocument:
+		code = "MalformedDocument"
+	}
+
+	position := ve.Path
+	if ve.Line > 0 {
+		position += fmt.Sprintf(":%d:%d", ve.Line, ve.Column)
+	}
+
+	message := fmt.Sprintf("%s: %s: %s", ve.Severity, code, ve.Message)
+	if position != "" {
+		message = position + ": " + message
+	}
+
+	return message
+}
+
+// Returns the diagnostics of some basic consistency checks, in document
+// order.
+func (d Document) Validate() []ValidationError {
+	v := validator{ids: make(map[string]bool)}
+
+	d.Walk(v.transUnit)
+	v.document(d)
+
+	return v.sorted()
+}
+
+// Reads a document from input, as Stream does, and returns the diagnostics
+// of Document.Validate. A document that cannot be read gets a
+// MalformedDocument error.
+func ValidateStream(input io.Reader) []ValidationError {
+	v := validator{ids: make(map[string]bool)}
+
+	r, err := newStreamReader(input, v.transUnit)
+
+	var document Document
+	if err == nil {
+		document, err = r.read()
+	}
+
+	if err != nil {
+		line := 0
+		if syntaxError, ok := err.(*xml.SyntaxError); ok {
+			line = syntaxError.Line
+		}
+
+		return []ValidationError{{
+			Code:     MalformedDocument,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("Document cannot be read: %s", err),
+			Line:     line,
+		}}
+	}
+
+	v.document(document)
+
+	return v.sorted()
+}
+
+// validator collects the diagnostics of a document.
+type validator struct {
+	errors []ValidationError
+	ids    map[string]bool
+	// Index of the unit within its file.
+	file  *File
+	index int
+}
+
+func (v *validator) add(code ValidationErrorCode, severity Severity, extra Extra, transUnitID string, format string, args ...interface{}) {
+	v.errors = append(v.errors, ValidationError{
+		Code:        code,
+		Severity:    severity,
+		Message:     fmt.Sprintf(format, args...),
+		Line:        extra.layout.line,
+		Column:      extra.layout.column,
+		TransUnitID: transUnitID,
+	})
+}
+
+func (v *validator) sorted() []ValidationError {
+	sort.SliceStable(v.errors, func(i, j int) bool {
+		if v.errors[i].Line != v.errors[j].Line {
+			return v.errors[i].Line < v.errors[j].Line
+		}
+		return v.errors[i].Column < v.errors[j].Column
+	})
+
+	return v.errors
+}
+
+func (v *validator) document(d Document) {
+	// Make sure the document is a version we understand
+	if !IsSupportedVersion(d.Version) {
+		v.add(UnsupportedVersion, SeverityError, d.Extra, "", "Version %s is not supported", d.Version)
+	}
+
+	if len(d.Files) == 0 {
+		v.add(MissingFile, SeverityError, d.Extra, "", "Document has no file")
+		return
+	}
+
+	// XLIFF 2.x files have no required original, and the target language
+	// is optional in both versions
+	sourceAttribute, targetAttribute := "source-language", "target-language"
+	if isVersion2(d.Version) {
+		sourceAttribute, targetAttribute = "srcLang", "trgLang"
+	}
+
+	// Make sure all files have the attributes we need
+	for idx, file := range d.Files {
+		if file.Original == "" && !isVersion2(d.Version) {
+			v.add(MissingOriginalAttribute, SeverityError, file.Extra, "", "File #%d is missing 'original' attribute", idx)
+		}
+		if file.SourceLanguage == "" {
+			v.add(MissingSourceLanguage, SeverityError, file.Extra, "", "File '%s' is missing '%s' attribute", file.Original, sourceAttribute)
+		}
+		if file.TargetLanguage == "" {
+			v.add(MissingTargetLanguage, SeverityWarning, file.Extra, "", "File '%s' is missing '%s' attribute", file.Original, targetAttribute)
+		}
+		if d.Version == Version12 && file.Datatype != "plaintext" {
+			v.add(UnsupportedDatatype, SeverityWarning, file.Extra, "",
+				"File '%s' has unsupported 'datatype' attribute with value '%s'", file.Original, file.Datatype)
+		}
+	}
+
+	// Make sure all files are consistent with source and target language
+	sourceLanguage, targetLanguage := d.Files[0].SourceLanguage, d.Files[0].TargetLanguage
+	for _, file := range d.Files {
+		if file.SourceLanguage != sourceLanguage {
+			v.add(InconsistentSourceLanguage, SeverityWarning, file.Extra, "",
+				"File '%s' has inconsistent 'source-language' attribute '%s'", file.Original, file.SourceLanguage)
+		}
+		if file.TargetLanguage != targetLanguage {
+			v.add(InconsistentTargetLanguage, SeverityWarning, file.Extra, "",
+				"File '%s' has inconsistent 'target-language' attribute '%s'", file.Original, file.TargetLanguage)
+		}
+	}
+}
+
+// transUnit makes sure the unit has the attributes and children we expect.
+func (v *validator) transUnit(file *File, groups []*Group, transUnit *TransUnit) error {
+	extra := transUnit.Extra
+
+	if file != v.file {
+		v.file, v.index = file, 0
+	}
+
+	if transUnit.ID == "" {
+		v.add(MissingTransUnitID, SeverityError, extra, "",
+			"Translation unit #%d in file '%s' is missing 'id' attribute", v.index, file.Original)
+	} else {
+		key := file.Original + "\x00" + GroupPath(groups) + "\x00" + transUnit.ID
+		if v.ids[key] {
+			v.add(DuplicateTransUnitID, SeverityError, extra, transUnit.ID,
+				"Translation unit '%s' in file '%s' has the same 'id' as another one", transUnit.ID, file.Original)
+		}
+		v.ids[key] = true
+	}
+	if transUnit.Source.Data == "" {
+		v.add(MissingTransUnitSource, SeverityWarning, extra, transUnit.ID,
+			"Translation unit '%s' in file '%s' is missing 'source' element", transUnit.ID, file.Original)
+	}
+	if transUnit.Target.Data == "" {
+		v.add(MissingTransUnitTarget, SeverityInfo, extra, transUnit.ID,
+			"Translation unit '%s' in file '%s' is missing 'target' element", transUnit.ID, file.Original)
+	}
+	if transUnit.Target.Language != file.TargetLanguage {
+		v.add(InconsistentTargetLanguage, SeverityWarning, extra, transUnit.ID,
+			"Translation unit '%s' in file '%s' has a different target language attribute", transUnit.ID, file.Original)
+	}
+	if !IsValidState(transUnit.Target.State) {
+		if transUnit.Target.Extra.layout.line > 0 {
+			extra = transUnit.Target.Extra
+		}
+
+		v.add(UnknownTargetState, SeverityWarning, extra, transUnit.ID,
+			"Translation unit '%s' in file '%s' has unknown target state '%s'", transUnit.ID, file.Original, transUnit.Target.State)
+	}
+	v.index++
+
+	return nil
+}
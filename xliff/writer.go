@@ -0,0 +1,452 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package xliff
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const defaultIndent = "  "
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", "\"", "&quot;",
+	"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+// writer renders elements the way they were read, as recorded in their
+// Extra. Elements that were not read are written one per line, indented by
+// depth, with the name space prefix of their parent.
+type writer struct {
+	buffer  bytes.Buffer
+	indent  string
+	depth   int
+	prefix  string
+	version string
+
+	// When stream is set, the members of bodies are left out and the offset
+	// and depth at which they go are kept in split and splitDepth.
+	stream     bool
+	split      int
+	splitDepth int
+}
+
+// child is a child element of the model, written by write.
+type child struct {
+	name  string
+	write func()
+}
+
+// Returns the XML encoding of document in the version given by its Version
+// field, in the character encoding it was read in.
+func Marshal(document Document) ([]byte, error) {
+	if !IsSupportedVersion(document.Version) {
+		return nil, fmt.Errorf("xliff: version %s is not supported", document.Version)
+	}
+
+	w := newWriter(document)
+	w.marshal(document)
+
+	return document.charset.encode(w.buffer.Bytes())
+}
+
+func newWriter(document Document) *writer {
+	w := &writer{indent: document.indent, version: document.Version}
+	if w.indent == "" {
+		w.indent = defaultIndent
+	}
+
+	return w
+}
+
+func (w *writer) marshal(document Document) {
+	read := document.Extra.layout.start != ""
+
+	if read {
+		w.buffer.WriteString(document.prolog)
+	} else {
+		w.buffer.WriteString(xml.Header)
+	}
+
+	if isVersion2(document.Version) {
+		w.document2(document)
+	} else {
+		w.document(document)
+	}
+
+	if read {
+		w.buffer.WriteString(document.epilog)
+	} else {
+		w.buffer.WriteByte('\n')
+	}
+}
+
+func (w *writer) document(document Document) {
+	var files []child
+
+	for _, file := range document.Files {
+		files = append(files, w.file(file))
+	}
+
+	w.element("xliff", attrs("version", document.Version, "xmlns", namespace(document, Namespace12)), document.Extra, files)
+}
+
+func (w *writer) file(file File) child {
+	var children []child
+
+	if !file.Header.isEmpty() {
+		children = append(children, child{"header", func() {
+			w.element("header", nil, file.Header.Extra, []child{w.tool(file.Header.Tool)})
+		}})
+	}
+
+	children = append(children, child{"body", func() {
+		w.element("body", nil, file.Body.Extra, w.members(file, file.Body.TransUnits, file.Body.Groups))
+	}})
+
+	return child{"file", func() {
+		w.element("file", attrs(
+			"original", file.Original,
+			"source-language", file.SourceLanguage,
+			"datatype", file.Datatype,
+			"target-language", file.TargetLanguage), file.Extra, children)
+	}}
+}
+
+// members returns the trans-units and groups of a body or group.
+func (w *writer) members(file File, transUnits []TransUnit, groups []Group) []child {
+	var children []child
+
+	if w.stream {
+		return []child{w.splitChild("trans-unit")}
+	}
+
+	for _, transUnit := range transUnits {
+		children = append(children, w.transUnit(transUnit, file))
+	}
+
+	for _, group := range groups {
+		children = append(children, w.group(group, file))
+	}
+
+	return children
+}
+
+// splitChild returns a child that writes nothing but where it goes.
+func (w *writer) splitChild(name string) child {
+	return child{name, func() {
+		w.split, w.splitDepth = w.buffer.Len(), w.depth
+	}}
+}
+
+func (w *writer) group(group Group, file File) child {
+	return child{"group", func() {
+		w.element("group", attrs("id", group.ID, "resname", group.Resname, "translate", group.Translate), group.Extra,
+			w.members(file, group.TransUnits, group.Groups))
+	}}
+}
+
+func (w *writer) tool(tool Tool) child {
+	extra := tool.Extra
+	if extra.layout.start == "" {
+		extra.layout.empty = true
+	}
+
+	return child{"tool", func() {
+		w.element("tool", attrs(
+			"tool-id", tool.ToolID,
+			"tool-name", tool.ToolName,
+			"tool-version", tool.ToolVersion,
+			"build-num", tool.BuildNum), extra, nil)
+	}}
+}
+
+func (w *writer) transUnit(transUnit TransUnit, file File) child {
+	var children []child
+
+	source := contentOf(transUnit.Source.Data, transUnit.Source.Content)
+	children = append(children, child{"source", func() {
+		w.content("source", source, attrs(
+			"xml:lang", language(transUnit.Source.Language, file.SourceLanguage, transUnit.Source.Extra)),
+			transUnit.Source.Extra, nil)
+	}})
+
+	if len(transUnit.SegSource.Content) > 0 {
+		children = append(children, child{"seg-source", func() {
+			w.content("seg-source", transUnit.SegSource.Content, nil, transUnit.SegSource.Extra, nil)
+		}})
+	}
+
+	target := transUnit.Target
+	if target.Data != "" || len(target.Content) > 0 || target.State != "" || target.StateQualifier != "" {
+		children = append(children, child{"target", func() {
+			w.content("target", contentOf(target.Data, target.Content), attrs(
+				"state", target.State,
+				"state-qualifier", target.StateQualifier,
+				"xml:lang", language(target.Language, file.TargetLanguage, target.Extra)),
+				target.Extra, references(source))
+		}})
+	}
+
+	for _, note := range transUnit.Notes {
+		children = append(children, w.note(note, attrs("from", note.From, "xml:lang", note.Language)))
+	}
+
+	return child{"trans-unit", func() {
+		w.element("trans-unit", attrs(
+			"id", transUnit.ID,
+			"resname", transUnit.Resname,
+			"translate", transUnit.Translate,
+			"approved", transUnit.Approved), transUnit.Extra, children)
+	}}
+}
+
+func (w *writer) note(note Note, attributes []xml.Attr) child {
+	return child{"note", func() {
+		w.leaf("note", attributes, note.Extra, note.Data, func() {
+			w.buffer.WriteString(textEscaper.Replace(note.Data))
+		})
+	}}
+}
+
+// content writes an element holding inline content.
+func (w *writer) content(name string, content Content, attributes []xml.Attr, extra Extra, reference map[string]Inline) {
+	w.leaf(name, attributes, extra, content.Markup(), func() {
+		w.inline(content, reference)
+	})
+}
+
+// element writes an element with children. The children are written in
+// place of the ones that were read with the same name, and the nodes kept
+// in extra in their own place, so the text around them is kept as read.
+// Children without a place are written next to the closest one before or
+// after them that has one.
+func (w *writer) element(name string, attributes []xml.Attr, extra Extra, children []child) {
+	layout := layoutOf(name, extra)
+	nodes := extra.Nodes
+
+	name = w.name(name, layout)
+	empty := layout.empty && len(children) == 0 && len(nodes) == 0
+
+	w.startTag(name, append(attributes, extra.Attrs...), layout, empty)
+	if empty {
+		return
+	}
+
+	prefix := w.prefix
+	w.prefix = prefixOf(name)
+	w.depth++
+
+	places := make(map[string]int)
+	for _, slot := range layout.children {
+		places[slot.name]++
+	}
+
+	written := make([]bool, len(children))
+	space := ""
+
+	for _, slot := range layout.children {
+		if slot.name == "" {
+			if len(nodes) > 0 {
+				w.buffer.WriteString(slot.space)
+				w.buffer.WriteString(nodes[0])
+				nodes = nodes[1:]
+			}
+			continue
+		}
+
+		places[slot.name]--
+		space = slot.space
+
+		match := -1
+		for i, child := range children {
+			if !written[i] && child.name == slot.name {
+				match = i
+				break
+			}
+		}
+		if match < 0 {
+			continue
+		}
+
+		for i := range children {
+			if i > match && places[children[i].name] > 0 {
+				break
+			}
+
+			if !written[i] && (i == match || places[children[i].name] == 0) {
+				written[i] = true
+				w.buffer.WriteString(slot.space)
+				children[i].write()
+			}
+		}
+	}
+
+	if space == "" {
+		space = w.newline()
+	}
+
+	for i, child := range children {
+		if !written[i] {
+			w.buffer.WriteString(space)
+			child.write()
+		}
+	}
+
+	for _, node := range nodes {
+		w.buffer.WriteString(space)
+		w.buffer.WriteString(node)
+	}
+
+	w.depth--
+	w.prefix = prefix
+
+	if layout.start == "" || (len(layout.children) == 0 && layout.trailing == "" && len(children) > 0) {
+		w.buffer.WriteString(w.newline())
+	} else {
+		w.buffer.WriteString(layout.trailing)
+	}
+
+	w.endTag(name)
+}
+
+// leaf writes an element holding text, using write for its content unless
+// markup is the one that was read.
+func (w *writer) leaf(name string, attributes []xml.Attr, extra Extra, markup string, write func()) {
+	layout := layoutOf(name, extra)
+	unchanged := layout.start != "" && markup == layout.markup && layout.version == w.version
+
+	name = w.name(name, layout)
+
+	w.startTag(name, append(attributes, extra.Attrs...), layout, unchanged && layout.empty)
+
+	switch {
+	case unchanged && layout.empty:
+		return
+	case unchanged:
+		w.buffer.WriteString(layout.raw)
+	default:
+		write()
+	}
+
+	w.endTag(name)
+}
+
+// layoutOf returns the layout recorded in extra if it was read from an
+// element of the given name, as it may come from another version.
+func layoutOf(name string, extra Extra) layout {
+	if extra.layout.name != "" && extra.layout.name != name && !strings.HasSuffix(extra.layout.name, ":"+name) {
+		return layout{}
+	}
+
+	return extra.layout
+}
+
+// name returns the name of the element as it was read, or name with the
+// prefix of the parent for a new element.
+func (w *writer) name(name string, layout layout) string {
+	if layout.name != "" {
+		return layout.name
+	}
+
+	return w.prefix + name
+}
+
+func (w *writer) newline() string {
+	return "\n" + strings.Repeat(w.indent, w.depth)
+}
+
+// startTag writes the start tag of an element, the way it was read if the
+// attributes are the same.
+func (w *writer) startTag(name string, attributes []xml.Attr, layout layout, empty bool) {
+	attributes = orderAttrs(attributes, layout.attrs)
+
+	if layout.start != "" && equalAttrs(attributes, layout.attrs) {
+		start := layout.start
+		if layout.empty && !empty {
+			start = strings.TrimSuffix(start, "/>") + ">"
+		}
+
+		w.buffer.WriteString(start)
+		return
+	}
+
+	w.buffer.WriteByte('<')
+	w.buffer.WriteString(name)
+	w.attrs(attributes)
+
+	if empty {
+		w.buffer.WriteString("/>")
+	} else {
+		w.buffer.WriteByte('>')
+	}
+}
+
+func (w *writer) attrs(attrs []xml.Attr) {
+	for _, attr := range attrs {
+		w.buffer.WriteByte(' ')
+		w.buffer.WriteString(qualifiedName(attr.Name))
+		w.buffer.WriteString(`="`)
+		w.buffer.WriteString(attrEscaper.Replace(attr.Value))
+		w.buffer.WriteByte('"')
+	}
+}
+
+func (w *writer) endTag(name string) {
+	w.buffer.WriteString("</")
+	w.buffer.WriteString(name)
+	w.buffer.WriteByte('>')
+}
+
+// attrs builds attributes from name and value pairs, leaving out the empty
+// ones. A prefix in the name, as in "xml:lang", goes to the name space.
+func attrs(pairs ...string) []xml.Attr {
+	var attrs []xml.Attr
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			continue
+		}
+
+		name := xml.Name{Local: pairs[i]}
+		if index := strings.Index(name.Local, ":"); index >= 0 {
+			name = xml.Name{Space: name.Local[:index], Local: name.Local[index+1:]}
+		}
+
+		attrs = append(attrs, xml.Attr{Name: name, Value: pairs[i+1]})
+	}
+
+	return attrs
+}
+
+// language returns the language of a source or target to write, leaving
+// out the one inherited from the file unless the element was read with it.
+func language(language string, inherited string, extra Extra) string {
+	if language == inherited && !hasAttr(extra.layout.attrs, "xml", "lang") {
+		return ""
+	}
+
+	return language
+}
+
+// namespace returns the name space of the root element, unless it was read
+// without one.
+func namespace(document Document, namespace string) string {
+	if document.Extra.layout.start != "" && !hasAttr(document.Extra.layout.attrs, "", "xmlns") {
+		return ""
+	}
+
+	return namespace
+}
+
+func prefixOf(name string) string {
+	if index := strings.Index(name, ":"); index >= 0 {
+		return name[:index+1]
+	}
+
+	return ""
+}
@@ -5,253 +5,241 @@
 package xliff
 
 import (
-	"encoding/xml"
-	"fmt"
+	"strings"
+)
+
+// Supported XLIFF versions.
+const (
+	Version12 = "1.2"
+	Version20 = "2.0"
+	Version21 = "2.1"
+)
+
+// Default namespaces of the supported versions. XLIFF 2.1 keeps the 2.0 core
+// namespace.
+const (
+	Namespace12 = "urn:oasis:names:tc:xliff:document:1.2"
+	Namespace20 = "urn:oasis:names:tc:xliff:document:2.0"
 )
 
 type Tool struct {
-	ToolID      string `xml:"tool-id,attr"`
-	ToolName    string `xml:"tool-name,attr"`
-	ToolVersion string `xml:"tool-version,attr"`
-	BuildNum    string `xml:"build-num,attr"`
+	ToolID      string
+	ToolName    string
+	ToolVersion string
+	BuildNum    string
+	Extra       Extra
 }
 
 type Header struct {
-	Tool Tool `xml:"tool"`
+	Tool  Tool
+	Extra Extra
 }
 
+// TransUnit is a <trans-unit>. Translate and Approved hold the attributes
+// of the same name, "yes", "no" or empty when not given.
 type TransUnit struct {
-	ID      string `xml:"id,attr"`
-	Resname string `xml:"resname,attr"`
-	Source  Source `xml:"source"`
-	Target  Target `xml:"target"`
-	Notes   []Note `xml:"note"`
+	ID        string
+	Resname   string
+	Translate string
+	Approved  string
+	Source    Source
+	SegSource SegSource
+	Target    Target
+	Notes     []Note
+	Extra     Extra
+
+	// Segments and ignorables of a unit read from an XLIFF 2.x document,
+	// and the <notes> element holding its notes.
+	segments []segment2
+	notes    Extra
 }
 
+// Note is a <note> element. In XLIFF 2.x documents From holds the note
+// category.
 type Note struct {
-	Data     string `xml:",chardata"`
-	Language string `xml:"lang,attr"`
-	From     string `xml:"from,attr"`
+	Data     string
+	Language string
+	From     string
+	Extra    Extra
 }
 
+// Source is the text to translate. Data is the plain text of Content. When
+// a caller changes Data without updating Content, Data is written as plain
+// text in place of Content.
 type Source struct {
-	Data     string `xml:",chardata"`
-	Language string `xml:"lang,attr"`
+	Data     string
+	Content  Content
+	Language string
+	Extra    Extra
 }
 
+// Target is the translation of a unit, with Data and Content related as in
+// Source. State and StateQualifier use the XLIFF 1.2 vocabulary whatever the
+// version of the document; XLIFF 2.x segment states are mapped onto it when
+// reading and back when writing.
 type Target struct {
-	State          string `xml:"state,attr"`
-	StateQualifier string `xml:"state-qualifier,attr"`
-	Data           string `xml:",chardata"`
-	Language       string `xml:"lang,attr"`
+	State          string
+	StateQualifier string
+	Data           string
+	Content        Content
+	Language       string
+	Extra          Extra
 }
 
 type Body struct {
-	TransUnits []TransUnit `xml:"trans-unit"`
+	TransUnits []TransUnit
+	Groups     []Group
+	Extra      Extra
 }
 
-type File struct {
-	Original       string `xml:"original,attr"`
-	SourceLanguage string `xml:"source-language,attr"`
-	Datatype       string `xml:"datatype,attr"`
-	TargetLanguage string `xml:"target-language,attr"`
-	Header         Header `xml:"header"`
-	Body           Body   `xml:"body"`
+// Group is a <group> of trans-units and nested groups. Translate applies to
+// the units of the group that do not set it.
+type Group struct {
+	ID         string
+	Resname    string
+	Translate  string
+	TransUnits []TransUnit
+	Groups     []Group
+	Extra      Extra
 }
 
-type Document struct {
-	Version string `xml:"version,attr"`
-	Files   []File `xml:"file"`
-}
+// WalkFunc is called by Walk for a trans-unit of file, nested in groups,
+// outermost first. Changes made through the pointers are kept in the
+// document.
+type WalkFunc func(file *File, groups []*Group, transUnit *TransUnit) error
 
-type ValidationErrorCode int
+// File is a <file> element. ID is only used by XLIFF 2.x documents, Datatype
+// and Header only by XLIFF 1.2 ones.
+type File struct {
+	ID             string
+	Original       string
+	SourceLanguage string
+	Datatype       string
+	TargetLanguage string
+	Header         Header
+	Body           Body
+	Extra          Extra
+}
 
-const (
-	UnsupportedVersion ValidationErrorCode = iota
-	MissingOriginalAttribute
-	MissingSourceLanguage
-	MissingTargetLanguage
-	UnsupportedDatatype
-	InconsistentSourceLanguage
-	InconsistentTargetLanguage
-	MissingTransUnitID
-	MissingTransUnitSource
-	MissingTransUnitTarget
-)
+// Document is an XLIFF document. The model follows the XLIFF 1.2 structure;
+// Version selects how it is read and written, so 2.x units appear as
+// trans-units with the same helpers available for both.
+type Document struct {
+	Version string
+	Files   []File
+	Extra   Extra
 
-type ValidationError struct {
-	Code    ValidationErrorCode
-	Message string
+	// Text before and after the root element, the indentation used for
+	// elements added to the document and the encoding it was read in.
+	prolog  string
+	epilog  string
+	indent  string
+	charset charset
 }
 
-func (ve ValidationError) Error() string {
-	code := "Unknown"
-	switch ve.Code {
-	case UnsupportedVersion:
-		code = "UnsupportedVersion"
-	case MissingOriginalAttribute:
-		code = "MissingOriginalAttribute"
-	case MissingSourceLanguage:
-		code = "MissingSourceLanguage"
-	case MissingTargetLanguage:
-		code = "MissingTargetLanguage"
-	case UnsupportedDatatype:
-		code = "UnsupportedDatatype"
-	case InconsistentSourceLanguage:
-		code = "InconsistentSourceLanguage"
-	case InconsistentTargetLanguage:
-		code = "InconsistentTargetLanguage"
-	case MissingTransUnitID:
-		code = "MissingTransUnitID"
-	case MissingTransUnitSource:
-		code = "MissingTransUnitSource"
-	case MissingTransUnitTarget:
-		code = "MissingTransUnitTarget"
-	}
-	return fmt.Sprintf("%s: %s", code, ve.Message)
+// Returns true if all translation units in all files are complete, by
+// policy.
+func (d Document) IsComplete(policy StatePolicy) bool {
+	return len(d.IncompleteTransUnits(policy)) == 0
 }
 
-func From(data []byte) (Document, error) {
-	var document Document
-	if err := xml.Unmarshal(data, &document); err != nil {
-		return Document{}, err
-	}
+// Returns all translation units in all files that need translation, by
+// policy.
+func (d Document) IncompleteTransUnits(policy StatePolicy) []TransUnit {
+	var transUnits []TransUnit
 
-	return document, nil
-}
+	d.Walk(func(file *File, groups []*Group, transUnit *TransUnit) error {
+		if transUnit.NeedsTranslation(policy, groups...) {
+			transUnits = append(transUnits, *transUnit)
+		}
 
-// Returns true if the document passes some basic consistency checks.
-func (d Document) Validate() []ValidationError {
-	var errors []ValidationError
+		return nil
+	})
 
-	// Make sure the document is a version we understand
-	if d.Version != "1.2" {
-		errors = append(errors, ValidationError{
-			Code:    UnsupportedVersion,
-			Message: fmt.Sprintf("Version %s is not supported", d.Version),
-		})
-	}
+	return transUnits
+}
 
-	// Make sure all files have the attributes we need
-	for idx, file := range d.Files {
-		if file.Original == "" {
-			errors = append(errors, ValidationError{
-				Code:    MissingOriginalAttribute,
-				Message: fmt.Sprintf("File #%d is missing 'original' attribute", idx),
-			})
-		}
-		if file.SourceLanguage == "" {
-			errors = append(errors, ValidationError{
-				Code:    MissingSourceLanguage,
-				Message: fmt.Sprintf("File '%s' is missing 'source-language' attribute", file.Original),
-			})
-		}
-		if file.TargetLanguage == "" {
-			errors = append(errors, ValidationError{
-				Code:    MissingTargetLanguage,
-				Message: fmt.Sprintf("File '%s' is missing 'target-language' attribute", file.Original),
-			})
-		}
-		if file.Datatype != "plaintext" {
-			errors = append(errors, ValidationError{
-				Code: UnsupportedDatatype,
-				Message: fmt.Sprintf("File '%s' has unsupported 'datatype' attribute with value '%s'",
-					file.Original, file.Datatype),
-			})
+// Walk calls fn for every trans-unit in all files, those of a body or
+// group before those of its groups. It stops at the first error returned
+// by fn.
+func (d *Document) Walk(fn WalkFunc) error {
+	for i := range d.Files {
+		file := &d.Files[i]
+
+		err := walk(file, nil, file.Body.TransUnits, file.Body.Groups, fn)
+		if err != nil {
+			return err
 		}
 	}
 
-	// Make sure all files are consistent with source and target language
-	sourceLanguage, targetLanguage := d.Files[0].SourceLanguage, d.Files[0].TargetLanguage
-	for _, file := range d.Files {
-		if file.SourceLanguage != sourceLanguage {
-			errors = append(errors, ValidationError{
-				Code: InconsistentSourceLanguage,
-				Message: fmt.Sprintf("File '%s' has inconsistent 'source-language' attribute '%s'",
-					file.Original, file.SourceLanguage),
-			})
-		}
-		if file.TargetLanguage != targetLanguage {
-			errors = append(errors, ValidationError{
-				Code: InconsistentTargetLanguage,
-				Message: fmt.Sprintf("File '%s' has inconsistent 'target-language' attribute '%s'",
-					file.Original, file.TargetLanguage),
-			})
+	return nil
+}
+
+func walk(file *File, groups []*Group, transUnits []TransUnit, nested []Group, fn WalkFunc) error {
+	for i := range transUnits {
+		if err := fn(file, groups, &transUnits[i]); err != nil {
+			return err
 		}
 	}
 
-	// Make sure all trans units have the attributes and children we expect
-	for _, file := range d.Files {
-		for idx, transUnit := range file.Body.TransUnits {
-			if transUnit.ID == "" {
-				errors = append(errors, ValidationError{
-					Code: MissingTransUnitID,
-					Message: fmt.Sprintf("Translation unit #%d in file '%s' is missing 'id' attribute",
-						idx, file.Original),
-				})
-			}
-			if transUnit.Source.Data == "" {
-				errors = append(errors, ValidationError{
-					Code: MissingTransUnitSource,
-					Message: fmt.Sprintf("Translation unit '%s' in file '%s' is missing 'source' attribute",
-						transUnit.ID, file.Original),
-				})
-			}
-			if transUnit.Target.Data == "" {
-				errors = append(errors, ValidationError{
-					Code: MissingTransUnitTarget,
-					Message: fmt.Sprintf("Translation unit '%s' in file '%s' is missing 'target' attribute",
-						transUnit.ID, file.Original),
-				})
-			}
-			if transUnit.Target.Language != file.TargetLanguage {
-				errors = append(errors, ValidationError{
-					Code: InconsistentTargetLanguage,
-					Message: fmt.Sprintf("Translation unit '%s' in file '%s' is has a different target language attribute",
-						transUnit.ID, file.Original),
-				})
-			}
+	for i := range nested {
+		group := &nested[i]
+
+		err := walk(file, append(groups[:len(groups):len(groups)], group), group.TransUnits, group.Groups, fn)
+		if err != nil {
+			return err
 		}
 	}
 
-	return errors
+	return nil
 }
 
-// Returns true if all translation units in all files have an
-// empty source or target.
-func (d Document) IsComplete() bool {
-	for _, file := range d.Files {
-		for _, transUnit := range file.Body.TransUnits {
-			if !transUnit.IsComplete() {
-				return false
-			}
-		}
+// Returns the path of a trans-unit nested in groups, made of the group ids
+// separated by slashes. Units outside of any group have an empty path.
+func GroupPath(groups []*Group) string {
+	var ids []string
+
+	for _, group := range groups {
+		ids = append(ids, group.ID)
 	}
-	return true
+
+	return strings.Join(ids, "/")
 }
 
-// Returns all translation units in all files have an
-// empty source or target.
-func (d Document) IncompleteTransUnits() []TransUnit {
-	var transUnits []TransUnit
+// Returns true if the unit has a source and a target that is approved or in
+// a complete state of policy, or if the unit is not to be translated.
+func (transUnit TransUnit) IsComplete(policy StatePolicy) bool {
+	if transUnit.Translate == "no" {
+		return true
+	}
 
-	for _, file := range d.Files {
-		for _, transUnit := range file.Body.TransUnits {
-			if !transUnit.IsComplete() {
-				transUnits = append(transUnits, transUnit)
-			}
-		}
+	if transUnit.Source.Data == "" || transUnit.Target.Data == "" {
+		return false
 	}
 
-	return transUnits
+	if transUnit.Approved == "yes" {
+		return true
+	}
+
+	return policy.IsComplete(transUnit.Target.State)
 }
 
-func (transUnit TransUnit) IsComplete() bool {
-	if transUnit.Source.Data == "" || transUnit.Target.Data == "" || (transUnit.Target.State != "translated" && transUnit.Target.State != "signed-off") {
-		return false
+// Returns false if the unit, or else the innermost of the groups it is
+// nested in that says so, is marked translate="no".
+func (transUnit TransUnit) IsTranslatable(groups ...*Group) bool {
+	translate := transUnit.Translate
+
+	for i := len(groups) - 1; i >= 0 && translate == ""; i-- {
+		translate = groups[i].Translate
 	}
 
-	return true
+	return translate != "no"
+}
+
+// Returns true if the unit, nested in groups, is to be translated and is
+// not complete by policy.
+func (transUnit TransUnit) NeedsTranslation(policy StatePolicy, groups ...*Group) bool {
+	return transUnit.IsTranslatable(groups...) && !transUnit.IsComplete(policy)
 }
 
 func (d Document) File(original string) (File, bool) {
@@ -262,3 +250,13 @@ func (d Document) File(original string) (File, bool) {
 	}
 	return File{}, false
 }
+
+// Returns true if version is one of the XLIFF versions this package reads
+// and writes.
+func IsSupportedVersion(version string) bool {
+	return version == Version12 || version == Version20 || version == Version21
+}
+
+func isVersion2(version string) bool {
+	return strings.HasPrefix(version, "2.")
+}
@@ -0,0 +1,565 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package xliff
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+// XLIFF 1.2 state qualifiers have no prefix, which XLIFF 2.x requires for
+// subState values. They are written with this one and read back without it.
+const subStatePrefix = "xliff12:"
+
+// XLIFF 1.2 states that have no XLIFF 2.x equivalent, as custom states, are
+// kept in subState with this prefix, followed by the state qualifier after
+// a slash if there is one.
+const stateSubStatePrefix = "delta:"
+
+// segment2 is a <segment> or <ignorable> of an XLIFF 2.x unit, with its
+// state and sub-state as read.
+type segment2 struct {
+	id          string
+	ignorable   bool
+	source      Content
+	target      Content
+	hasTarget   bool
+	state       string
+	subState    string
+	extra       Extra
+	sourceExtra Extra
+	targetExtra Extra
+}
+
+// markerID returns the id of the segment marker of the nth segment of a
+// unit.
+func (segment segment2) markerID(n int) string {
+	if segment.id != "" {
+		return segment.id
+	}
+
+	return strconv.Itoa(n + 1)
+}
+
+func (r *reader) document2(root xml.StartElement, document *Document) error {
+	sourceLanguage, targetLanguage := attr(root, "srcLang"), attr(root, "trgLang")
+
+	r.element(root, &document.Extra, "xmlns", "version", "srcLang", "trgLang")
+
+	return r.children(root, &document.Extra, func(start xml.StartElement) error {
+		if start.Name.Local != "file" {
+			return r.unknown(start, &document.Extra)
+		}
+
+		file := File{
+			ID:             attr(start, "id"),
+			Original:       attr(start, "original"),
+			SourceLanguage: sourceLanguage,
+			TargetLanguage: targetLanguage,
+		}
+
+		r.element(start, &file.Extra, "id", "original")
+
+		r.openFile = &file
+
+		err := r.children(start, &file.Extra, func(start xml.StartElement) error {
+			return r.member2(start, file, &file.Body.TransUnits, &file.Body.Groups, &file.Extra)
+		})
+		if err != nil {
+			return err
+		}
+
+		document.Files = append(document.Files, file)
+
+		return nil
+	})
+}
+
+// member2 reads a child of a file or group into its units or groups.
+func (r *reader) member2(element xml.StartElement, file File, transUnits *[]TransUnit, groups *[]Group, extra *Extra) error {
+	start := r.from
+
+	switch element.Name.Local {
+	case "unit":
+		transUnit, err := r.unit2(element, file)
+		if err != nil {
+			return err
+		}
+
+		return r.add(transUnit, transUnits, start, extra)
+	case "group":
+		group := Group{
+			ID:        attr(element, "id"),
+			Resname:   attr(element, "name"),
+			Translate: attr(element, "translate"),
+		}
+
+		r.element(element, &group.Extra, "id", "name", "translate")
+
+		r.openGroups = append(r.openGroups, &group)
+
+		err := r.children(element, &group.Extra, func(start xml.StartElement) error {
+			return r.member2(start, file, &group.TransUnits, &group.Groups, &group.Extra)
+		})
+
+		r.openGroups = r.openGroups[:len(r.openGroups)-1]
+
+		if err != nil {
+			return err
+		}
+
+		r.addGroup(group, groups, extra)
+
+		return nil
+	}
+
+	return r.unknown(element, extra)
+}
+
+// unit2 reads a <unit> as a trans-unit. The segments of the unit are joined
+// into a single source, and kept as the segments of its seg-source when
+// the unit has ignorables or more than one segment. The target holds the
+// segments of the seg-source. The segments are kept in the unit as read, so
+// that they are written back the same way.
+func (r *reader) unit2(element xml.StartElement, file File) (TransUnit, error) {
+	var segments []segment2
+
+	transUnit := TransUnit{
+		ID:        attr(element, "id"),
+		Resname:   attr(element, "name"),
+		Translate: attr(element, "translate"),
+		Source:    Source{Language: file.SourceLanguage},
+		Target:    Target{Language: file.TargetLanguage},
+	}
+
+	r.element(element, &transUnit.Extra, "id", "name", "translate")
+
+	err := r.children(element, &transUnit.Extra, func(start xml.StartElement) error {
+		switch start.Name.Local {
+		case "notes":
+			r.element(start, &transUnit.notes)
+
+			return r.children(start, &transUnit.notes, func(start xml.StartElement) error {
+				if start.Name.Local != "note" {
+					return r.unknown(start, &transUnit.notes)
+				}
+
+				note, err := r.note(start, "category")
+				transUnit.Notes = append(transUnit.Notes, note)
+
+				return err
+			})
+		case "segment", "ignorable":
+			segment, err := r.segment2(start)
+			segments = append(segments, segment)
+
+			return err
+		}
+
+		return r.unknown(start, &transUnit.Extra)
+	})
+
+	var hasTarget bool
+
+	for _, segment := range segments {
+		hasTarget = hasTarget || segment.hasTarget
+	}
+
+	segmented := len(segments) > 1
+	if segmented {
+		transUnit.SegSource.Content = segSource2(segments)
+	}
+
+	for n, segment := range segments {
+		transUnit.Source.Content = appendContent(transUnit.Source.Content, segment.source...)
+
+		target := segment.target
+		if segment.ignorable {
+			if !segment.hasTarget {
+				target = segment.source
+			}
+		} else if segmented {
+			target = Content{segmentMarker(segment.markerID(n), segment.target)}
+		}
+
+		if hasTarget && (segment.hasTarget || segment.ignorable || segmented) {
+			transUnit.Target.Content = appendContent(transUnit.Target.Content, target...)
+		}
+	}
+
+	if len(segments) == 1 {
+		transUnit.Source.Extra = segments[0].sourceExtra
+		transUnit.Target.Extra = segments[0].targetExtra
+	}
+
+	transUnit.Source.Data = transUnit.Source.Content.Text()
+	transUnit.Target.Data = transUnit.Target.Content.Text()
+	transUnit.Target.State, transUnit.Target.StateQualifier = statesFrom2(unitState2(segments))
+	transUnit.segments = segments
+
+	return transUnit, err
+}
+
+func (r *reader) segment2(element xml.StartElement) (segment2, error) {
+	segment := segment2{
+		id:        attr(element, "id"),
+		ignorable: element.Name.Local == "ignorable",
+		state:     attr(element, "state"),
+		subState:  attr(element, "subState"),
+	}
+
+	var hasSource bool
+
+	r.element(element, &segment.extra, "id", "state", "subState")
+
+	err := r.children(element, &segment.extra, func(start xml.StartElement) error {
+		var err error
+
+		switch {
+		case start.Name.Local == "source" && !hasSource:
+			hasSource = true
+			r.element(start, &segment.sourceExtra)
+			segment.source, err = r.contentOf(start, &segment.sourceExtra)
+		case start.Name.Local == "target" && !segment.hasTarget:
+			r.element(start, &segment.targetExtra)
+			segment.target, err = r.contentOf(start, &segment.targetExtra)
+			segment.hasTarget = true
+		default:
+			err = r.unknown(start, &segment.extra)
+		}
+
+		return err
+	})
+
+	return segment, err
+}
+
+// segSource2 returns the seg-source of a unit read with the given segments:
+// their sources, with those of the segments other than ignorables enclosed
+// in segment markers.
+func segSource2(segments []segment2) Content {
+	var content Content
+
+	for n, segment := range segments {
+		if segment.ignorable {
+			content = appendContent(content, segment.source...)
+		} else {
+			content = append(content, segmentMarker(segment.markerID(n), segment.source))
+		}
+	}
+
+	return content
+}
+
+// unitState2 returns the state and sub-state of a unit read with the given
+// segments: those of its least advanced segment, a segment without state
+// being initial.
+func unitState2(segments []segment2) (string, string) {
+	state, subState, rank := "", "", -1
+
+	for _, segment := range segments {
+		if segment.ignorable {
+			continue
+		}
+
+		if rank < 0 || stateRank2(segment.state) < rank {
+			state, subState, rank = segment.state, segment.subState, stateRank2(segment.state)
+		}
+	}
+
+	if rank >= 0 && state == "" {
+		state = "initial"
+	}
+
+	return state, subState
+}
+
+func (w *writer) document2(document Document) {
+	var sourceLanguage, targetLanguage string
+
+	if len(document.Files) > 0 {
+		sourceLanguage, targetLanguage = document.Files[0].SourceLanguage, document.Files[0].TargetLanguage
+	}
+
+	var files []child
+
+	for idx, file := range document.Files {
+		id := file.ID
+		if id == "" {
+			id = "f" + strconv.Itoa(idx+1)
+		}
+
+		files = append(files, w.file2(file, id))
+	}
+
+	w.element("xliff", attrs(
+		"xmlns", namespace(document, Namespace20),
+		"version", document.Version,
+		"srcLang", sourceLanguage,
+		"trgLang", targetLanguage), document.Extra, files)
+}
+
+func (w *writer) file2(file File, id string) child {
+	return child{"file", func() {
+		w.element("file", attrs("id", id, "original", file.Original), file.Extra,
+			w.members2(file.Body.TransUnits, file.Body.Groups))
+	}}
+}
+
+// members2 returns the units and groups of a file or group.
+func (w *writer) members2(transUnits []TransUnit, groups []Group) []child {
+	var children []child
+
+	if w.stream {
+		return []child{w.splitChild("unit")}
+	}
+
+	for _, transUnit := range transUnits {
+		children = append(children, w.unit2(transUnit))
+	}
+
+	for _, group := range groups {
+		group := group
+
+		children = append(children, child{"group", func() {
+			w.element("group", attrs("id", group.ID, "name", group.Resname, "translate", group.Translate), group.Extra,
+				w.members2(group.TransUnits, group.Groups))
+		}})
+	}
+
+	return children
+}
+
+func (w *writer) unit2(transUnit TransUnit) child {
+	var children []child
+
+	if len(transUnit.Notes) > 0 {
+		var notes []child
+
+		for _, note := range transUnit.Notes {
+			notes = append(notes, w.note(note, attrs("category", note.From)))
+		}
+
+		children = append(children, child{"notes", func() {
+			w.element("notes", nil, transUnit.notes, notes)
+		}})
+	}
+
+	target := transUnit.Target
+
+	source := contentOf(transUnit.Source.Data, transUnit.Source.Content)
+	targetContent := contentOf(target.Data, target.Content)
+	state2, subState := statesTo2(target.State, target.StateQualifier)
+	state := attrs("state", state2, "subState", subState)
+
+	// Segments keep the states they were read with as long as the state of
+	// the unit is the one read.
+	var keepStates bool
+	if len(transUnit.segments) > 0 {
+		readState, readQualifier := statesFrom2(unitState2(transUnit.segments))
+		keepStates = readState == target.State && readQualifier == target.StateQualifier
+	}
+
+	if transUnit.SegSource.Content.IsSegmented() {
+		children = append(children, w.segments2(transUnit, state, keepStates, references(source))...)
+	} else {
+		var read segment2
+		if len(transUnit.segments) == 1 {
+			read = transUnit.segments[0]
+		}
+
+		if keepStates {
+			state = attrs("state", read.state, "subState", read.subState)
+		}
+
+		read.sourceExtra, read.targetExtra = transUnit.Source.Extra, target.Extra
+
+		children = append(children, w.segment2("segment", append(attrs("id", read.id), state...), read,
+			source, targetContent.WithoutSegments(), len(targetContent) > 0, references(source)))
+	}
+
+	return child{"unit", func() {
+		w.element("unit", attrs("id", transUnit.ID, "name", transUnit.Resname, "translate", transUnit.Translate),
+			transUnit.Extra, children)
+	}}
+}
+
+// segments2 returns a <segment> for every segment of the seg-source of
+// transUnit, and an <ignorable> for the content between them. The segments
+// the unit was read with are written back as read while its seg-source is
+// unchanged. A target without segments goes to the first segment, and the
+// other segments are left without target in the initial state.
+func (w *writer) segments2(transUnit TransUnit, state []xml.Attr, keepStates bool, reference map[string]Inline) []child {
+	var children []child
+	var ignorable Content
+
+	target := contentOf(transUnit.Target.Data, transUnit.Target.Content)
+
+	// segmentState returns the state of a segment with the given target.
+	segmentState := func(segmentTarget Content) []xml.Attr {
+		if len(segmentTarget) == 0 && len(target) > 0 {
+			return attrs("state", "initial")
+		}
+
+		return state
+	}
+
+	targets := make(map[string]Content)
+	if target.IsSegmented() {
+		for _, segment := range transUnit.Segments() {
+			targets[segment.ID] = segment.Target
+		}
+	} else if len(target) > 0 {
+		for _, inline := range transUnit.SegSource.Content {
+			if isSegment(inline) {
+				targets[segmentID(inline)] = target
+				break
+			}
+		}
+	}
+
+	if len(transUnit.segments) > 1 && segSource2(transUnit.segments).Markup() == transUnit.SegSource.Content.Markup() {
+		for n, segment := range transUnit.segments {
+			if segment.ignorable {
+				children = append(children, w.segment2("ignorable", attrs("id", segment.id), segment,
+					segment.source, segment.target, segment.hasTarget, nil))
+				continue
+			}
+
+			target := targets[segment.markerID(n)]
+
+			attributes := segmentState(target)
+			if keepStates {
+				attributes = attrs("state", segment.state, "subState", segment.subState)
+			}
+
+			children = append(children, w.segment2("segment", append(attrs("id", segment.id), attributes...), segment,
+				segment.source, target, len(target) > 0, reference))
+		}
+
+		return children
+	}
+
+	flush := func() {
+		if len(ignorable) > 0 {
+			children = append(children, w.segment2("ignorable", nil, segment2{}, ignorable, nil, false, nil))
+			ignorable = nil
+		}
+	}
+
+	for _, inline := range transUnit.SegSource.Content {
+		if !isSegment(inline) {
+			ignorable = appendContent(ignorable, inline)
+			continue
+		}
+
+		flush()
+
+		target := targets[segmentID(inline)]
+
+		children = append(children, w.segment2("segment", append(attrs("id", segmentID(inline)), segmentState(target)...), segment2{},
+			inline.Content, target, len(target) > 0, reference))
+	}
+
+	flush()
+
+	return children
+}
+
+// segment2 returns a <segment> or <ignorable> with the given source and
+// target, written the way read was.
+func (w *writer) segment2(name string, attributes []xml.Attr, read segment2, source Content, target Content, hasTarget bool, reference map[string]Inline) child {
+	children := []child{{"source", func() {
+		w.content("source", source, nil, read.sourceExtra, nil)
+	}}}
+	if hasTarget {
+		children = append(children, child{"target", func() {
+			w.content("target", target, nil, read.targetExtra, reference)
+		}})
+	}
+
+	return child{name, func() {
+		w.element(name, attributes, read.extra, children)
+	}}
+}
+
+// stateFrom2 maps an XLIFF 2.x segment state onto the XLIFF 1.2 vocabulary.
+func stateFrom2(state string) string {
+	switch state {
+	case "initial":
+		return "new"
+	case "reviewed":
+		return "signed-off"
+	}
+
+	return state
+}
+
+// stateTo2 maps an XLIFF 1.2 target state onto the XLIFF 2.x vocabulary.
+func stateTo2(state string) string {
+	switch state {
+	case "":
+		return ""
+	case "translated", "needs-review-translation", "needs-review-l10n", "needs-review-adaptation":
+		return "translated"
+	case "signed-off":
+		return "reviewed"
+	case "final":
+		return "final"
+	}
+
+	return "initial"
+}
+
+// statesTo2 returns the XLIFF 2.x state and subState of a target with the
+// given XLIFF 1.2 state and state qualifier.
+func statesTo2(state string, qualifier string) (string, string) {
+	state2 := stateTo2(state)
+
+	if stateFrom2(state2) != state {
+		subState := stateSubStatePrefix + state
+		if qualifier != "" {
+			subState += "/" + qualifier
+		}
+
+		return state2, subState
+	}
+
+	if qualifier != "" && !strings.Contains(qualifier, ":") {
+		qualifier = subStatePrefix + qualifier
+	}
+
+	return state2, qualifier
+}
+
+// statesFrom2 returns the XLIFF 1.2 state and state qualifier of a target
+// with the given XLIFF 2.x state and subState.
+func statesFrom2(state string, subState string) (string, string) {
+	if strings.HasPrefix(subState, stateSubStatePrefix) {
+		state, qualifier := strings.TrimPrefix(subState, stateSubStatePrefix), ""
+
+		if index := strings.Index(state, "/"); index >= 0 {
+			state, qualifier = state[:index], state[index+1:]
+		}
+
+		return state, qualifier
+	}
+
+	return stateFrom2(state), strings.TrimPrefix(subState, subStatePrefix)
+}
+
+func stateRank2(state string) int {
+	switch state {
+	case "translated":
+		return 1
+	case "reviewed":
+		return 2
+	case "final":
+		return 3
+	}
+
+	return 0
+}
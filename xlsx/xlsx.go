@@ -0,0 +1,321 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+// Package xlsx writes and reads the rows of text of Office Open XML
+// workbooks, as spreadsheet applications save them. A workbook is written
+// with a single sheet of text cells, and the first sheet of a workbook is
+// read, with the text of its cells whatever their type.
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const contentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>
+`
+
+const packageRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>
+`
+
+const workbookRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>
+`
+
+// Writes a workbook to output with a sheet of the given name holding rows.
+func Write(output io.Writer, name string, rows [][]string) error {
+	archive := zip.NewWriter(output)
+
+	workbook := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="` + escape(name) + `" sheetId="1" r:id="rId1"/></sheets>
+</workbook>
+`
+
+	parts := []struct {
+		name string
+		data string
+	}{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", packageRelationships},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", workbookRelationships},
+		{"xl/worksheets/sheet1.xml", sheet(rows)},
+	}
+
+	for _, part := range parts {
+		writer, err := archive.Create(part.name)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(writer, part.data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// sheet returns the part of a sheet holding rows as inline strings.
+func sheet(rows [][]string) string {
+	var data strings.Builder
+
+	data.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	for i, row := range rows {
+		number := strconv.Itoa(i + 1)
+		data.WriteString(`<row r="` + number + `">`)
+
+		for j, value := range row {
+			if value == "" {
+				continue
+			}
+
+			data.WriteString(`<c r="` + columnName(j) + number + `" t="inlineStr"><is><t xml:space="preserve">` + escape(value) + `</t></is></c>`)
+		}
+
+		data.WriteString(`</row>`)
+	}
+
+	data.WriteString("</sheetData></worksheet>\n")
+
+	return data.String()
+}
+
+// escape returns text escaped for XML.
+func escape(text string) string {
+	var escaped bytes.Buffer
+
+	xml.EscapeText(&escaped, []byte(text))
+
+	return escaped.String()
+}
+
+// columnName returns the name of the column of index, as A or AB.
+func columnName(index int) string {
+	name := ""
+
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+
+	return name
+}
+
+// columnIndex returns the index of the column of a cell reference, as B2.
+func columnIndex(reference string) int {
+	index := 0
+
+	for _, c := range reference {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+
+		index = index*26 + int(c-'A') + 1
+	}
+
+	return index - 1
+}
+
+type relationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type workbook struct {
+	Sheets []struct {
+		ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// text is a string of a cell: a text, or runs of text.
+type text struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t text) String() string {
+	value := t.Text
+
+	for _, run := range t.Runs {
+		value += run.Text
+	}
+
+	return value
+}
+
+type sharedStrings struct {
+	Strings []text `xml:"si"`
+}
+
+type worksheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Reference string `xml:"r,attr"`
+			Type      string `xml:"t,attr"`
+			Value     string `xml:"v"`
+			Inline    text   `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// Returns the rows of the first sheet of the workbook in data, with the
+// text of their cells. Rows and cells left out of the sheet are empty.
+func Read(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+
+	if err != nil {
+		return nil, errors.New("not a workbook: " + err.Error())
+	}
+
+	parts := make(map[string]*zip.File)
+
+	for _, file := range archive.File {
+		parts[file.Name] = file
+	}
+
+	var book workbook
+
+	if err := readPart(parts, "xl/workbook.xml", &book); err != nil {
+		return nil, err
+	}
+
+	if len(book.Sheets) == 0 {
+		return nil, errors.New("workbook has no sheet")
+	}
+
+	var links relationships
+
+	if err := readPart(parts, "xl/_rels/workbook.xml.rels", &links); err != nil {
+		return nil, err
+	}
+
+	sheetPath := ""
+
+	for _, link := range links.Relationships {
+		if link.ID == book.Sheets[0].ID {
+			sheetPath = link.Target
+		}
+	}
+
+	if strings.HasPrefix(sheetPath, "/") {
+		sheetPath = sheetPath[1:]
+	} else {
+		sheetPath = path.Join("xl", sheetPath)
+	}
+
+	var shared sharedStrings
+
+	if _, ok := parts["xl/sharedStrings.xml"]; ok {
+		if err := readPart(parts, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	var cells worksheet
+
+	if err := readPart(parts, sheetPath, &cells); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+
+	for _, row := range cells.Rows {
+		number := row.Number
+		if number == 0 {
+			number = len(rows) + 1
+		}
+
+		for len(rows) < number {
+			rows = append(rows, nil)
+		}
+
+		var values []string
+
+		for _, cell := range row.Cells {
+			index := len(values)
+			if cell.Reference != "" {
+				index = columnIndex(cell.Reference)
+			}
+
+			for len(values) <= index {
+				values = append(values, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				i, err := strconv.Atoi(cell.Value)
+
+				if err != nil || i < 0 || i >= len(shared.Strings) {
+					return nil, errors.New("cell " + cell.Reference + " has no shared string " + cell.Value)
+				}
+
+				values[index] = shared.Strings[i].String()
+			case "inlineStr":
+				values[index] = cell.Inline.String()
+			default:
+				values[index] = cell.Value
+			}
+		}
+
+		rows[number-1] = values
+	}
+
+	return rows, nil
+}
+
+// readPart reads the XML part of the given name into v.
+func readPart(parts map[string]*zip.File, name string, v interface{}) error {
+	file, ok := parts[name]
+
+	if !ok {
+		return errors.New("workbook has no part " + name)
+	}
+
+	input, err := file.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer input.Close()
+
+	data, err := ioutil.ReadAll(input)
+
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(data, v); err != nil {
+		return errors.New("part " + name + " of workbook: " + err.Error())
+	}
+
+	return nil
+}